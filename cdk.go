@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	awscdk "github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsscheduler"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsschedulertargets"
 	constructs "github.com/aws/constructs-go/constructs/v10"
 	jsii "github.com/aws/jsii-runtime-go"
 )
@@ -32,6 +37,9 @@ const (
 	Handler      = "main.Handler"
 	ScheduleRate = 1
 	EnvFilePath  = "env.json"
+
+	// LiveAliasName is the alias that carries provisioned concurrency
+	LiveAliasName = "live"
 )
 
 type LambdaCdkStackProps struct {
@@ -65,12 +73,77 @@ func LoadEnvironmentVariables(filePath string) (map[string]*string, error) {
 	return env.Parameters, nil
 }
 
+// EnvBool reads a boolean environment variable, returning def when it is unset or invalid
+func EnvBool(name string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// EnvInt reads an integer environment variable, returning def when it is unset or invalid
+func EnvInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
 // Personal mode deployment configuration
 type PersonalConfig struct {
 	ServiceType string
 	LocationID  string
 	NtfyTopic   string
 	NtfyServer  string
+	DedupTTL    string // Seconds to suppress repeat alerts; enables a DynamoDB dedup table when set
+	SNSTopicARN string // Also publish appointment events to this SNS topic
+
+	DailySummaryTime     string // HH:MM to send the daily availability summary; empty disables it
+	DailySummaryTimezone string // IANA time zone for DailySummaryTime, default UTC
+}
+
+// grantSNSPublish lets fn publish to the SNS topic it sends appointment events to, if one is configured
+func grantSNSPublish(fn awslambda.Function, topicARN string) {
+	if topicARN == "" {
+		return
+	}
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("sns:Publish"),
+		Resources: jsii.Strings(topicARN),
+	}))
+}
+
+// addDailySummarySchedule invokes fn with {"dailySummary": true} every day at clock ("HH:MM")
+// in timezone. EventBridge Scheduler is used rather than a rule because rules only run in UTC,
+// which would shift the summary by an hour at every daylight saving change.
+func addDailySummarySchedule(stack awscdk.Stack, fn awslambda.IFunction, clock, timezone string) {
+	if clock == "" {
+		return
+	}
+	hh, mm, _ := strings.Cut(clock, ":")
+	hour, err := strconv.Atoi(hh)
+	if err != nil {
+		panic("DAILY_SUMMARY_TIME must be HH:MM, got " + clock)
+	}
+	minute, err := strconv.Atoi(mm)
+	if err != nil {
+		panic("DAILY_SUMMARY_TIME must be HH:MM, got " + clock)
+	}
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	awsscheduler.NewSchedule(stack, jsii.String("DailySummarySchedule"), &awsscheduler.ScheduleProps{
+		Schedule: awsscheduler.ScheduleExpression_Cron(&awsscheduler.CronOptionsWithTimezone{
+			Hour:     jsii.String(strconv.Itoa(hour)),
+			Minute:   jsii.String(strconv.Itoa(minute)),
+			TimeZone: awscdk.TimeZone_Of(jsii.String(timezone)),
+		}),
+		Target: awsschedulertargets.NewLambdaInvoke(fn, &awsschedulertargets.ScheduleTargetBaseProps{
+			Input: awsscheduler.ScheduleTargetInput_FromObject(map[string]interface{}{"dailySummary": true}),
+		}),
+	})
 }
 
 // NewPersonalLambdaStack creates a personal mode stack
@@ -88,6 +161,15 @@ func NewPersonalLambdaStack(scope constructs.Construct, id string, config Person
 	if config.NtfyServer != "" {
 		envVars["NTFY_SERVER"] = jsii.String(config.NtfyServer)
 	}
+	if config.SNSTopicARN != "" {
+		envVars["SNS_TOPIC_ARN"] = jsii.String(config.SNSTopicARN)
+	}
+	if config.DailySummaryTime != "" {
+		envVars["DAILY_SUMMARY_TIME"] = jsii.String(config.DailySummaryTime)
+	}
+	if config.DailySummaryTimezone != "" {
+		envVars["DAILY_SUMMARY_TIMEZONE"] = jsii.String(config.DailySummaryTimezone)
+	}
 
 	// Define Lambda function for personal mode (optimized settings)
 	personalFn := awslambda.NewFunction(stack, jsii.String(PersonalFunctionName), &awslambda.FunctionProps{
@@ -100,6 +182,20 @@ func NewPersonalLambdaStack(scope constructs.Construct, id string, config Person
 		Environment:  &envVars,
 		// No Function URL - personal mode doesn't need public access
 	})
+	grantSNSPublish(personalFn, config.SNSTopicARN)
+
+	// Optional DynamoDB table so notification dedup survives cold starts
+	if config.DedupTTL != "" {
+		dedupTable := awsdynamodb.NewTable(stack, jsii.String("PersonalDedupTable"), &awsdynamodb.TableProps{
+			PartitionKey:        &awsdynamodb.Attribute{Name: jsii.String("key"), Type: awsdynamodb.AttributeType_STRING},
+			BillingMode:         awsdynamodb.BillingMode_PAY_PER_REQUEST,
+			TimeToLiveAttribute: jsii.String("expiresAt"),
+			RemovalPolicy:       awscdk.RemovalPolicy_DESTROY,
+		})
+		dedupTable.GrantReadWriteData(personalFn)
+		personalFn.AddEnvironment(jsii.String("DEDUP_TABLE"), dedupTable.TableName(), nil)
+		personalFn.AddEnvironment(jsii.String("DEDUP_TTL_SECONDS"), jsii.String(config.DedupTTL), nil)
+	}
 
 	// Define CloudWatch event rule (1-minute schedule same as multi-user)
 	rule := awsevents.NewRule(stack, jsii.String("PersonalScheduledRule"), &awsevents.RuleProps{
@@ -117,6 +213,7 @@ func NewPersonalLambdaStack(scope constructs.Construct, id string, config Person
 
 	// Add Lambda function as a target for the rule
 	rule.AddTarget(awseventstargets.NewLambdaFunction(personalFn, &awseventstargets.LambdaFunctionProps{}))
+	addDailySummarySchedule(stack, personalFn, config.DailySummaryTime, config.DailySummaryTimezone)
 
 	// Output the function name for reference
 	awscdk.NewCfnOutput(stack, jsii.String("PersonalFunctionName"), &awscdk.CfnOutputProps{
@@ -146,6 +243,9 @@ func NewLambdaCdkStack(scope constructs.Construct, id string, props *LambdaCdkSt
 		Handler:      jsii.String(Handler),
 		Environment:  &envVars,
 	})
+	if arn := envVars["SNS_TOPIC_ARN"]; arn != nil {
+		grantSNSPublish(globalEntryFn, *arn)
+	}
 
 	// Define CloudWatch event rule
 	rule := awsevents.NewRule(stack, jsii.String("GlobalEntryScheduledRule"), &awsevents.RuleProps{
@@ -166,16 +266,40 @@ func NewLambdaCdkStack(scope constructs.Construct, id string, props *LambdaCdkSt
 
 	// Add Lambda function as a target for the rule
 	rule.AddTarget(awseventstargets.NewLambdaFunction(globalEntryFn, &awseventstargets.LambdaFunctionProps{}))
+	if clock := envVars["DAILY_SUMMARY_TIME"]; clock != nil {
+		timezone := ""
+		if tz := envVars["DAILY_SUMMARY_TIMEZONE"]; tz != nil {
+			timezone = *tz
+		}
+		addDailySummarySchedule(stack, globalEntryFn, *clock, timezone)
+	}
 
-	// Add a public Lambda Function URL
-	functionUrl := globalEntryFn.AddFunctionUrl(&awslambda.FunctionUrlOptions{
-		AuthType: awslambda.FunctionUrlAuthType_NONE,
-	})
+	// Keep a provisioned alias warm for the subscribe endpoint when requested (billed per hour)
+	var urlTarget awslambda.IFunction = globalEntryFn
+	if concurrency := EnvInt("PROVISIONED_CONCURRENCY", 0); concurrency > 0 {
+		alias := awslambda.NewAlias(stack, jsii.String("LiveAlias"), &awslambda.AliasProps{
+			AliasName:                       jsii.String(LiveAliasName),
+			Version:                         globalEntryFn.CurrentVersion(),
+			ProvisionedConcurrentExecutions: jsii.Number(concurrency),
+		})
+		urlTarget = alias
 
-	// Output the public function URL
-	awscdk.NewCfnOutput(stack, jsii.String("LambdaFunctionURL"), &awscdk.CfnOutputProps{
-		Value: functionUrl.Url(),
-	})
+		awscdk.NewCfnOutput(stack, jsii.String("LambdaAliasArn"), &awscdk.CfnOutputProps{
+			Value: alias.FunctionArn(),
+		})
+	}
+
+	// Add a public Lambda Function URL unless running checker-only
+	if EnvBool("ENABLE_FUNCTION_URL", true) {
+		functionUrl := urlTarget.AddFunctionUrl(&awslambda.FunctionUrlOptions{
+			AuthType: awslambda.FunctionUrlAuthType_NONE,
+		})
+
+		// Output the public function URL
+		awscdk.NewCfnOutput(stack, jsii.String("LambdaFunctionURL"), &awscdk.CfnOutputProps{
+			Value: functionUrl.Url(),
+		})
+	}
 
 	return stack
 }
@@ -191,6 +315,11 @@ func main() {
 			LocationID:  os.Getenv("LOCATION_ID"),
 			NtfyTopic:   os.Getenv("NTFY_TOPIC"),
 			NtfyServer:  os.Getenv("NTFY_SERVER"),
+			DedupTTL:    os.Getenv("DEDUP_TTL_SECONDS"),
+			SNSTopicARN: os.Getenv("SNS_TOPIC_ARN"),
+
+			DailySummaryTime:     os.Getenv("DAILY_SUMMARY_TIME"),
+			DailySummaryTimezone: os.Getenv("DAILY_SUMMARY_TIMEZONE"),
 		}
 
 		if config.ServiceType == "" {
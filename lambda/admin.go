@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Page sizes for GET /admin/subscriptions. The maximum keeps a page far below the 6 MB
+// API Gateway response limit even with long topics and many tags.
+const (
+	defaultAdminPageSize = 100
+	maxAdminPageSize     = 500
+)
+
+type (
+	// adminSubscriptionsPage is one page of GET /admin/subscriptions
+	adminSubscriptionsPage struct {
+		Subscriptions []subscriptionView `json:"subscriptions"`
+		HasMore       bool               `json:"hasMore"`
+		NextToken     string             `json:"nextToken,omitempty"` // Pass as nextToken to get the following page
+	}
+)
+
+// authorizeAdmin checks the bearer token against ADMIN_API_TOKEN. Admin endpoints answer 404
+// when no token is configured, so they don't exist on deployments that never opted in.
+func (h *LambdaHandler) authorizeAdmin(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, bool) {
+	token := h.Mode.MultiUserConfig.AdminAPIToken
+	if token == "" {
+		return errorResponse(404, "not found"), false
+	}
+	var auth string
+	for name, value := range req.Headers {
+		if strings.EqualFold(name, "Authorization") {
+			auth = value
+		}
+	}
+	given, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return errorResponse(401, "missing or invalid admin token"), false
+	}
+	return events.APIGatewayV2HTTPResponse{}, true
+}
+
+// parseAdminPage reads the limit and nextToken query parameters
+func parseAdminPage(query map[string]string) (int, bson.ObjectID, error) {
+	limit := defaultAdminPageSize
+	if value := query["limit"]; value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxAdminPageSize {
+			return 0, bson.ObjectID{}, fmt.Errorf("limit must be between 1 and %d, got %q", maxAdminPageSize, value)
+		}
+		limit = n
+	}
+	var after bson.ObjectID
+	if token := query["nextToken"]; token != "" {
+		id, err := bson.ObjectIDFromHex(token)
+		if err != nil {
+			return 0, bson.ObjectID{}, fmt.Errorf("nextToken is invalid")
+		}
+		after = id
+	}
+	return limit, after, nil
+}
+
+// handleAdminSubscriptions exports subscriptions one page at a time in _id order. One extra
+// document is fetched to tell whether another page follows.
+func (h *LambdaHandler) handleAdminSubscriptions(ctx context.Context, coll *mongo.Collection, query map[string]string) (events.APIGatewayV2HTTPResponse, error) {
+	limit, after, err := parseAdminPage(query)
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+	filter := bson.M{}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit) + 1)
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to list subscriptions: %v", err)
+	}
+	defer cursor.Close(ctx)
+	var subs []Subscription
+	for cursor.Next(ctx) {
+		// Subscription.ID is a string, so decode the ObjectID _id as hex
+		dec := bson.NewDecoder(bson.NewDocumentReader(bytes.NewReader(cursor.Current)))
+		dec.ObjectIDAsHexString()
+		var sub Subscription
+		if err := dec.Decode(&sub); err != nil {
+			return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to decode subscription: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+	if err := cursor.Err(); err != nil {
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to list subscriptions: %v", err)
+	}
+
+	page := adminSubscriptionsPage{Subscriptions: []subscriptionView{}}
+	if len(subs) > limit {
+		subs = subs[:limit]
+		page.HasMore = true
+		page.NextToken = subs[limit-1].ID
+	}
+	for _, sub := range subs {
+		page.Subscriptions = append(page.Subscriptions, subscriptionViewOf(sub))
+	}
+	body, _ := json.Marshal(page)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    corsHeaders,
+		Body:       string(body),
+	}, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestAuthorizeAdmin(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	withAuth := func(value string) events.APIGatewayV2HTTPRequest {
+		return events.APIGatewayV2HTTPRequest{Headers: map[string]string{"authorization": value}}
+	}
+
+	resp, ok := handler.authorizeAdmin(withAuth("Bearer secret"))
+	assert.False(t, ok)
+	assert.Equal(t, 404, resp.StatusCode, "admin endpoints are hidden without ADMIN_API_TOKEN")
+
+	handler.Mode.MultiUserConfig.AdminAPIToken = "secret"
+	for _, auth := range []string{"", "secret", "Bearer wrong", "Basic secret"} {
+		resp, ok := handler.authorizeAdmin(withAuth(auth))
+		assert.False(t, ok, auth)
+		assert.Equal(t, 401, resp.StatusCode, auth)
+	}
+	_, ok = handler.authorizeAdmin(withAuth("Bearer secret"))
+	assert.True(t, ok)
+}
+
+func TestParseAdminPage(t *testing.T) {
+	limit, after, err := parseAdminPage(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultAdminPageSize, limit)
+	assert.True(t, after.IsZero())
+
+	id := bson.NewObjectID()
+	limit, after, err = parseAdminPage(map[string]string{"limit": "25", "nextToken": id.Hex()})
+	assert.NoError(t, err)
+	assert.Equal(t, 25, limit)
+	assert.Equal(t, id, after)
+
+	for _, query := range []map[string]string{{"limit": "0"}, {"limit": "501"}, {"limit": "ten"}, {"nextToken": "bogus"}} {
+		_, _, err := parseAdminPage(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestHandleAdminSubscriptions_Pagination(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	for i := range 5 {
+		_, err := coll.InsertOne(ctx, bson.M{"location": "5300", "ntfyTopic": fmt.Sprintf("user%d", i), "createdAt": time.Now().UTC()})
+		assert.NoError(t, err)
+	}
+
+	var topics []string
+	query := map[string]string{"limit": "2"}
+	for pages := 1; ; pages++ {
+		resp, err := handler.handleAdminSubscriptions(ctx, coll, query)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		var page adminSubscriptionsPage
+		assert.NoError(t, json.Unmarshal([]byte(resp.Body), &page))
+		for _, sub := range page.Subscriptions {
+			topics = append(topics, sub.NtfyTopic)
+		}
+		if !page.HasMore {
+			assert.Empty(t, page.NextToken)
+			assert.Equal(t, 3, pages)
+			break
+		}
+		query["nextToken"] = page.NextToken
+	}
+	assert.Equal(t, []string{"user0", "user1", "user2", "user3", "user4"}, topics)
+}
+
+func adminRunRequest(auth string) []byte {
+	apiReq := events.APIGatewayV2HTTPRequest{
+		RawPath: "/admin/run",
+		Headers: map[string]string{"authorization": auth},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "POST", Path: "/admin/run"},
+		},
+	}
+	eventJSON, _ := json.Marshal(apiReq)
+	return eventJSON
+}
+
+func TestHandleRequest_AdminRun(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	handler.Mode.MultiUserConfig.AdminAPIToken = "secret"
+
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "JFK", "ntfyTopic": "user1-jfk", "createdAt": time.Now().UTC()},
+		bson.M{"location": "5300", "ntfyTopic": "user2", "createdAt": time.Now().UTC()},
+	})
+	assert.NoError(t, err)
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T10:00","active":true}]`}}}
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+
+	resp, err := handler.HandleRequest(ctx, adminRunRequest("Bearer wrong"))
+	assert.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+	assert.Empty(t, notifier.sent)
+
+	resp, err = handler.HandleRequest(ctx, adminRunRequest("Bearer secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"message":"availability check completed","summary":{"locations":2,"checks":2,"found":2,"notificationsSent":2,"errors":0}}`, resp.Body)
+	assert.Len(t, notifier.sent, 2)
+}
+
+func TestHandleRequest_AdminRunDisabledWithoutToken(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	resp, err := handler.HandleRequest(context.Background(), adminRunRequest("Bearer secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Audited subscription actions
+const (
+	auditActionSubscribe   = "subscribe"
+	auditActionUnsubscribe = "unsubscribe"
+	auditActionUpdate      = "update"
+)
+
+type (
+	// AuditEntry records one change to a subscription. The topic is hashed because it is
+	// effectively the subscriber's password for their ntfy notifications.
+	AuditEntry struct {
+		Timestamp time.Time `bson:"timestamp"`
+		Action    string    `bson:"action"`
+		Location  string    `bson:"location"`
+		TopicHash string    `bson:"topicHash"`
+		ClientIP  string    `bson:"clientIP,omitempty"`
+		ExpiresAt time.Time `bson:"expiresAt"` // Removed by the collection's TTL index
+	}
+
+	// AuditLogger stores audit entries
+	AuditLogger interface {
+		Log(ctx context.Context, entry AuditEntry) error
+	}
+
+	// mongoAuditLogger writes audit entries to a MongoDB collection with a TTL index on expiresAt
+	mongoAuditLogger struct {
+		coll      *mongo.Collection
+		retention time.Duration
+	}
+)
+
+// hashTopic returns the hex SHA-256 of a topic, stable so entries for one topic can be correlated
+func hashTopic(topic string) string {
+	sum := sha256.Sum256([]byte(topic))
+	return hex.EncodeToString(sum[:])
+}
+
+// newMongoAuditLogger creates an AuditLogger that keeps entries for retention
+func newMongoAuditLogger(coll *mongo.Collection, retention time.Duration) *mongoAuditLogger {
+	return &mongoAuditLogger{coll: coll, retention: retention}
+}
+
+// ensureTTLIndex creates the TTL index that expires entries at their expiresAt time. Creating an
+// existing identical index is a no-op, so this is safe on every cold start.
+func (l *mongoAuditLogger) ensureTTLIndex(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := l.coll.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create audit TTL index: %v", err)
+	}
+	return nil
+}
+
+// Log inserts the entry, stamping its expiry from the retention period
+func (l *mongoAuditLogger) Log(ctx context.Context, entry AuditEntry) error {
+	entry.ExpiresAt = entry.Timestamp.Add(l.retention)
+	if _, err := l.coll.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to write audit entry: %v", err)
+	}
+	return nil
+}
+
+// audit records a subscription action when audit logging is enabled. Failures are only logged
+// so auditing never fails the user's request.
+func (h *LambdaHandler) audit(ctx context.Context, action, location, topic string) {
+	if h.Audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Timestamp: time.Now().UTC(),
+		Action:    action,
+		Location:  location,
+		TopicHash: hashTopic(topic),
+		ClientIP:  clientIPFromContext(ctx),
+	}
+	if err := h.Audit.Log(ctx, entry); err != nil {
+		slog.Warn("Failed to write audit entry", "action", action, "location", location, "error", err)
+	}
+}
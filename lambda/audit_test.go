@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingAuditLogger captures audit entries instead of storing them
+type recordingAuditLogger struct {
+	entries []AuditEntry
+	err     error
+}
+
+func (l *recordingAuditLogger) Log(ctx context.Context, entry AuditEntry) error {
+	l.entries = append(l.entries, entry)
+	return l.err
+}
+
+func TestHashTopic(t *testing.T) {
+	assert.Equal(t, hashTopic("user1-jfk"), hashTopic("user1-jfk"))
+	assert.NotEqual(t, hashTopic("user1-jfk"), hashTopic("user2-jfk"))
+	assert.Len(t, hashTopic("user1-jfk"), 64)
+	assert.NotContains(t, hashTopic("user1-jfk"), "user1")
+}
+
+func TestAudit(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+
+	// Disabled by default
+	handler.audit(context.Background(), auditActionSubscribe, "5300", "user1-jfk")
+
+	logger := &recordingAuditLogger{}
+	handler.Audit = logger
+	handler.audit(withClientIP(context.Background(), "203.0.113.7"), auditActionSubscribe, "5300", "user1-jfk")
+	if assert.Len(t, logger.entries, 1) {
+		entry := logger.entries[0]
+		assert.Equal(t, auditActionSubscribe, entry.Action)
+		assert.Equal(t, "5300", entry.Location)
+		assert.Equal(t, hashTopic("user1-jfk"), entry.TopicHash)
+		assert.Equal(t, "203.0.113.7", entry.ClientIP)
+		assert.False(t, entry.Timestamp.IsZero())
+	}
+
+	// Write failures never surface to the caller
+	logger.err = errors.New("write failed")
+	handler.audit(context.Background(), auditActionUnsubscribe, "5300", "user1-jfk")
+	assert.Len(t, logger.entries, 2)
+}
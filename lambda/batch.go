@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// batchedAlert is a notification queued for a topic until the batch is flushed
+	batchedAlert struct {
+		Location    string
+		ServiceType string
+		Title       string
+		Message     string
+		Attachment  *Attachment // Only sent when the alert isn't combined with others
+		Click       string      // Kept when every alert combined for the topic shares it
+		OneShot     bool
+		Priority    int
+		Tags        []string
+		Locale      string    // Resolved locale used for the combined title
+		CreatedAt   time.Time // Subscription age, for MAX_NOTIFICATIONS_PER_RUN
+		Slot        notifiedSlot
+	}
+
+	// notifiedSlot identifies the slot an alert reports, so a batched alert is only recorded
+	// as sent once the batch delivered it. The zero value is an alert without one.
+	notifiedSlot struct {
+		ServiceType string // With Location, the NOTIFY_ON_TRANSITION state to save
+		Location    string
+		Key         string // DEDUP_TTL_SECONDS key
+		Escalates   bool   // Whether Key also counts repeats for ESCALATE_AFTER
+	}
+
+	// notificationBatch groups alerts by topic so a topic watching several locations
+	// gets one combined notification per invocation
+	notificationBatch struct {
+		mu          sync.Mutex
+		topics      []string
+		alerts      map[string][]batchedAlert
+		undelivered map[notifiedSlot]bool // Slots some topic was dropped from by applyBudget
+	}
+
+	batchContextKey        struct{}
+	notifiedSlotContextKey struct{}
+)
+
+// withNotificationBatch returns a context whose notifications are queued in batch instead of sent
+func withNotificationBatch(ctx context.Context, batch *notificationBatch) context.Context {
+	return context.WithValue(ctx, batchContextKey{}, batch)
+}
+
+// batchFromContext returns the batch attached to ctx, if any
+func batchFromContext(ctx context.Context) *notificationBatch {
+	batch, _ := ctx.Value(batchContextKey{}).(*notificationBatch)
+	return batch
+}
+
+// withNotifiedSlot returns a context whose batched alerts report slot
+func withNotifiedSlot(ctx context.Context, slot notifiedSlot) context.Context {
+	return context.WithValue(ctx, notifiedSlotContextKey{}, slot)
+}
+
+// notifiedSlotFromContext returns the slot attached to ctx, or the zero value
+func notifiedSlotFromContext(ctx context.Context) notifiedSlot {
+	slot, _ := ctx.Value(notifiedSlotContextKey{}).(notifiedSlot)
+	return slot
+}
+
+// newNotificationBatch creates an empty batch
+func newNotificationBatch() *notificationBatch {
+	return &notificationBatch{alerts: make(map[string][]batchedAlert), undelivered: make(map[notifiedSlot]bool)}
+}
+
+// add queues an alert for topic
+func (b *notificationBatch) add(topic string, alert batchedAlert) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.alerts[topic]; !ok {
+		b.topics = append(b.topics, topic)
+	}
+	b.alerts[topic] = append(b.alerts[topic], alert)
+}
+
+// combineAlerts merges a topic's alerts into one title and message. A single alert is sent unchanged.
+// With groupByService, alerts for several service types are split into labeled sections.
+func combineAlerts(alerts []batchedAlert, groupByService bool) (string, string) {
+	if len(alerts) == 1 {
+		return alerts[0].Title, alerts[0].Message
+	}
+	catalog := messagesFor(alerts[0].Locale)
+	title := alerts[0].Title
+	var services []string
+	messages := make(map[string][]string)
+	for _, alert := range alerts {
+		if alert.Title != title {
+			title = catalog.GenericTitle
+		}
+		service := ""
+		if groupByService {
+			service = alert.ServiceType
+		}
+		if _, ok := messages[service]; !ok {
+			services = append(services, service)
+		}
+		messages[service] = append(messages[service], alert.Message)
+	}
+	title = fmt.Sprintf(catalog.CombinedTitle, title, len(alerts))
+	if len(services) == 1 {
+		return title, strings.Join(messages[services[0]], "\n")
+	}
+	sections := make([]string, 0, len(services))
+	for _, service := range services {
+		sections = append(sections, service+":\n"+strings.Join(messages[service], "\n"))
+	}
+	return title, strings.Join(sections, "\n\n")
+}
+
+// combinePreferences returns the highest priority and the union of tags across a topic's alerts
+func combinePreferences(alerts []batchedAlert) (int, []string) {
+	priority := 0
+	var tags []string
+	seen := make(map[string]bool)
+	for _, alert := range alerts {
+		priority = max(priority, alert.Priority)
+		for _, tag := range alert.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return priority, tags
+}
+
+// combinedClick returns the click URL shared by all of a topic's alerts. Alerts for different
+// locations each keep their link in the message, so the combined notification has none.
+func combinedClick(alerts []batchedAlert) string {
+	click := alerts[0].Click
+	for _, alert := range alerts[1:] {
+		if alert.Click != click {
+			return ""
+		}
+	}
+	return click
+}
+
+// flushNotificationBatch sends one notification per topic and records the delivery
+// result against every location it covered. A slot is marked notified, and its location's
+// availability saved, once every topic queued for it got the alert, as when sent unbatched.
+// Topics dropped by the notification cap count as not delivered. A slot that reached any
+// topic counts toward ESCALATE_AFTER.
+func (h *LambdaHandler) flushNotificationBatch(ctx context.Context, batch *notificationBatch) {
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+
+	// Topics with identical combined content can share a request when NTFY_BATCH_TOPICS is set
+	type content struct {
+		title, message string
+		priority       int
+		tags           string
+		click          string
+	}
+	groupByService := !h.Mode.IsPersonalMode && h.Mode.MultiUserConfig.NtfyGroupByService
+	var order []content
+	topicsByContent := make(map[content][]string)
+	alertsByContent := make(map[content]Notification)
+	for _, topic := range batch.topics {
+		alerts := batch.alerts[topic]
+		title, message := combineAlerts(alerts, groupByService)
+		priority, tags := combinePreferences(alerts)
+		c := content{title, message, priority, strings.Join(tags, ","), combinedClick(alerts)}
+		if _, ok := topicsByContent[c]; !ok {
+			order = append(order, c)
+			alert := Notification{Title: title, Message: message, Priority: priority, Tags: tags, Click: c.click}
+			if len(alerts) == 1 {
+				alert.Attachment = alerts[0].Attachment
+			}
+			alertsByContent[c] = alert
+		}
+		topicsByContent[c] = append(topicsByContent[c], topic)
+	}
+
+	delivered := make(map[notifiedSlot]bool, len(batch.undelivered))
+	for slot := range batch.undelivered {
+		delivered[slot] = false
+	}
+	reached := make(map[notifiedSlot]bool)
+	for _, c := range order {
+		topics := topicsByContent[c]
+		errs := h.sendToTopics(ctx, topics, alertsByContent[c])
+		for i, topic := range topics {
+			err := errs[i]
+			alerts := batch.alerts[topic]
+			if err != nil {
+				slog.Error("Failed to deliver batched notification", "topic", topic, "locations", len(alerts), "error", err)
+			}
+			for _, alert := range alerts {
+				h.recordDeliveryResult(ctx, alert.Location, topic, err)
+				if err == nil && alert.OneShot {
+					h.removeOneShot(ctx, alert.Location, topic)
+				}
+				if alert.Slot == (notifiedSlot{}) {
+					continue
+				}
+				if ok, seen := delivered[alert.Slot]; !seen || ok {
+					delivered[alert.Slot] = err == nil
+				}
+				if err == nil && alert.Slot.Escalates {
+					reached[alert.Slot] = true
+				}
+			}
+		}
+	}
+	for slot := range reached {
+		h.countRepeat(ctx, slot.Key)
+	}
+	for slot, ok := range delivered {
+		if ok {
+			h.markNotified(ctx, slot.Key)
+			h.recordAvailability(ctx, slot.ServiceType, slot.Location, true)
+		}
+	}
+}
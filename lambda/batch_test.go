@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingNotifier captures notifications instead of sending them
+type recordingNotifier struct {
+	sent []Notification
+	fail map[string]bool // Topics whose sends fail
+}
+
+func (n *recordingNotifier) Send(ctx context.Context, notification Notification) error {
+	if n.fail[notification.Topic] {
+		return errors.New("send failed")
+	}
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func TestCombineAlerts(t *testing.T) {
+	title, message := combineAlerts([]batchedAlert{{Location: "5300", Title: "T", Message: "M"}}, false)
+	assert.Equal(t, "T", title)
+	assert.Equal(t, "M", message)
+
+	title, message = combineAlerts([]batchedAlert{
+		{Location: "5300", Title: "T", Message: "at 5300"},
+		{Location: "5020", Title: "T", Message: "at 5020"},
+	}, false)
+	assert.Equal(t, "T (2 locations)", title)
+	assert.Equal(t, "at 5300\nat 5020", message)
+}
+
+func TestCombineAlerts_GroupByService(t *testing.T) {
+	alerts := []batchedAlert{
+		{Location: "5300", ServiceType: "Global Entry", Title: "Global Entry Appointment Notification", Message: "Global Entry at 5300"},
+		{Location: "5020", ServiceType: "NEXUS", Title: "NEXUS Appointment Notification", Message: "NEXUS at 5020"},
+		{Location: "5140", ServiceType: "Global Entry", Title: "Global Entry Appointment Notification", Message: "Global Entry at 5140"},
+	}
+	title, message := combineAlerts(alerts, true)
+	assert.Equal(t, "Appointment Notification (3 locations)", title)
+	assert.Equal(t, "Global Entry:\nGlobal Entry at 5300\nGlobal Entry at 5140\n\nNEXUS:\nNEXUS at 5020", message)
+
+	_, message = combineAlerts(alerts, false)
+	assert.Equal(t, "Global Entry at 5300\nNEXUS at 5020\nGlobal Entry at 5140", message)
+
+	_, message = combineAlerts([]batchedAlert{alerts[0], alerts[2]}, true)
+	assert.Equal(t, "Global Entry at 5300\nGlobal Entry at 5140", message, "a single service needs no section labels")
+}
+
+func TestFlushNotificationBatch_GroupByService(t *testing.T) {
+	notifier := &recordingNotifier{}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", NtfyGroupByService: true}}, "", nil)
+	handler.Notifier = notifier
+
+	batch := newNotificationBatch()
+	ctx := withNotificationBatch(context.Background(), batch)
+	_, err := handler.notifyTopics(ctx, "5300", []Subscriber{{Topic: "a"}}, Notification{Title: "T", Message: "at 5300"})
+	assert.NoError(t, err)
+	_, err = handler.notifyTopics(ctx, "5020", []Subscriber{{Topic: "a", ServiceType: "NEXUS"}}, Notification{Title: "T", Message: "at 5020"})
+	assert.NoError(t, err)
+
+	handler.flushNotificationBatch(context.Background(), batch)
+	assert.Equal(t, []Notification{
+		{Topic: "a", Title: "T (2 locations)", Message: "Global Entry:\nat 5300\n\nNEXUS:\nat 5020"},
+	}, notifier.sent)
+}
+
+func TestNotifyTopics_BatchesPerTopic(t *testing.T) {
+	notifier := &recordingNotifier{}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	handler.Notifier = notifier
+
+	batch := newNotificationBatch()
+	ctx := withNotificationBatch(context.Background(), batch)
+	notified, err := handler.notifyTopics(ctx, "5300", []Subscriber{{Topic: "a"}, {Topic: "b"}}, Notification{Title: "T", Message: "at 5300"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, notified)
+	_, err = handler.notifyTopics(ctx, "5020", []Subscriber{{Topic: "a"}}, Notification{Title: "T", Message: "at 5020"})
+	assert.NoError(t, err)
+	assert.Empty(t, notifier.sent, "alerts are queued until the batch is flushed")
+
+	handler.flushNotificationBatch(context.Background(), batch)
+	assert.Equal(t, []Notification{
+		{Topic: "a", Title: "T (2 locations)", Message: "at 5300\nat 5020"},
+		{Topic: "b", Title: "T", Message: "at 5300"},
+	}, notifier.sent)
+}
+
+func TestFlushNotificationBatch_Click(t *testing.T) {
+	notifier := &recordingNotifier{}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	handler.Notifier = notifier
+
+	batch := newNotificationBatch()
+	batch.add("single", batchedAlert{Location: "5300", Title: "T", Message: "at 5300", Click: "https://example.com/5300"})
+	batch.add("several", batchedAlert{Location: "5300", Title: "T", Message: "at 5300", Click: "https://example.com/5300"})
+	batch.add("several", batchedAlert{Location: "5020", Title: "T", Message: "at 5020", Click: "https://example.com/5020"})
+	handler.flushNotificationBatch(context.Background(), batch)
+
+	assert.Len(t, notifier.sent, 2)
+	assert.Equal(t, "https://example.com/5300", notifier.sent[0].Click)
+	assert.Empty(t, notifier.sent[1].Click, "alerts for different locations have no single link")
+}
+
+func TestCombinePreferences(t *testing.T) {
+	priority, tags := combinePreferences([]batchedAlert{
+		{Priority: 3, Tags: []string{"star"}},
+		{Priority: 5, Tags: []string{"star", "rotating_light"}},
+		{},
+	})
+	assert.Equal(t, 5, priority)
+	assert.Equal(t, []string{"star", "rotating_light"}, tags)
+}
+
+func TestCombineAlerts_Localized(t *testing.T) {
+	title, _ := combineAlerts([]batchedAlert{
+		{Location: "5300", Title: "A", Message: "at 5300", Locale: "es"},
+		{Location: "5020", Title: "B", Message: "at 5020", Locale: "es"},
+	}, false)
+	assert.Equal(t, "Notificación de cita (2 ubicaciones)", title)
+}
+
+func TestFlushNotificationBatch_MarksSlotsOnceDelivered(t *testing.T) {
+	notifier := &recordingNotifier{fail: map[string]bool{"failing": true}}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", SharedConfig: SharedConfig{DedupTTLSeconds: 600}}}, "", nil)
+	handler.Notifier = notifier
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T10:00","active":true}]`}}}
+
+	batch := newNotificationBatch()
+	ctx := withNotificationBatch(context.Background(), batch)
+	_, err := handler.checkSingleMinimum(ctx, "Global Entry", "5300", []Subscriber{{Topic: "a"}}, 1)
+	assert.NoError(t, err)
+	_, err = handler.checkSingleMinimum(ctx, "Global Entry", "5020", []Subscriber{{Topic: "a"}, {Topic: "failing"}}, 1)
+	assert.NoError(t, err)
+	delivered := dedupKey("Global Entry", "5300", "2099-05-04T10:00")
+	partial := dedupKey("Global Entry", "5020", "2099-05-04T10:00")
+	assert.False(t, handler.alreadyNotified(ctx, delivered), "queued alerts aren't sent yet")
+
+	handler.flushNotificationBatch(context.Background(), batch)
+	assert.True(t, handler.alreadyNotified(ctx, delivered))
+	assert.False(t, handler.alreadyNotified(ctx, partial), "a topic that didn't get the alert hears about the slot next run")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Placeholders accepted by BOOKING_URL_TEMPLATE
+const (
+	bookingLocationPlaceholder = "{locationId}"
+	bookingServicePlaceholder  = "{serviceName}"
+)
+
+// validateBookingURLTemplate checks that a BOOKING_URL_TEMPLATE, when set, is an http(s) URL
+// once its placeholders are filled in
+func validateBookingURLTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	u, err := url.Parse(bookingURL(template, "Global Entry", "5300"))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("must be an http(s) URL, got %q", template)
+	}
+	return nil
+}
+
+// bookingURL fills the location ID and service name into template, escaped for a query string
+func bookingURL(template, serviceType, location string) string {
+	return strings.NewReplacer(
+		bookingLocationPlaceholder, url.QueryEscape(location),
+		bookingServicePlaceholder, url.QueryEscape(serviceType),
+	).Replace(template)
+}
+
+// withBookingLink points the alert at BOOKING_URL_TEMPLATE for the slot's location, as the
+// ntfy click action and a line in the message. Alerts are unchanged when no template is set.
+func (h *LambdaHandler) withBookingLink(alert Notification, serviceType, location, locale string) Notification {
+	template := h.Mode.shared().BookingURLTemplate
+	if template == "" || location == "" {
+		return alert
+	}
+	alert.Click = bookingURL(template, serviceType, location)
+	alert.Message += "\n" + fmt.Sprintf(messagesFor(locale).BookingLink, alert.Click)
+	return alert
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookingURL(t *testing.T) {
+	template := "https://ttp.cbp.dhs.gov/schedulerui/schedule-interview/location?locationId={locationId}&serviceName={serviceName}"
+	assert.Equal(t, "https://ttp.cbp.dhs.gov/schedulerui/schedule-interview/location?locationId=5300&serviceName=Global+Entry", bookingURL(template, "Global Entry", "5300"))
+	assert.Equal(t, "https://example.com/book", bookingURL("https://example.com/book", "NEXUS", "5020"), "placeholders are optional")
+}
+
+func TestValidateBookingURLTemplate(t *testing.T) {
+	assert.NoError(t, validateBookingURLTemplate(""))
+	assert.NoError(t, validateBookingURLTemplate("https://example.com/book?location={locationId}"))
+	assert.Error(t, validateBookingURLTemplate("example.com/book"))
+	assert.Error(t, validateBookingURLTemplate("ftp://example.com/{locationId}"))
+}
+
+func TestWithBookingLink(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	alert := Notification{Title: "T", Message: "Slot open"}
+	assert.Equal(t, alert, handler.withBookingLink(alert, "NEXUS", "5020", "en"), "no template leaves alerts unchanged")
+
+	handler.Mode.MultiUserConfig.BookingURLTemplate = "https://example.com/book?location={locationId}&service={serviceName}"
+	linked := handler.withBookingLink(alert, "NEXUS", "5020", "es")
+	assert.Equal(t, "https://example.com/book?location=5020&service=NEXUS", linked.Click)
+	assert.Equal(t, "Slot open\nReserva ahora: https://example.com/book?location=5020&service=NEXUS", linked.Message)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// circuitBreaker opens after consecutive failures and stays open for a cooldown period
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// newCircuitBreaker creates a circuitBreaker; a threshold of zero disables it
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// retryAfter returns how long the breaker remains open, or zero if requests may proceed
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return 0
+	}
+	if remaining := b.openUntil.Sub(b.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// recordSuccess closes the breaker and resets the failure count
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// recordFailure counts a failure and opens the breaker once the threshold is reached
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+		b.failures = 0
+	}
+}
+
+// retryAfterSeconds rounds a duration up to whole seconds for the Retry-After header, with a minimum of one
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
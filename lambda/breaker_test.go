@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker(2, 30*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	// Closed until the threshold is reached
+	breaker.recordFailure()
+	assert.Equal(t, time.Duration(0), breaker.retryAfter())
+	breaker.recordFailure()
+	assert.Equal(t, 30*time.Second, breaker.retryAfter())
+
+	// Closes again after the cooldown
+	now = now.Add(31 * time.Second)
+	assert.Equal(t, time.Duration(0), breaker.retryAfter())
+}
+
+func TestCircuitBreaker_SuccessResets(t *testing.T) {
+	breaker := newCircuitBreaker(2, 30*time.Second)
+
+	breaker.recordFailure()
+	breaker.recordSuccess()
+	breaker.recordFailure()
+	assert.Equal(t, time.Duration(0), breaker.retryAfter())
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	breaker := newCircuitBreaker(0, 30*time.Second)
+
+	for i := 0; i < 10; i++ {
+		breaker.recordFailure()
+	}
+	assert.Equal(t, time.Duration(0), breaker.retryAfter())
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, 1, retryAfterSeconds(0))
+	assert.Equal(t, 1, retryAfterSeconds(200*time.Millisecond))
+	assert.Equal(t, 30, retryAfterSeconds(30*time.Second))
+	assert.Equal(t, 3, retryAfterSeconds(2100*time.Millisecond))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// notificationBudget caps how many distinct topics one run notifies (MAX_NOTIFICATIONS_PER_RUN).
+// A topic admitted once may receive further alerts in the same run, since batching combines them.
+type notificationBudget struct {
+	limit    int
+	admitted map[string]bool
+}
+
+// newNotificationBudget creates a budget admitting up to limit topics
+func newNotificationBudget(limit int) *notificationBudget {
+	return &notificationBudget{limit: limit, admitted: make(map[string]bool)}
+}
+
+// take returns the subscribers the budget still admits, in order, so callers should pass
+// them longest-waiting first
+func (b *notificationBudget) take(subscribers []Subscriber) []Subscriber {
+	admitted := make([]Subscriber, 0, len(subscribers))
+	for _, sub := range subscribers {
+		if !b.admitted[sub.Topic] {
+			if len(b.admitted) >= b.limit {
+				continue
+			}
+			b.admitted[sub.Topic] = true
+		}
+		admitted = append(admitted, sub)
+	}
+	return admitted
+}
+
+// sortByWaitTime orders subscribers oldest subscription first, so a capped run serves
+// the longest-waiting topics before newer ones
+func sortByWaitTime(subscribers []Subscriber) {
+	sort.SliceStable(subscribers, func(i, j int) bool {
+		return subscribers[i].CreatedAt.Before(subscribers[j].CreatedAt)
+	})
+}
+
+// applyBudget trims the batch to the topics budget admits once every location has queued its
+// alerts, so the cap is applied across the whole run oldest subscription first rather than
+// in whichever order the location checks happened to finish. A topic waits as long as its
+// oldest subscription among the queued alerts. Slots a dropped topic was waiting on stay
+// unmarked, so the topic still hears about them on a later run.
+func (b *notificationBatch) applyBudget(budget *notificationBudget) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	candidates := make([]Subscriber, 0, len(b.topics))
+	for _, topic := range b.topics {
+		oldest := b.alerts[topic][0].CreatedAt
+		for _, alert := range b.alerts[topic][1:] {
+			if alert.CreatedAt.Before(oldest) {
+				oldest = alert.CreatedAt
+			}
+		}
+		candidates = append(candidates, Subscriber{Topic: topic, CreatedAt: oldest})
+	}
+	sortByWaitTime(candidates)
+
+	admitted := budget.take(candidates)
+	b.topics = b.topics[:0]
+	for _, sub := range admitted {
+		b.topics = append(b.topics, sub.Topic)
+	}
+	if skipped := len(candidates) - len(admitted); skipped > 0 {
+		for _, sub := range candidates[len(admitted):] {
+			for _, alert := range b.alerts[sub.Topic] {
+				if alert.Slot != (notifiedSlot{}) {
+					b.undelivered[alert.Slot] = true
+				}
+			}
+			delete(b.alerts, sub.Topic)
+		}
+		slog.Warn("Notification cap reached, skipping newer subscribers", "skipped", skipped, "limit", budget.limit)
+	}
+}
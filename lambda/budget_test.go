@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func topicsOf(subscribers []Subscriber) []string {
+	topics := make([]string, len(subscribers))
+	for i, sub := range subscribers {
+		topics[i] = sub.Topic
+	}
+	return topics
+}
+
+func TestNotificationBudgetTake(t *testing.T) {
+	budget := newNotificationBudget(2)
+	assert.Equal(t, []string{"a", "b"}, topicsOf(budget.take([]Subscriber{{Topic: "a"}, {Topic: "b"}, {Topic: "c"}})))
+	// Topics already admitted keep receiving alerts for other locations; new ones are refused
+	assert.Equal(t, []string{"b"}, topicsOf(budget.take([]Subscriber{{Topic: "d"}, {Topic: "b"}})))
+}
+
+func TestSortByWaitTime(t *testing.T) {
+	now := time.Now()
+	subscribers := []Subscriber{
+		{Topic: "new", CreatedAt: now},
+		{Topic: "oldest", CreatedAt: now.Add(-48 * time.Hour)},
+		{Topic: "old", CreatedAt: now.Add(-time.Hour)},
+	}
+	sortByWaitTime(subscribers)
+	assert.Equal(t, []string{"oldest", "old", "new"}, topicsOf(subscribers))
+}
+
+func TestNotificationBatch_BudgetServesOldestFirstAcrossLocations(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	now := time.Now()
+
+	// The location holding the newest subscribers finishes its check first
+	batch := newNotificationBatch()
+	ctx := withNotificationBatch(context.Background(), batch)
+	build := func(locale string) Notification { return Notification{Title: "T", Message: "M"} }
+	_, err := handler.notifyLocalized(ctx, "5300", []Subscriber{
+		{Topic: "new", CreatedAt: now},
+		{Topic: "older", CreatedAt: now.Add(-time.Hour)},
+	}, build)
+	assert.NoError(t, err)
+	_, err = handler.notifyLocalized(ctx, "5140", []Subscriber{
+		{Topic: "newer", CreatedAt: now.Add(-time.Minute)},
+		{Topic: "oldest", CreatedAt: now.Add(-48 * time.Hour)},
+	}, build)
+	assert.NoError(t, err)
+
+	batch.applyBudget(newNotificationBudget(2))
+	handler.flushNotificationBatch(context.Background(), batch)
+	assert.Equal(t, []string{"oldest", "older"}, topicsOfNotifications(notifier.sent))
+}
+
+func TestNotificationBatch_BudgetLeavesDroppedTopicsSlotsUnmarked(t *testing.T) {
+	cfg := &Config{MongoDBPassword: "test", MaxNotificationsPerRun: 1, SharedConfig: SharedConfig{DedupTTLSeconds: 600, NotifyOnTransition: true}}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: cfg}, "", nil)
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T10:00","active":true}]`}}}
+	now := time.Now()
+
+	batch := newNotificationBatch()
+	ctx := withNotificationBatch(context.Background(), batch)
+	assert.NoError(t, handler.checkAvailabilityAndNotifyWithMinimums(ctx, "Global Entry", "5300", []Subscriber{{Topic: "oldest", CreatedAt: now.Add(-time.Hour)}}, []int{1}))
+	assert.NoError(t, handler.checkAvailabilityAndNotifyWithMinimums(ctx, "Global Entry", "5020", []Subscriber{
+		{Topic: "oldest", CreatedAt: now.Add(-time.Hour)},
+		{Topic: "newest", CreatedAt: now},
+	}, []int{1}))
+	assert.False(t, handler.suppressedByTransition(ctx, "Global Entry", "5300"), "availability is saved once the alert is delivered")
+
+	batch.applyBudget(newNotificationBudget(cfg.MaxNotificationsPerRun))
+	handler.flushNotificationBatch(context.Background(), batch)
+	assert.Equal(t, []string{"oldest"}, topicsOfNotifications(notifier.sent))
+	assert.True(t, handler.alreadyNotified(ctx, dedupKey("Global Entry", "5300", "2099-05-04T10:00")))
+	assert.True(t, handler.suppressedByTransition(ctx, "Global Entry", "5300"))
+	assert.False(t, handler.alreadyNotified(ctx, dedupKey("Global Entry", "5020", "2099-05-04T10:00")), "the dropped topic still waits on this slot")
+	assert.False(t, handler.suppressedByTransition(ctx, "Global Entry", "5020"))
+}
+
+func topicsOfNotifications(notifications []Notification) []string {
+	topics := make([]string, len(notifications))
+	for i, n := range notifications {
+		topics[i] = n.Topic
+	}
+	return topics
+}
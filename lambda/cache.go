@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultLocationsCacheTTL is how long a LocationResolver reuses a service's locations unless
+// LOCATIONS_CACHE_TTL says otherwise
+const defaultLocationsCacheTTL = time.Hour
+
+type (
+	// ttlCache is a concurrency-safe map whose entries expire after a per-entry TTL. Package-level
+	// caches live as long as the container, so warm invocations reuse what earlier ones fetched.
+	ttlCache[V any] struct {
+		mu      sync.RWMutex
+		entries map[string]ttlEntry[V]
+		now     func() time.Time
+	}
+
+	ttlEntry[V any] struct {
+		value     V
+		expiresAt time.Time
+	}
+)
+
+// locationCache holds TTP locations per locations URL and service type for every LocationResolver
+var locationCache = newTTLCache[map[string]Location]()
+
+// newTTLCache creates an empty cache
+func newTTLCache[V any]() *ttlCache[V] {
+	return &ttlCache[V]{entries: make(map[string]ttlEntry[V]), now: time.Now}
+}
+
+// get returns the value stored for key if it hasn't expired
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// set stores value for key until ttl passes, dropping expired entries on the way
+func (c *ttlCache[V]) set(key string, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: now.Add(ttl)}
+}
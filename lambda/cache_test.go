@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLCache(t *testing.T) {
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	cache := newTTLCache[int]()
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.get("a")
+	assert.False(t, ok)
+
+	cache.set("a", 1, time.Minute)
+	value, ok := cache.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get("a")
+	assert.False(t, ok, "entries expire after their TTL")
+
+	cache.set("b", 2, time.Minute)
+	assert.Len(t, cache.entries, 1, "expired entries are dropped on set")
+}
+
+func TestLocationResolver_SharedAcrossResolvers(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK", Operational: true}})
+	}))
+	defer server.Close()
+
+	// Concurrent checks in one invocation fetch once
+	resolver := NewLocationResolver(server.Client())
+	resolver.URL = server.URL
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := resolver.Resolve(context.Background(), "NEXUS", "5300")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+
+	// A handler built by a later invocation reuses the cached list
+	next := NewLocationResolver(server.Client())
+	next.URL = server.URL
+	_, ok, err := next.Resolve(context.Background(), "NEXUS", "5300")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestLocationResolver_RefetchesAfterTTL(t *testing.T) {
+	now := time.Now()
+	defer func(restore func() time.Time) { locationCache.now = restore }(locationCache.now)
+	locationCache.now = func() time.Time { return now }
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK", Operational: calls == 1}})
+	}))
+	defer server.Close()
+	resolver := NewLocationResolver(server.Client())
+	resolver.URL = server.URL
+	resolver.TTL = time.Minute
+
+	loc, _, err := resolver.Resolve(context.Background(), "Global Entry", "5300")
+	assert.NoError(t, err)
+	assert.True(t, loc.Operational)
+
+	now = now.Add(time.Minute)
+	loc, _, err = resolver.Resolve(context.Background(), "Global Entry", "5300")
+	assert.NoError(t, err)
+	assert.False(t, loc.Operational, "expired locations are fetched again")
+	assert.Equal(t, 2, calls)
+}
+
+func TestLocationResolver_ZeroTTLDisablesCache(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK"}})
+	}))
+	defer server.Close()
+
+	// LOCATIONS_CACHE_TTL=0 passes validation and means every lookup fetches
+	config := &Config{MongoDBPassword: "test"}
+	config.LocationsCacheTTL = 0
+	assert.Empty(t, config.SharedConfig.validate())
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: config}, "", nil)
+	handler.Locations.URL = server.URL
+	for i := 0; i < 2; i++ {
+		_, ok, err := handler.Locations.Resolve(context.Background(), "Global Entry", "5300")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 2, calls)
+}
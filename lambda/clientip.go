@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// clientIP returns the address of the client behind an API Gateway or function URL request.
+// The request context's sourceIp is set by AWS and can't be forged, so it wins whenever it is a
+// public address. X-Forwarded-For is only consulted when sourceIp is missing or internal (the
+// request came through a private proxy), taking the first public hop since the leftmost entries
+// are the ones nearest the client. Returns "" when neither yields an address.
+func clientIP(req events.APIGatewayV2HTTPRequest) string {
+	source, err := netip.ParseAddr(strings.TrimSpace(req.RequestContext.HTTP.SourceIP))
+	if err == nil && !internalAddr(source) {
+		return source.String()
+	}
+	for name, value := range req.Headers {
+		if !strings.EqualFold(name, "X-Forwarded-For") {
+			continue
+		}
+		for _, hop := range strings.Split(value, ",") {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hop))
+			if err == nil && !internalAddr(addr) {
+				return addr.String()
+			}
+		}
+	}
+	if source.IsValid() {
+		return source.String()
+	}
+	return ""
+}
+
+// internalAddr reports whether addr is private, loopback, link-local or unspecified
+func internalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified()
+}
+
+type clientIPContextKey struct{}
+
+// withClientIP returns a context carrying the request's client IP for audit logging
+func withClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// clientIPFromContext returns the client IP attached to ctx, or "" if none
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey{}).(string)
+	return ip
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	request := func(sourceIP string, headers map[string]string) events.APIGatewayV2HTTPRequest {
+		return events.APIGatewayV2HTTPRequest{
+			Headers: headers,
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{SourceIP: sourceIP},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  events.APIGatewayV2HTTPRequest
+		want string
+	}{
+		{name: "public source wins over forwarded header", req: request("203.0.113.7", map[string]string{"x-forwarded-for": "198.51.100.1"}), want: "203.0.113.7"},
+		{name: "internal source uses first public hop", req: request("10.0.0.5", map[string]string{"x-forwarded-for": "192.168.1.10, 198.51.100.1, 203.0.113.9"}), want: "198.51.100.1"},
+		{name: "header name is case-insensitive", req: request("", map[string]string{"X-Forwarded-For": "198.51.100.1"}), want: "198.51.100.1"},
+		{name: "malformed hops are skipped", req: request("", map[string]string{"x-forwarded-for": "unknown, 2001:db8::1"}), want: "2001:db8::1"},
+		{name: "all internal falls back to source", req: request("10.0.0.5", map[string]string{"x-forwarded-for": "127.0.0.1, 172.16.0.1"}), want: "10.0.0.5"},
+		{name: "nothing usable", req: request("", nil), want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, clientIP(tc.req))
+		})
+	}
+}
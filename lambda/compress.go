@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip
+func acceptsGzip(req events.APIGatewayV2HTTPRequest) bool {
+	for name, value := range req.Headers {
+		if !strings.EqualFold(name, "Accept-Encoding") {
+			continue
+		}
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			coding = strings.TrimSpace(coding)
+			if !strings.EqualFold(coding, "gzip") && coding != "*" {
+				continue
+			}
+			// "gzip;q=0" explicitly refuses it
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compressResponse gzips bodies of at least COMPRESS_MIN_BYTES for clients that accept it.
+// API Gateway passes binary bodies through base64, so the result is marked IsBase64Encoded.
+// Smaller bodies, error responses and a zero threshold are returned unchanged.
+func (h *LambdaHandler) compressResponse(req events.APIGatewayV2HTTPRequest, resp events.APIGatewayV2HTTPResponse) events.APIGatewayV2HTTPResponse {
+	minBytes := h.Mode.MultiUserConfig.CompressMinBytes
+	if minBytes <= 0 || resp.StatusCode != 200 || resp.IsBase64Encoded || len(resp.Body) < minBytes || !acceptsGzip(req) {
+		return resp
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(resp.Body)); err != nil {
+		return resp
+	}
+	if err := zw.Close(); err != nil {
+		return resp
+	}
+	headers := make(map[string]string, len(resp.Headers)+2)
+	for k, v := range resp.Headers {
+		headers[k] = v
+	}
+	headers["Content-Encoding"] = "gzip"
+	headers["Vary"] = "Accept-Encoding"
+	resp.Headers = headers
+	resp.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+	resp.IsBase64Encoded = true
+	return resp
+}
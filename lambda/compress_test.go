@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for value, want := range map[string]bool{
+		"gzip":              true,
+		"br, GZIP;q=0.8":    true,
+		"*":                 true,
+		"deflate":           false,
+		"gzip;q=0, deflate": false,
+		"":                  false,
+	} {
+		req := events.APIGatewayV2HTTPRequest{Headers: map[string]string{"accept-encoding": value}}
+		assert.Equal(t, want, acceptsGzip(req), value)
+	}
+}
+
+func TestCompressResponse_RoundTrip(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", CompressMinBytes: 100}}, "", nil)
+	req := events.APIGatewayV2HTTPRequest{Headers: map[string]string{"Accept-Encoding": "gzip, deflate"}}
+	body := `{"subscriptions":[` + strings.Repeat(`{"location":"5300","ntfyTopic":"topic"},`, 20) + `{}]}`
+
+	resp := handler.compressResponse(req, events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: corsHeaders, Body: body})
+	assert.True(t, resp.IsBase64Encoded)
+	assert.Equal(t, "gzip", resp.Headers["Content-Encoding"])
+	assert.Equal(t, corsHeaders["Access-Control-Allow-Origin"], resp.Headers["Access-Control-Allow-Origin"], "CORS headers are kept")
+	assert.NotContains(t, corsHeaders, "Content-Encoding", "shared headers are not modified")
+
+	compressed, err := base64.StdEncoding.DecodeString(resp.Body)
+	assert.NoError(t, err)
+	assert.Less(t, len(compressed), len(body))
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Small bodies, clients without gzip and a zero threshold are left alone
+	small := events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: `{"subscriptions":[]}`}
+	assert.Equal(t, small, handler.compressResponse(req, small))
+	large := events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: body}
+	assert.Equal(t, large, handler.compressResponse(events.APIGatewayV2HTTPRequest{}, large))
+	handler.Mode.MultiUserConfig.CompressMinBytes = 0
+	assert.Equal(t, large, handler.compressResponse(req, large))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// redactedConfigValue replaces secrets in the startup configuration summary
+const redactedConfigValue = "[redacted]"
+
+// secretConfigVars are never logged. Ntfy topics are included because anyone who knows a
+// topic can read its alerts.
+var secretConfigVars = map[string]bool{
+	"MONGODB_PASSWORD": true,
+	"WEBHOOK_SECRET":   true,
+	"ADMIN_API_TOKEN":  true,
+	"NTFY_TOPIC":       true,
+	"ADMIN_NTFY_TOPIC": true,
+}
+
+// logEffectiveConfig logs the configuration the function will run with as one entry keyed by
+// environment variable, so operators can compare it with what they meant to deploy
+func logEffectiveConfig(mode *AppMode) {
+	var attrs []slog.Attr
+	if mode.IsPersonalMode {
+		attrs = append(attrs, slog.String("mode", "personal"))
+		attrs = append(attrs, configAttrs(reflect.ValueOf(mode.PersonalConfig).Elem())...)
+	} else {
+		attrs = append(attrs, slog.String("mode", "multi-user"))
+		attrs = append(attrs, configAttrs(reflect.ValueOf(mode.MultiUserConfig).Elem())...)
+	}
+	notifiers := []string{"ntfy"}
+	if mode.shared().WebhookURL != "" {
+		notifiers = append(notifiers, "webhook")
+	}
+	if mode.shared().SNSTopicARN != "" {
+		notifiers = append(notifiers, "sns")
+	}
+	attrs = append(attrs, slog.Any("notifiers", notifiers))
+	slog.LogAttrs(context.Background(), slog.LevelInfo, "Effective configuration", attrs...)
+}
+
+// configAttrs returns one attribute per envconfig field of the config struct v, including the
+// fields of embedded structs such as SharedConfig
+func configAttrs(v reflect.Value) []slog.Attr {
+	var attrs []slog.Attr
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			attrs = append(attrs, configAttrs(v.Field(i))...)
+			continue
+		}
+		name := field.Tag.Get("envconfig")
+		if name == "" {
+			continue
+		}
+		attrs = append(attrs, slog.Any(name, configValue(name, v.Field(i))))
+	}
+	return attrs
+}
+
+// configValue returns a loggable form of one setting. Set secrets are replaced and URLs are
+// reduced to scheme and host, since webhook paths and queries often embed tokens.
+func configValue(name string, v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	if v.Kind() != reflect.String {
+		return v.Interface()
+	}
+	value := v.String()
+	if value == "" {
+		return value
+	}
+	if secretConfigVars[name] {
+		return redactedConfigValue
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Scheme + "://" + u.Hostname()
+	}
+	return value
+}
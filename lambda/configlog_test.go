@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogEffectiveConfig(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	logEffectiveConfig(&AppMode{MultiUserConfig: &Config{
+		SharedConfig: SharedConfig{
+			WebhookURL:     "https://hooks.example.com/services/T000/B000/secret?token=abc",
+			WebhookSecret:  "hmac-secret",
+			MinLeadTime:    24 * time.Hour,
+			LocationFilter: "!inviteOnly",
+		},
+		MongoDBPassword:     "hunter2",
+		AdminAPIToken:       "admin-token",
+		MaxDeliveryFailures: 10,
+	}})
+
+	output := buf.String()
+	for _, secret := range []string{"hunter2", "admin-token", "hmac-secret", "T000", "token=abc"} {
+		assert.NotContains(t, output, secret)
+	}
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "Effective configuration", entry["msg"])
+	assert.Equal(t, "multi-user", entry["mode"])
+	assert.Equal(t, []any{"ntfy", "webhook"}, entry["notifiers"])
+	assert.Equal(t, "[redacted]", entry["MONGODB_PASSWORD"])
+	assert.Equal(t, "https://hooks.example.com", entry["WEBHOOK_URL"])
+	assert.Equal(t, "24h0m0s", entry["MIN_LEAD_TIME"])
+	assert.Equal(t, "!inviteOnly", entry["LOCATION_FILTER"])
+	assert.Equal(t, float64(10), entry["MAX_DELIVERY_FAILURES"])
+	assert.Equal(t, "", entry["ADMIN_NTFY_TOPIC"], "unset secrets stay empty")
+}
+
+func TestLogEffectiveConfig_PersonalMode(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	logEffectiveConfig(&AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{
+		ServiceType: "NEXUS",
+		LocationID:  "5020",
+		NtfyTopic:   "my-private-topic",
+		NtfyServer:  "https://ntfy.sh",
+	}})
+
+	assert.NotContains(t, buf.String(), "my-private-topic")
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "personal", entry["mode"])
+	assert.Equal(t, "NEXUS", entry["SERVICE_TYPE"])
+	assert.Equal(t, "5020", entry["LOCATION_ID"])
+	assert.Equal(t, "[redacted]", entry["NTFY_TOPIC"])
+	assert.Equal(t, []any{"ntfy"}, entry["notifiers"])
+}
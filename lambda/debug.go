@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Decisions reported per slot and per check in DEBUG_RESPONSE output
+const (
+	slotKept          = "kept"
+	slotInactive      = "inactive"
+	slotStarted       = "already started"
+	slotInsideLead    = "inside MIN_LEAD_TIME"
+	checkNoSlots      = "no slots"
+	checkFiltered     = "excluded by LOCATION_FILTER"
+	checkTransition   = "unchanged since last check"
+	checkDeduplicated = "already notified"
+	checkEscalation   = "held by escalation"
+	checkNotified     = "notified"
+	checkFailed       = "failed"
+)
+
+type (
+	// evaluatedSlot is one slot TTP returned and what the filters did with it
+	evaluatedSlot struct {
+		StartTimestamp string `json:"startTimestamp"`
+		Active         bool   `json:"active"`
+		Decision       string `json:"decision"`
+	}
+
+	// debugCheck is one service, location and minimum checked during the invocation
+	debugCheck struct {
+		Service  string          `json:"service"`
+		Location string          `json:"location,omitempty"`
+		Minimum  int             `json:"minimum,omitempty"`
+		Decision string          `json:"decision"`
+		Notified int             `json:"notified,omitempty"`
+		Slots    []evaluatedSlot `json:"slots,omitempty"`
+		Error    string          `json:"error,omitempty"`
+	}
+
+	// debugTrace collects the checks of one invocation for DEBUG_RESPONSE. Multi-user passes
+	// check locations concurrently, so it is safe for concurrent use.
+	debugTrace struct {
+		mu     sync.Mutex
+		checks []debugCheck
+	}
+
+	debugTraceContextKey struct{}
+)
+
+// withDebugTrace returns a context whose checks are recorded in trace
+func withDebugTrace(ctx context.Context, trace *debugTrace) context.Context {
+	return context.WithValue(ctx, debugTraceContextKey{}, trace)
+}
+
+// debugTraceFromContext returns the trace attached to ctx, if any
+func debugTraceFromContext(ctx context.Context) *debugTrace {
+	trace, _ := ctx.Value(debugTraceContextKey{}).(*debugTrace)
+	return trace
+}
+
+// record adds a check. It does nothing on a nil trace, so callers needn't check DEBUG_RESPONSE.
+func (t *debugTrace) record(check debugCheck) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checks = append(t.checks, check)
+}
+
+// recordResult adds the outcome of one checkSingleMinimum call
+func (t *debugTrace) recordResult(serviceType, location string, minimum int, result AvailabilityResult, err error) {
+	check := debugCheck{Service: serviceType, Location: location, Minimum: minimum, Decision: result.Decision, Notified: result.Notified, Slots: result.Evaluated}
+	if err != nil {
+		check.Decision, check.Error = checkFailed, err.Error()
+	}
+	t.record(check)
+}
+
+// evaluateSlots labels every parsed slot with the first filter that dropped it. active,
+// upcoming and kept are the slots left after each filter in checkSingleMinimum, in that order.
+func evaluateSlots(parsed, active, upcoming, kept []Appointment) []evaluatedSlot {
+	in := func(slots []Appointment) map[string]bool {
+		set := make(map[string]bool, len(slots))
+		for _, appt := range slots {
+			set[appt.StartTimestamp] = true
+		}
+		return set
+	}
+	isActive, isUpcoming, isKept := in(active), in(upcoming), in(kept)
+	evaluated := make([]evaluatedSlot, len(parsed))
+	for i, appt := range parsed {
+		decision := slotKept
+		switch {
+		case !isActive[appt.StartTimestamp]:
+			decision = slotInactive
+		case !isUpcoming[appt.StartTimestamp]:
+			decision = slotStarted
+		case !isKept[appt.StartTimestamp]:
+			decision = slotInsideLead
+		}
+		evaluated[i] = evaluatedSlot{StartTimestamp: appt.StartTimestamp, Active: appt.Active, Decision: decision}
+	}
+	return evaluated
+}
+
+// withDebugOutput adds the trace to a JSON response body under "debug". Responses are returned
+// unchanged when DEBUG_RESPONSE is off or the body isn't a JSON object.
+func withDebugOutput(resp events.APIGatewayV2HTTPResponse, trace *debugTrace) events.APIGatewayV2HTTPResponse {
+	if trace == nil {
+		return resp
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+		return resp
+	}
+	trace.mu.Lock()
+	body["debug"] = append([]debugCheck{}, trace.checks...)
+	trace.mu.Unlock()
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return resp
+	}
+	resp.Body = string(encoded)
+	return resp
+}
+
+// withDebugResponse runs check and, with DEBUG_RESPONSE set, adds the checks it made to its response
+func (h *LambdaHandler) withDebugResponse(ctx context.Context, check func(context.Context) (events.APIGatewayV2HTTPResponse, error)) (events.APIGatewayV2HTTPResponse, error) {
+	if !h.Mode.shared().DebugResponse {
+		return check(ctx)
+	}
+	trace := &debugTrace{}
+	resp, err := check(withDebugTrace(ctx, trace))
+	return withDebugOutput(resp, trace), err
+}
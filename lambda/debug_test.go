@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleRequest_DebugResponse(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Notifier = &recordingNotifier{}
+	past := time.Now().Add(-48 * time.Hour).Format(ttpTimestampLayout)
+	body := `[{"startTimestamp":"2099-05-04T09:00","active":false},` +
+		`{"startTimestamp":"` + past + `","active":true},` +
+		`{"startTimestamp":"2099-05-04T10:00","active":true}]`
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: body}}}
+	resp, err := handler.HandleRequest(context.Background(), eventJSON)
+	assert.NoError(t, err)
+	assert.NotContains(t, resp.Body, "debug")
+
+	handler.Mode.PersonalConfig.DebugResponse = true
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: body}}}
+	resp, err = handler.HandleRequest(context.Background(), eventJSON)
+	assert.NoError(t, err)
+	var got struct {
+		Message string       `json:"message"`
+		Debug   []debugCheck `json:"debug"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &got))
+	assert.Equal(t, "personal mode check completed", got.Message)
+	assert.Equal(t, []debugCheck{{
+		Service:  "Global Entry",
+		Location: "5300",
+		Minimum:  1,
+		Decision: checkNotified,
+		Notified: 1,
+		Slots: []evaluatedSlot{
+			{StartTimestamp: "2099-05-04T09:00", Active: false, Decision: slotInactive},
+			{StartTimestamp: past, Active: true, Decision: slotStarted},
+			{StartTimestamp: "2099-05-04T10:00", Active: true, Decision: slotKept},
+		},
+	}}, got.Debug)
+}
+
+func TestEvaluateSlots_LeadTime(t *testing.T) {
+	soon := Appointment{StartTimestamp: "2099-05-04T09:00", Active: true}
+	later := Appointment{StartTimestamp: "2099-05-10T09:00", Active: true}
+	parsed := []Appointment{soon, later}
+	assert.Equal(t, []evaluatedSlot{
+		{StartTimestamp: soon.StartTimestamp, Active: true, Decision: slotInsideLead},
+		{StartTimestamp: later.StartTimestamp, Active: true, Decision: slotKept},
+	}, evaluateSlots(parsed, parsed, parsed, []Appointment{later}))
+}
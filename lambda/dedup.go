@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type (
+	// DedupStore remembers which notifications were already sent so repeats can be suppressed
+	DedupStore interface {
+		Seen(ctx context.Context, key string) (bool, error)
+		Mark(ctx context.Context, key string, ttl time.Duration) error
+	}
+
+	// memoryDedupStore keeps keys for the lifetime of a warm Lambda container
+	memoryDedupStore struct {
+		mu      sync.Mutex
+		expires map[string]time.Time
+		counts  map[string]int // Repeat counts for RepeatCounter
+		now     func() time.Time
+	}
+
+	// mongoDedupStore keeps keys in a MongoDB collection with an expiresAt field
+	mongoDedupStore struct {
+		coll *mongo.Collection
+		now  func() time.Time
+	}
+
+	// dynamoDBAPI is the subset of the DynamoDB client used by dynamoDedupStore
+	dynamoDBAPI interface {
+		GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+		PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	}
+
+	// dynamoDedupStore keeps keys in a DynamoDB table whose TTL attribute is expiresAt
+	dynamoDedupStore struct {
+		client dynamoDBAPI
+		table  string
+		now    func() time.Time
+	}
+)
+
+// newMemoryDedupStore creates an in-memory DedupStore
+func newMemoryDedupStore() *memoryDedupStore {
+	return &memoryDedupStore{expires: make(map[string]time.Time), counts: make(map[string]int), now: time.Now}
+}
+
+// Seen reports whether key was marked and has not expired
+func (s *memoryDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.expires[key]
+	if ok && !s.now().Before(expiresAt) {
+		delete(s.expires, key)
+		return false, nil
+	}
+	return ok, nil
+}
+
+// Mark records key until ttl elapses
+func (s *memoryDedupStore) Mark(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expires[key] = s.now().Add(ttl)
+	return nil
+}
+
+// newMongoDedupStore creates a DedupStore backed by the given collection
+func newMongoDedupStore(coll *mongo.Collection) *mongoDedupStore {
+	return &mongoDedupStore{coll: coll, now: time.Now}
+}
+
+// ensureTTLIndex creates the TTL index that removes keys at their expiresAt time, so the
+// collection doesn't grow by every slot ever notified. Creating an existing identical index
+// is a no-op, so this is safe on every cold start.
+func (s *mongoDedupStore) ensureTTLIndex(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := s.coll.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create dedup TTL index: %v", err)
+	}
+	return nil
+}
+
+// Seen reports whether key was marked and has not expired
+func (s *mongoDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	err := s.coll.FindOne(ctx, bson.M{"_id": key, "expiresAt": bson.M{"$gt": s.now().UTC()}}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check dedup key %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// Mark records key until ttl elapses
+func (s *mongoDedupStore) Mark(ctx context.Context, key string, ttl time.Duration) error {
+	update := bson.M{"$set": bson.M{"expiresAt": s.now().UTC().Add(ttl)}}
+	if _, err := s.coll.UpdateOne(ctx, bson.M{"_id": key}, update, options.UpdateOne().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to mark dedup key %s: %v", key, err)
+	}
+	return nil
+}
+
+// newDynamoDedupStore creates a DedupStore backed by a DynamoDB table keyed by "key"
+func newDynamoDedupStore(client dynamoDBAPI, table string) *dynamoDedupStore {
+	return &dynamoDedupStore{client: client, table: table, now: time.Now}
+}
+
+// Seen reports whether key was marked and has not expired. DynamoDB TTL deletes lazily,
+// so expiresAt is checked here as well.
+func (s *dynamoDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check dedup key %s: %v", key, err)
+	}
+	attr, ok := out.Item["expiresAt"].(*types.AttributeValueMemberN)
+	if !ok {
+		return false, nil
+	}
+	expiresAt, err := strconv.ParseInt(attr.Value, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid expiresAt for dedup key %s: %v", key, err)
+	}
+	return s.now().Unix() < expiresAt, nil
+}
+
+// Mark records key until ttl elapses
+func (s *dynamoDedupStore) Mark(ctx context.Context, key string, ttl time.Duration) error {
+	expiresAt := strconv.FormatInt(s.now().Add(ttl).Unix(), 10)
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"key":       &types.AttributeValueMemberS{Value: key},
+			"expiresAt": &types.AttributeValueMemberN{Value: expiresAt},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark dedup key %s: %v", key, err)
+	}
+	return nil
+}
+
+// dedupKey identifies a notification for a service, location and slot
+func dedupKey(serviceType, location, slot string) string {
+	return serviceType + "|" + location + "|" + slot
+}
+
+// alreadyNotified reports whether the notification identified by key was sent within DEDUP_TTL_SECONDS.
+// Store errors are logged and treated as unseen so a dedup outage never hides slots.
+func (h *LambdaHandler) alreadyNotified(ctx context.Context, key string) bool {
+	if h.Mode.shared().dedupTTL() <= 0 || isImmediateCheck(ctx) {
+		return false
+	}
+	seen, err := h.Dedup.Seen(ctx, key)
+	if err != nil {
+		slog.Warn("Failed to check notification dedup store", "key", key, "error", err)
+		return false
+	}
+	return seen
+}
+
+// markNotified records that the notification identified by key was sent
+func (h *LambdaHandler) markNotified(ctx context.Context, key string) {
+	ttl := h.Mode.shared().dedupTTL()
+	if ttl <= 0 || isImmediateCheck(ctx) {
+		return
+	}
+	if err := h.Dedup.Mark(ctx, key, ttl); err != nil {
+		slog.Warn("Failed to update notification dedup store", "key", key, "error", err)
+	}
+}
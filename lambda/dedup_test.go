@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDynamoDB stores items in memory keyed by the "key" attribute
+type fakeDynamoDB struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+func (f *fakeDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	key := params.Key["key"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: f.items[key]}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	key := params.Item["key"].(*types.AttributeValueMemberS).Value
+	f.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	store := newMemoryDedupStore()
+	store.now = func() time.Time { return now }
+
+	seen, err := store.Seen(ctx, "k")
+	assert.NoError(t, err)
+	assert.False(t, seen)
+
+	assert.NoError(t, store.Mark(ctx, "k", time.Minute))
+	seen, _ = store.Seen(ctx, "k")
+	assert.True(t, seen)
+
+	// Expires after the TTL
+	now = now.Add(time.Minute)
+	seen, _ = store.Seen(ctx, "k")
+	assert.False(t, seen)
+}
+
+func TestDynamoDedupStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	store := newDynamoDedupStore(&fakeDynamoDB{items: map[string]map[string]types.AttributeValue{}}, "dedup")
+	store.now = func() time.Time { return now }
+
+	seen, err := store.Seen(ctx, "k")
+	assert.NoError(t, err)
+	assert.False(t, seen)
+
+	assert.NoError(t, store.Mark(ctx, "k", time.Minute))
+	seen, _ = store.Seen(ctx, "k")
+	assert.True(t, seen)
+
+	// Expired items are ignored until DynamoDB TTL removes them
+	now = now.Add(time.Minute)
+	seen, _ = store.Seen(ctx, "k")
+	assert.False(t, seen)
+}
+
+func TestMongoDedupStore(t *testing.T) {
+	_, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	store := newMongoDedupStore(coll.Database().Collection("notification_dedup"))
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	assert.NoError(t, store.ensureTTLIndex(ctx))
+	assert.NoError(t, store.ensureTTLIndex(ctx), "safe to repeat on every cold start")
+
+	// Keys are removed by MongoDB at their expiresAt time
+	specs, err := store.coll.Indexes().ListSpecifications(ctx)
+	assert.NoError(t, err)
+	var ttl *int32
+	for _, spec := range specs {
+		if spec.Name == "expiresAt_1" {
+			ttl = spec.ExpireAfterSeconds
+		}
+	}
+	if assert.NotNil(t, ttl) {
+		assert.Equal(t, int32(0), *ttl)
+	}
+
+	seen, err := store.Seen(ctx, "k")
+	assert.NoError(t, err)
+	assert.False(t, seen)
+	assert.NoError(t, store.Mark(ctx, "k", time.Minute))
+	seen, _ = store.Seen(ctx, "k")
+	assert.True(t, seen)
+	now = now.Add(time.Minute)
+	seen, _ = store.Seen(ctx, "k")
+	assert.False(t, seen)
+}
+
+func TestPersonalMode_DedupSuppressesRepeatedSlot(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	slot := "2099-05-04T10:00"
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{{LocationID: 5300, StartTimestamp: slot, Active: true}})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	ntfyCalls := 0
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ntfyCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.Mode.PersonalConfig.DedupTTLSeconds = 3600
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+
+	// The same slot is only notified once
+	handler.HandleRequest(ctx, eventJSON)
+	handler.HandleRequest(ctx, eventJSON)
+	assert.Equal(t, 1, ntfyCalls)
+
+	// A different slot is notified
+	slot = "2099-05-05T09:00"
+	handler.HandleRequest(ctx, eventJSON)
+	assert.Equal(t, 2, ntfyCalls)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// maxBufferedDeliveries caps the in-memory dead-letter buffer; the oldest events are dropped first
+const maxBufferedDeliveries = 100
+
+type (
+	// FailedDelivery is a webhook event that exhausted its retries
+	FailedDelivery struct {
+		Event    AppointmentEvent `json:"event"`
+		Error    string           `json:"error"`
+		Attempts int              `json:"attempts"`
+		FailedAt time.Time        `json:"failedAt"`
+	}
+
+	// DeliveryStore records webhook events that could not be delivered so they can be replayed
+	DeliveryStore interface {
+		Save(ctx context.Context, delivery FailedDelivery) error
+	}
+
+	// DeliveryReplayer is implemented by stores the handler replays itself. Stores without it,
+	// such as SQS, are replayed by whatever consumes them.
+	DeliveryReplayer interface {
+		Drain(ctx context.Context) ([]FailedDelivery, error)
+	}
+
+	// memoryDeliveryStore buffers failed deliveries for the lifetime of a warm Lambda container
+	memoryDeliveryStore struct {
+		mu      sync.Mutex
+		pending []FailedDelivery
+	}
+
+	// sqsAPI is the subset of the SQS client used by sqsDeliveryStore
+	sqsAPI interface {
+		SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	}
+
+	// sqsDeliveryStore sends failed deliveries to an SQS dead-letter queue as JSON messages
+	sqsDeliveryStore struct {
+		client   sqsAPI
+		queueURL string
+	}
+)
+
+// newMemoryDeliveryStore creates an in-memory DeliveryStore
+func newMemoryDeliveryStore() *memoryDeliveryStore {
+	return &memoryDeliveryStore{}
+}
+
+// Save buffers the delivery, dropping the oldest one when the buffer is full
+func (s *memoryDeliveryStore) Save(ctx context.Context, delivery FailedDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) >= maxBufferedDeliveries {
+		s.pending = s.pending[1:]
+	}
+	s.pending = append(s.pending, delivery)
+	return nil
+}
+
+// Drain returns and clears the buffered deliveries
+func (s *memoryDeliveryStore) Drain(ctx context.Context) ([]FailedDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending
+	s.pending = nil
+	return pending, nil
+}
+
+// newSQSDeliveryStore creates a DeliveryStore backed by the SQS queue at queueURL
+func newSQSDeliveryStore(client sqsAPI, queueURL string) *sqsDeliveryStore {
+	return &sqsDeliveryStore{client: client, queueURL: queueURL}
+}
+
+// Save sends the delivery to the queue
+func (s *sqsDeliveryStore) Save(ctx context.Context, delivery FailedDelivery) error {
+	body, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal failed delivery: %v", err)
+	}
+	_, err = s.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send to dead-letter queue: %v", err)
+	}
+	return nil
+}
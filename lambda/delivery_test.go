@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQS records sent messages and optionally fails
+type fakeSQS struct {
+	inputs []*sqs.SendMessageInput
+	err    error
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &sqs.SendMessageOutput{}, f.err
+}
+
+func TestMemoryDeliveryStore_BoundedBuffer(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryDeliveryStore()
+	for i := 0; i < maxBufferedDeliveries+5; i++ {
+		assert.NoError(t, store.Save(ctx, FailedDelivery{Event: AppointmentEvent{Location: strconv.Itoa(i)}}))
+	}
+
+	pending, err := store.Drain(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, pending, maxBufferedDeliveries)
+	assert.Equal(t, "5", pending[0].Event.Location, "the oldest events are dropped first")
+
+	pending, err = store.Drain(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestSQSDeliveryStore_Save(t *testing.T) {
+	client := &fakeSQS{}
+	store := newSQSDeliveryStore(client, "https://sqs.us-west-2.amazonaws.com/123/webhook-dlq")
+
+	err := store.Save(context.Background(), FailedDelivery{Event: AppointmentEvent{ServiceType: "NEXUS", Location: "5020"}, Error: "boom", Attempts: 3})
+	assert.NoError(t, err)
+	if assert.Len(t, client.inputs, 1) {
+		assert.Equal(t, "https://sqs.us-west-2.amazonaws.com/123/webhook-dlq", *client.inputs[0].QueueUrl)
+		var saved FailedDelivery
+		assert.NoError(t, json.Unmarshal([]byte(*client.inputs[0].MessageBody), &saved))
+		assert.Equal(t, "5020", saved.Event.Location)
+		assert.Equal(t, 3, saved.Attempts)
+	}
+
+	client.err = errors.New("throttled")
+	assert.EqualError(t, store.Save(context.Background(), FailedDelivery{}), "failed to send to dead-letter queue: throttled")
+}
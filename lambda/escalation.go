@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ESCALATION_POLICY values, applied once a slot has been alerted ESCALATE_AFTER times
+const (
+	escalateUrgent  = "urgent"  // Send repeats at priority 5, marked as still available
+	escalateBackoff = "backoff" // Send repeats less often, doubling the gap each time
+)
+
+// escalationPriority is the ntfy priority of escalated repeats
+const escalationPriority = 5
+
+// repeatWindow is how long a slot's repeat count survives without another alert; a slot that
+// reappears after that starts over at normal priority
+const repeatWindow = 24 * time.Hour
+
+// repeatKeyPrefix separates repeat counters from dedup keys sharing the same store
+const repeatKeyPrefix = "repeats|"
+
+// RepeatCounter is implemented by dedup stores that can count how often a key was alerted
+type RepeatCounter interface {
+	Repeats(ctx context.Context, key string) (int, error)
+	Increment(ctx context.Context, key string, ttl time.Duration) (int, error)
+}
+
+// escalationPolicy returns ESCALATION_POLICY, defaulting to urgent
+func (c *SharedConfig) escalationPolicy() string {
+	if c.EscalationPolicy == "" {
+		return escalateUrgent
+	}
+	return c.EscalationPolicy
+}
+
+// escalation decides how a repeat of the same slot is sent
+type escalation struct {
+	Skip   bool // Backoff policy: hold this repeat back
+	Urgent bool // Urgent policy: raise priority and mark the alert as a repeat
+}
+
+// escalationFor returns how the nth alert for a slot is sent under policy after the first
+// `after` alerts. Backoff sends repeats after+1, after+2, after+4, after+8, ... so gaps double.
+func escalationFor(policy string, after, n int) escalation {
+	if after <= 0 || n <= after {
+		return escalation{}
+	}
+	if policy == escalateBackoff {
+		extra := n - after
+		return escalation{Skip: extra&(extra-1) != 0}
+	}
+	return escalation{Urgent: true}
+}
+
+// slotEscalation returns how the next alert for the slot key is sent. The alert is only
+// counted by countRepeat once delivered, but a held-back repeat is counted here so backoff
+// gaps keep growing. Store errors and stores without repeat counting leave alerts unescalated.
+func (h *LambdaHandler) slotEscalation(ctx context.Context, key string) escalation {
+	cfg := h.Mode.shared()
+	if cfg.EscalateAfter <= 0 || isImmediateCheck(ctx) {
+		return escalation{}
+	}
+	counter, ok := h.Dedup.(RepeatCounter)
+	if !ok {
+		return escalation{}
+	}
+	n, err := counter.Repeats(ctx, repeatKeyPrefix+key)
+	if err != nil {
+		slog.Warn("Failed to count repeated alert", "key", key, "error", err)
+		return escalation{}
+	}
+	e := escalationFor(cfg.escalationPolicy(), cfg.EscalateAfter, n+1)
+	if e.Skip {
+		slog.Info("Holding back repeated alert for the same slot", "key", key, "alerts", n+1)
+		h.countRepeat(ctx, key)
+	}
+	return e
+}
+
+// countRepeat records an alert for the slot key toward ESCALATE_AFTER
+func (h *LambdaHandler) countRepeat(ctx context.Context, key string) {
+	if h.Mode.shared().EscalateAfter <= 0 || isImmediateCheck(ctx) {
+		return
+	}
+	counter, ok := h.Dedup.(RepeatCounter)
+	if !ok {
+		return
+	}
+	if _, err := counter.Increment(ctx, repeatKeyPrefix+key, repeatWindow); err != nil {
+		slog.Warn("Failed to count repeated alert", "key", key, "error", err)
+	}
+}
+
+// apply raises priority and marks the message for an urgent escalation
+func (e escalation) apply(alert Notification, locale string) Notification {
+	if e.Urgent {
+		alert.Message = fmt.Sprintf(messagesFor(locale).StillAvailable, alert.Message)
+		alert.Priority = escalationPriority
+	}
+	return alert
+}
+
+// Repeats returns key's count, or zero once its ttl passed
+func (s *memoryDedupStore) Repeats(ctx context.Context, key string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expiresAt, ok := s.expires[key]; !ok || !s.now().Before(expiresAt) {
+		return 0, nil
+	}
+	return s.counts[key], nil
+}
+
+// Increment adds one to key's count, restarting from one once ttl passed since the last increment
+func (s *memoryDedupStore) Increment(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expiresAt, ok := s.expires[key]; !ok || !s.now().Before(expiresAt) {
+		s.counts[key] = 0
+	}
+	s.counts[key]++
+	s.expires[key] = s.now().Add(ttl)
+	return s.counts[key], nil
+}
+
+// Repeats returns key's count, or zero once its ttl passed
+func (s *mongoDedupStore) Repeats(ctx context.Context, key string) (int, error) {
+	var doc struct {
+		Count int `bson:"count"`
+	}
+	err := s.coll.FindOne(ctx, bson.M{"_id": key, "expiresAt": bson.M{"$gt": s.now().UTC()}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count dedup key %s: %v", key, err)
+	}
+	return doc.Count, nil
+}
+
+// Increment adds one to key's count, restarting from one once ttl passed since the last increment
+func (s *mongoDedupStore) Increment(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	now := s.now().UTC()
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"count":     bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$expiresAt", now}}, bson.M{"$add": bson.A{"$count", 1}}, 1}},
+		"expiresAt": now.Add(ttl),
+	}}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var doc struct {
+		Count int `bson:"count"`
+	}
+	if err := s.coll.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&doc); err != nil {
+		return 0, fmt.Errorf("failed to count dedup key %s: %v", key, err)
+	}
+	return doc.Count, nil
+}
+
+// Repeats returns key's count, or zero once its ttl passed
+func (s *dynamoDedupStore) Repeats(ctx context.Context, key string) (int, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count dedup key %s: %v", key, err)
+	}
+	count := 0
+	if expiresAt, ok := out.Item["expiresAt"].(*types.AttributeValueMemberN); ok {
+		if unix, err := strconv.ParseInt(expiresAt.Value, 10, 64); err == nil && s.now().Unix() < unix {
+			if n, ok := out.Item["count"].(*types.AttributeValueMemberN); ok {
+				count, _ = strconv.Atoi(n.Value)
+			}
+		}
+	}
+	return count, nil
+}
+
+// Increment adds one to key's count, restarting from one once ttl passed since the last increment.
+// Personal mode runs one check at a time, so a read followed by a write is enough.
+func (s *dynamoDedupStore) Increment(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	count, err := s.Repeats(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	count++
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"key":       &types.AttributeValueMemberS{Value: key},
+			"count":     &types.AttributeValueMemberN{Value: strconv.Itoa(count)},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(s.now().Add(ttl).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count dedup key %s: %v", key, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscalationFor(t *testing.T) {
+	assert.Equal(t, escalation{}, escalationFor(escalateUrgent, 0, 10), "disabled")
+	assert.Equal(t, escalation{}, escalationFor(escalateUrgent, 2, 2))
+	assert.Equal(t, escalation{Urgent: true}, escalationFor(escalateUrgent, 2, 3))
+
+	var sent []int
+	for n := 1; n <= 12; n++ {
+		if !escalationFor(escalateBackoff, 2, n).Skip {
+			sent = append(sent, n)
+		}
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 6, 10}, sent, "gaps double after the first two alerts")
+}
+
+func TestDedupStores_Increment(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	memory := newMemoryDedupStore()
+	memory.now = func() time.Time { return now }
+	dynamo := newDynamoDedupStore(&fakeDynamoDB{items: map[string]map[string]types.AttributeValue{}}, "dedup")
+	dynamo.now = func() time.Time { return now }
+
+	for name, store := range map[string]RepeatCounter{"memory": memory, "dynamo": dynamo} {
+		now = time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+		for want := 1; want <= 3; want++ {
+			n, err := store.Increment(ctx, "k", time.Hour)
+			assert.NoError(t, err, name)
+			assert.Equal(t, want, n, name)
+			now = now.Add(30 * time.Minute)
+		}
+		n, err := store.Repeats(ctx, "k")
+		assert.NoError(t, err, name)
+		assert.Equal(t, 3, n, name)
+		// Restarts once the window passes without an increment
+		now = now.Add(2 * time.Hour)
+		n, _ = store.Repeats(ctx, "k")
+		assert.Equal(t, 0, n, name)
+		n, _ = store.Increment(ctx, "k", time.Hour)
+		assert.Equal(t, 1, n, name)
+	}
+}
+
+func TestPersonalMode_EscalatesRepeatedSlot(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		policy    string
+		runs      int
+		wantSent  int
+		wantFinal string
+	}{
+		{"urgent", escalateUrgent, 3, 3, "STILL available! "},
+		{"backoff", escalateBackoff, 6, 5, ""}, // Alerts 1, 2, 3, 4 and 6
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, cleanup := setupPersonalTestHandler(t)
+			defer cleanup()
+			handler.Mode.PersonalConfig.EscalateAfter = 2
+			handler.Mode.PersonalConfig.EscalationPolicy = tt.policy
+			handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T10:00","active":true}]`}}}
+			notifier := &recordingNotifier{}
+			handler.Notifier = notifier
+
+			for range tt.runs {
+				_, err := handler.handlePersonalMode(ctx)
+				assert.NoError(t, err)
+			}
+			if assert.Len(t, notifier.sent, tt.wantSent) {
+				assert.Equal(t, 0, notifier.sent[1].Priority, "the first alerts are sent as configured")
+				last := notifier.sent[len(notifier.sent)-1]
+				if tt.wantFinal != "" {
+					assert.True(t, strings.HasPrefix(last.Message, tt.wantFinal), last.Message)
+					assert.Equal(t, escalationPriority, last.Priority)
+				} else {
+					assert.NotContains(t, last.Message, "STILL")
+				}
+			}
+		})
+	}
+}
+
+func TestSlotEscalation_CountsOnlyDeliveredAlerts(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{MongoDBPassword: "test", SharedConfig: SharedConfig{EscalateAfter: 1}}
+	notifier := &recordingNotifier{fail: map[string]bool{"a": true}}
+	for name, batched := range map[string]bool{"unbatched": false, "batched": true} {
+		handler := NewLambdaHandler(&AppMode{MultiUserConfig: cfg}, "", nil)
+		handler.Notifier = notifier
+		handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T10:00","active":true}]`}}}
+		check := func() {
+			checkCtx := ctx
+			batch := newNotificationBatch()
+			if batched {
+				checkCtx = withNotificationBatch(ctx, batch)
+			}
+			handler.checkSingleMinimum(checkCtx, "Global Entry", "5300", []Subscriber{{Topic: "a"}}, 1)
+			handler.flushNotificationBatch(ctx, batch)
+		}
+
+		notifier.fail["a"], notifier.sent = true, nil
+		check()
+		notifier.fail["a"] = false
+		check()
+		check()
+		if assert.Len(t, notifier.sent, 2, name) {
+			assert.Equal(t, 0, notifier.sent[0].Priority, "%s: the failed send isn't a repeat", name)
+			assert.Equal(t, escalationPriority, notifier.sent[1].Priority, name)
+		}
+	}
+}
+
+func TestMongoDedupStore_Increment(t *testing.T) {
+	_, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	store := newMongoDedupStore(coll.Database().Collection("notification_dedup"))
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	for want := 1; want <= 3; want++ {
+		n, err := store.Increment(ctx, "k", time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+	n, err := store.Repeats(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	now = now.Add(2 * time.Hour)
+	n, err = store.Repeats(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n, "expired counts read as zero")
+	n, err = store.Increment(ctx, "k", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n, "restarts after the window")
+}
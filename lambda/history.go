@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GET /history windows. Observations are kept for AVAILABILITY_HISTORY_DAYS, which also caps the window.
+const (
+	defaultHistoryDays          = 7
+	defaultHistoryRetentionDays = 30
+)
+
+type (
+	// AvailabilityObservation records how many active slots one scheduled check of a location found
+	AvailabilityObservation struct {
+		ID          bson.ObjectID `bson:"_id,omitempty"`
+		Timestamp   time.Time     `bson:"timestamp"`
+		ServiceType string        `bson:"serviceType"`
+		Location    string        `bson:"location"`
+		Slots       int           `bson:"slots"`
+		ExpiresAt   time.Time     `bson:"expiresAt"` // Removed by the collection's TTL index
+	}
+
+	// AvailabilityHistory stores availability observations
+	AvailabilityHistory interface {
+		Record(ctx context.Context, observation AvailabilityObservation) error
+	}
+
+	// mongoAvailabilityHistory writes observations to a MongoDB collection with a TTL index on expiresAt
+	mongoAvailabilityHistory struct {
+		coll      *mongo.Collection
+		retention time.Duration
+	}
+
+	// historyEntry is one observation in a GET /history response
+	historyEntry struct {
+		Timestamp   time.Time `json:"timestamp"`
+		ServiceType string    `json:"serviceType"`
+		Slots       int       `json:"slots"`
+	}
+
+	// historyPage is one page of GET /history, newest observations first
+	historyPage struct {
+		Location     string         `json:"location"`
+		Days         int            `json:"days"`
+		Observations []historyEntry `json:"observations"`
+		HasMore      bool           `json:"hasMore"`
+		NextToken    string         `json:"nextToken,omitempty"` // Pass as nextToken to get the following page
+	}
+)
+
+// newMongoAvailabilityHistory creates an AvailabilityHistory that keeps observations for retention
+func newMongoAvailabilityHistory(coll *mongo.Collection, retention time.Duration) *mongoAvailabilityHistory {
+	return &mongoAvailabilityHistory{coll: coll, retention: retention}
+}
+
+// ensureIndexes creates the TTL index that expires observations and the index GET /history
+// reads by. Creating existing identical indexes is a no-op, so this is safe on every cold start.
+func (s *mongoAvailabilityHistory) ensureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "location", Value: 1}, {Key: "_id", Value: -1}}},
+	}
+	if _, err := s.coll.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("failed to create availability history indexes: %v", err)
+	}
+	return nil
+}
+
+// Record inserts the observation, stamping its expiry from the retention period
+func (s *mongoAvailabilityHistory) Record(ctx context.Context, observation AvailabilityObservation) error {
+	observation.ExpiresAt = observation.Timestamp.Add(s.retention)
+	if _, err := s.coll.InsertOne(ctx, observation); err != nil {
+		return fmt.Errorf("failed to write availability observation: %v", err)
+	}
+	return nil
+}
+
+// historyRetentionDays returns how long observations are kept, which also caps the GET /history window
+func (c *Config) historyRetentionDays() int {
+	if c.AvailabilityHistoryDays <= 0 {
+		return defaultHistoryRetentionDays
+	}
+	return c.AvailabilityHistoryDays
+}
+
+// recordObservation stores the result of a scheduled check when availability history is
+// enabled. Checks started by a subscribe request are left out so they don't skew how often
+// slots appear. Failures are only logged.
+func (h *LambdaHandler) recordObservation(ctx context.Context, serviceType, location string, slots int) {
+	if h.History == nil || isImmediateCheck(ctx) {
+		return
+	}
+	observation := AvailabilityObservation{Timestamp: time.Now().UTC(), ServiceType: serviceType, Location: location, Slots: slots}
+	if err := h.History.Record(ctx, observation); err != nil {
+		slog.Warn("Failed to record availability observation", "service", serviceType, "location", location, "error", err)
+	}
+}
+
+// historyCollection returns the collection availability observations are stored in
+func (h *LambdaHandler) historyCollection() *mongo.Collection {
+	return h.Client.Database("global-entry-appointment-db").Collection("availability_history")
+}
+
+// handleHistory returns a location's observations from the last days, newest first, one page at a time
+func (h *LambdaHandler) handleHistory(ctx context.Context, coll *mongo.Collection, query map[string]string) (events.APIGatewayV2HTTPResponse, error) {
+	location := query["location"]
+	if location == "" {
+		return errorResponse(400, "location query parameter is required"), nil
+	}
+	maxDays := h.Mode.MultiUserConfig.historyRetentionDays()
+	days := min(defaultHistoryDays, maxDays)
+	if value := query["days"]; value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxDays {
+			return errorResponse(400, fmt.Sprintf("days must be between 1 and %d, got %q", maxDays, value)), nil
+		}
+		days = n
+	}
+	limit, before, err := parseAdminPage(query)
+	if err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+
+	filter := bson.M{"location": location, "timestamp": bson.M{"$gte": time.Now().UTC().AddDate(0, 0, -days)}}
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit) + 1)
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to list availability history: %v", err)
+	}
+	defer cursor.Close(ctx)
+	var observations []AvailabilityObservation
+	if err := cursor.All(ctx, &observations); err != nil {
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to decode availability history: %v", err)
+	}
+
+	page := historyPage{Location: location, Days: days, Observations: []historyEntry{}}
+	if len(observations) > limit {
+		observations = observations[:limit]
+		page.HasMore = true
+		page.NextToken = observations[limit-1].ID.Hex()
+	}
+	for _, o := range observations {
+		page.Observations = append(page.Observations, historyEntry{Timestamp: o.Timestamp, ServiceType: o.ServiceType, Slots: o.Slots})
+	}
+	body, _ := json.Marshal(page)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    corsHeaders,
+		Body:       string(body),
+	}, nil
+}
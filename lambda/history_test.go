@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// recordingHistory captures availability observations instead of storing them
+type recordingHistory struct {
+	observations []AvailabilityObservation
+}
+
+func (r *recordingHistory) Record(ctx context.Context, observation AvailabilityObservation) error {
+	r.observations = append(r.observations, observation)
+	return nil
+}
+
+func TestRecordObservation_ScheduledChecksOnly(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	history := &recordingHistory{}
+	handler.History = history
+	handler.Notifier = &recordingNotifier{}
+	ctx := context.Background()
+	subscribers := []Subscriber{{Topic: "a"}}
+
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T10:00","active":true},{"startTimestamp":"2099-05-04T10:15","active":true}]`}}}
+	assert.NoError(t, handler.checkAvailabilityAndNotifyWithMinimums(ctx, "Global Entry", "5300", subscribers, []int{1}))
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[]`}}}
+	assert.NoError(t, handler.checkAvailabilityAndNotifyWithMinimums(ctx, "NEXUS", "5020", subscribers, []int{1}))
+	assert.NoError(t, handler.checkAvailabilityAndNotifyWithMinimums(withImmediateCheck(ctx), "NEXUS", "5020", subscribers, []int{1}))
+
+	if assert.Len(t, history.observations, 2, "subscribe checks are not recorded") {
+		assert.Equal(t, "5300", history.observations[0].Location)
+		assert.Equal(t, 2, history.observations[0].Slots)
+		assert.Equal(t, "NEXUS", history.observations[1].ServiceType)
+		assert.Equal(t, 0, history.observations[1].Slots)
+	}
+}
+
+func TestHandleHistory_Validation(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", AvailabilityHistoryDays: 14}}, "", nil)
+	for _, query := range []map[string]string{
+		{},
+		{"location": "5300", "days": "15"},
+		{"location": "5300", "days": "0"},
+		{"location": "5300", "limit": "1000"},
+	} {
+		resp, err := handler.handleHistory(context.Background(), nil, query)
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode, query)
+	}
+}
+
+func TestHandleHistory_Pagination(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	history := newMongoAvailabilityHistory(coll.Database().Collection("availability_history"), 30*24*time.Hour)
+	assert.NoError(t, history.ensureIndexes(ctx))
+	now := time.Now().UTC()
+	for i, slots := range []int{0, 3, 0, 1} {
+		assert.NoError(t, history.Record(ctx, AvailabilityObservation{Timestamp: now.Add(time.Duration(i) * time.Minute), ServiceType: "Global Entry", Location: "5300", Slots: slots}))
+	}
+	assert.NoError(t, history.Record(ctx, AvailabilityObservation{Timestamp: now.AddDate(0, 0, -10), ServiceType: "Global Entry", Location: "5300", Slots: 9}))
+	assert.NoError(t, history.Record(ctx, AvailabilityObservation{Timestamp: now, ServiceType: "Global Entry", Location: "5020", Slots: 5}))
+
+	var slots []int
+	query := map[string]string{"location": "5300", "limit": "3"}
+	for {
+		resp, err := handler.handleHistory(ctx, history.coll, query)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		var page historyPage
+		assert.NoError(t, json.Unmarshal([]byte(resp.Body), &page))
+		assert.Equal(t, defaultHistoryDays, page.Days)
+		for _, o := range page.Observations {
+			slots = append(slots, o.Slots)
+		}
+		if !page.HasMore {
+			break
+		}
+		query["nextToken"] = page.NextToken
+	}
+	assert.Equal(t, []int{1, 0, 3, 0}, slots, "newest first, only inside the window and location")
+
+	var stored bson.M
+	assert.NoError(t, history.coll.FindOne(ctx, bson.M{"location": "5020"}).Decode(&stored))
+	assert.Contains(t, stored, "expiresAt")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultLocale is used when neither the subscription nor LOCALE picks a supported locale
+const defaultLocale = "en"
+
+// messageCatalog holds the notification texts for one locale. Each field is a fmt format whose
+// arguments are listed alongside it; use explicit argument indexes where a language needs a
+// different word order.
+type messageCatalog struct {
+	NotificationTitle    string // service
+	SlotsAvailable       string // service, location, comma-separated slots, minimum
+	LocationsAvailable   string // service, comma-separated locations, minimum
+	ExpirationTitle      string // service
+	ExpirationMessage    string // service
+	TargetDatePassed     string // target date, service, location
+	CombinedTitle        string // title, number of locations
+	GenericTitle         string // used when combined alerts have different titles
+	StillAvailable       string // message of an alert repeated past ESCALATE_AFTER
+	RemovedTitle         string // service
+	RemovedAfterExpiry   string // service, location
+	RemovedAfterFailures string // service, location
+	RemovedAfterTarget   string // service, location
+	BookingLink          string // booking URL
+	SlotSurge            string // slot count, service, location, previous count
+	SummaryTitle         string
+	SummarySoonest       string // service, location, soonest slot
+	SummaryNoSlots       string // service, location
+	SummaryUnavailable   string // service, location
+}
+
+// messageCatalogs maps a locale's primary language subtag to its texts. To add a language,
+// add an entry here; LOCALE and the subscription locale field accept it automatically.
+var messageCatalogs = map[string]messageCatalog{
+	"en": {
+		NotificationTitle:    "%s Appointment Notification",
+		SlotsAvailable:       "%s appointment available at %s on %s (minimum %d slots)",
+		LocationsAvailable:   "%s appointments available at %s (minimum %d slots)",
+		ExpirationTitle:      "%s Subscription Expired",
+		ExpirationMessage:    "Your %s appointment subscription has expired.",
+		TargetDatePassed:     "Your target date %s has passed, so your %s appointment subscription for %s has ended.",
+		CombinedTitle:        "%s (%d locations)",
+		GenericTitle:         "Appointment Notification",
+		StillAvailable:       "STILL available! %s",
+		RemovedTitle:         "%s Subscription Removed",
+		RemovedAfterExpiry:   "Your expired %s appointment subscription for %s has been removed. Subscribe again to keep getting alerts.",
+		RemovedAfterFailures: "Your %s appointment subscription for %s has been removed after repeated delivery failures. Subscribe again to keep getting alerts.",
+		RemovedAfterTarget:   "Your %s appointment subscription for %s has been removed because its target date has passed.",
+		BookingLink:          "Book now: %s",
+		SlotSurge:            "%d %s slots open at %s, up from %d. A new batch may have been released.",
+		SummaryTitle:         "Daily Appointment Summary",
+		SummarySoonest:       "%s at %s: soonest %s",
+		SummaryNoSlots:       "%s at %s: no open slots",
+		SummaryUnavailable:   "%s at %s: could not be checked",
+	},
+	"es": {
+		NotificationTitle:    "Notificación de cita de %s",
+		SlotsAvailable:       "Cita de %s disponible en %s el %s (mínimo %d espacios)",
+		LocationsAvailable:   "Citas de %s disponibles en %s (mínimo %d espacios)",
+		ExpirationTitle:      "Suscripción de %s vencida",
+		ExpirationMessage:    "Tu suscripción a citas de %s ha vencido.",
+		TargetDatePassed:     "Tu fecha objetivo %[1]s ya pasó, así que tu suscripción a citas de %[2]s en %[3]s ha terminado.",
+		CombinedTitle:        "%s (%d ubicaciones)",
+		GenericTitle:         "Notificación de cita",
+		StillAvailable:       "¡TODAVÍA disponible! %s",
+		RemovedTitle:         "Suscripción de %s eliminada",
+		RemovedAfterExpiry:   "Tu suscripción vencida a citas de %s en %s fue eliminada. Suscríbete de nuevo para seguir recibiendo alertas.",
+		RemovedAfterFailures: "Tu suscripción a citas de %s en %s fue eliminada tras varios fallos de entrega. Suscríbete de nuevo para seguir recibiendo alertas.",
+		RemovedAfterTarget:   "Tu suscripción a citas de %s en %s fue eliminada porque su fecha objetivo ya pasó.",
+		BookingLink:          "Reserva ahora: %s",
+		SlotSurge:            "%[1]d espacios de %[2]s disponibles en %[3]s, antes %[4]d. Puede que se haya liberado un nuevo lote.",
+		SummaryTitle:         "Resumen diario de citas",
+		SummarySoonest:       "%s en %s: la más próxima %s",
+		SummaryNoSlots:       "%s en %s: sin espacios disponibles",
+		SummaryUnavailable:   "%s en %s: no se pudo consultar",
+	},
+}
+
+// normalizeLocale reduces a locale such as "es-MX" or "ES_mx" to its supported catalog key
+func normalizeLocale(locale string) (string, bool) {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(locale)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	_, ok := messageCatalogs[lang]
+	return lang, ok
+}
+
+// supportedLocales returns the catalog keys in sorted order, for error messages
+func supportedLocales() []string {
+	locales := make([]string, 0, len(messageCatalogs))
+	for locale := range messageCatalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// messagesFor returns the catalog for locale, falling back to English
+func messagesFor(locale string) messageCatalog {
+	if lang, ok := normalizeLocale(locale); ok {
+		return messageCatalogs[lang]
+	}
+	return messageCatalogs[defaultLocale]
+}
+
+// validateLocale checks that locale, when set, has a catalog
+func validateLocale(locale string) error {
+	if locale == "" {
+		return nil
+	}
+	if _, ok := normalizeLocale(locale); !ok {
+		return fmt.Errorf("locale must be one of %s, got %q", strings.Join(supportedLocales(), ", "), locale)
+	}
+	return nil
+}
+
+// locale returns the locale for a subscriber, preferring its own over LOCALE
+func (h *LambdaHandler) locale(subscriberLocale string) string {
+	if lang, ok := normalizeLocale(subscriberLocale); ok {
+		return lang
+	}
+	if lang, ok := normalizeLocale(h.Mode.shared().Locale); ok {
+		return lang
+	}
+	return defaultLocale
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagesFor(t *testing.T) {
+	assert.Equal(t, messageCatalogs["es"], messagesFor("es-MX"))
+	assert.Equal(t, messageCatalogs["es"], messagesFor("ES_es"))
+	assert.Equal(t, messageCatalogs["en"], messagesFor("fr"), "unsupported locales fall back to English")
+	assert.Equal(t, messageCatalogs["en"], messagesFor(""))
+}
+
+func TestMessageCatalogs_Complete(t *testing.T) {
+	for locale, catalog := range messageCatalogs {
+		for name, text := range map[string]string{
+			"NotificationTitle":    catalog.NotificationTitle,
+			"SlotsAvailable":       catalog.SlotsAvailable,
+			"LocationsAvailable":   catalog.LocationsAvailable,
+			"ExpirationTitle":      catalog.ExpirationTitle,
+			"ExpirationMessage":    catalog.ExpirationMessage,
+			"TargetDatePassed":     catalog.TargetDatePassed,
+			"CombinedTitle":        catalog.CombinedTitle,
+			"GenericTitle":         catalog.GenericTitle,
+			"RemovedTitle":         catalog.RemovedTitle,
+			"RemovedAfterExpiry":   catalog.RemovedAfterExpiry,
+			"RemovedAfterFailures": catalog.RemovedAfterFailures,
+			"RemovedAfterTarget":   catalog.RemovedAfterTarget,
+			"BookingLink":          catalog.BookingLink,
+			"SlotSurge":            catalog.SlotSurge,
+			"SummaryTitle":         catalog.SummaryTitle,
+			"SummarySoonest":       catalog.SummarySoonest,
+			"SummaryNoSlots":       catalog.SummaryNoSlots,
+			"SummaryUnavailable":   catalog.SummaryUnavailable,
+		} {
+			assert.NotEmpty(t, text, "%s is missing %s", locale, name)
+		}
+	}
+}
+
+func TestValidateLocale(t *testing.T) {
+	assert.NoError(t, validateLocale(""))
+	assert.NoError(t, validateLocale("es-MX"))
+	assert.EqualError(t, validateLocale("fr"), `locale must be one of en, es, got "fr"`)
+}
+
+func TestNotifyLocalized(t *testing.T) {
+	notifier := &recordingNotifier{}
+	mode := &AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{SharedConfig: SharedConfig{Locale: "es"}}}
+	handler := NewLambdaHandler(mode, "", nil)
+	handler.Notifier = notifier
+
+	subscribers := []Subscriber{{Topic: "default"}, {Topic: "english", Locale: "en"}}
+	notified, err := handler.notifyLocalized(context.Background(), "", subscribers, func(locale string) Notification {
+		return Notification{Title: getNotificationTitle("NEXUS", locale), Message: locale}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, notified)
+	assert.Equal(t, []Notification{
+		{Topic: "default", Title: "Notificación de cita de NEXUS", Message: "es"},
+		{Topic: "english", Title: "NEXUS Appointment Notification", Message: "en"},
+	}, notifier.sent)
+}
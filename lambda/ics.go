@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ttpTimestampLayout is the local-time layout TTP uses for slot start and end timestamps
+const ttpTimestampLayout = "2006-01-02T15:04"
+
+// icsTimeLayout formats a floating (zone-less) iCalendar date-time
+const icsTimeLayout = "20060102T150405"
+
+// icsTextEscaper escapes iCalendar TEXT values (RFC 5545 section 3.3.11)
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// buildAppointmentICS renders a single-event calendar file for an appointment slot. TTP
+// timestamps are local to the enrollment center, so they are written as floating times that
+// calendar apps show unchanged in whatever zone the user is in.
+func buildAppointmentICS(serviceType, location string, appt Appointment, now time.Time) ([]byte, error) {
+	start, err := time.Parse(ttpTimestampLayout, appt.StartTimestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid slot start %q: %v", appt.StartTimestamp, err)
+	}
+	end, err := time.Parse(ttpTimestampLayout, appt.EndTimestamp)
+	if err != nil || !end.After(start) {
+		duration := time.Duration(appt.Duration) * time.Minute
+		if duration <= 0 {
+			duration = 15 * time.Minute
+		}
+		end = start.Add(duration)
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//global-entry-appointment//EN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:%s-%s-%s@global-entry-appointment", strings.ReplaceAll(serviceType, " ", ""), location, start.Format(icsTimeLayout)),
+		"DTSTAMP:" + now.UTC().Format(icsTimeLayout) + "Z",
+		"DTSTART:" + start.Format(icsTimeLayout),
+		"DTEND:" + end.Format(icsTimeLayout),
+		"SUMMARY:" + icsTextEscaper.Replace(fmt.Sprintf("%s appointment at location %s", serviceType, location)),
+		"DESCRIPTION:" + icsTextEscaper.Replace("Slot found open. Book it at "+ttpBaseURL+" before adding it to your calendar."),
+		"URL:" + ttpBaseURL,
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n"), nil
+}
+
+// appointmentAttachment builds the .ics attachment for a slot, or nil if the slot can't be rendered
+func appointmentAttachment(serviceType, location string, appt Appointment) *Attachment {
+	content, err := buildAppointmentICS(serviceType, location, appt, time.Now())
+	if err != nil {
+		return nil
+	}
+	return &Attachment{Filename: fmt.Sprintf("appointment-%s.ics", location), Content: content}
+}
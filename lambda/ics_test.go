@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildAppointmentICS(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	appt := Appointment{LocationID: 5300, StartTimestamp: "2025-05-04T10:00", EndTimestamp: "2025-05-04T10:15", Active: true}
+
+	content, err := buildAppointmentICS("Global Entry", "5300", appt, now)
+	assert.NoError(t, err)
+	ics := string(content)
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "UID:GlobalEntry-5300-20250504T100000@global-entry-appointment\r\n")
+	assert.Contains(t, ics, "DTSTAMP:20250501T120000Z\r\n")
+	assert.Contains(t, ics, "DTSTART:20250504T100000\r\n")
+	assert.Contains(t, ics, "DTEND:20250504T101500\r\n")
+	assert.Contains(t, ics, "SUMMARY:Global Entry appointment at location 5300\r\n")
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+}
+
+func TestBuildAppointmentICS_EndFromDuration(t *testing.T) {
+	appt := Appointment{StartTimestamp: "2025-05-04T10:00", Duration: 10}
+	content, err := buildAppointmentICS("NEXUS", "5020", appt, time.Now())
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "DTEND:20250504T101000\r\n")
+}
+
+func TestBuildAppointmentICS_InvalidStart(t *testing.T) {
+	_, err := buildAppointmentICS("NEXUS", "5020", Appointment{StartTimestamp: "soon"}, time.Now())
+	assert.Error(t, err)
+	assert.Nil(t, appointmentAttachment("NEXUS", "5020", Appointment{StartTimestamp: "soon"}))
+}
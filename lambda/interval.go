@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// lastCheckedCursorPrefix prefixes the cursor holding when a location with a
+// LOCATION_CHECK_INTERVALS override was last checked
+const lastCheckedCursorPrefix = "lastCheckedAt:"
+
+// locationIntervalSlack lets a location come due slightly early, since scheduled invocations
+// drift by a few seconds (more with STARTUP_JITTER_SECONDS) and would otherwise skip a whole run
+const locationIntervalSlack = 30 * time.Second
+
+// parseLocationIntervals parses per-location check intervals such as "5300=1m,5020=5m"
+func parseLocationIntervals(spec string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		location, every, ok := strings.Cut(part, "=")
+		location = strings.TrimSpace(location)
+		if !ok || location == "" {
+			return nil, fmt.Errorf("entry %q must look like 5300=5m", part)
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("entry %q: interval must be a positive duration such as 5m, got %q", part, every)
+		}
+		intervals[location] = interval
+	}
+	return intervals, nil
+}
+
+// locationsDue drops locations whose LOCATION_CHECK_INTERVALS override hasn't elapsed since
+// their last check. Locations without an override, or whose last check can't be loaded, are due.
+func (h *LambdaHandler) locationsDue(ctx context.Context, locationTopics []LocationTopics, now time.Time) []LocationTopics {
+	intervals, err := parseLocationIntervals(h.Mode.MultiUserConfig.LocationCheckIntervals)
+	if err != nil || len(intervals) == 0 {
+		return locationTopics
+	}
+	due := make([]LocationTopics, 0, len(locationTopics))
+	for _, lt := range locationTopics {
+		interval, ok := intervals[lt.Location]
+		if ok {
+			value, err := h.State.GetCursor(ctx, lastCheckedCursorPrefix+lt.Location)
+			if err != nil {
+				slog.Warn("Failed to load last check time, checking location", "location", lt.Location, "error", err)
+			} else if last, err := time.Parse(time.RFC3339, value); err == nil && now.Sub(last)+locationIntervalSlack < interval {
+				slog.Info("Skipping location until its check interval elapses", "location", lt.Location, "interval", interval, "lastCheckedAt", value)
+				continue
+			}
+		}
+		due = append(due, lt)
+	}
+	return due
+}
+
+// recordLocationChecked saves when a location with an interval override was checked
+func (h *LambdaHandler) recordLocationChecked(ctx context.Context, location string, now time.Time) {
+	intervals, _ := parseLocationIntervals(h.Mode.MultiUserConfig.LocationCheckIntervals)
+	if _, ok := intervals[location]; !ok {
+		return
+	}
+	if err := h.State.PutCursor(ctx, lastCheckedCursorPrefix+location, now.UTC().Format(time.RFC3339)); err != nil {
+		slog.Warn("Failed to save last check time", "location", location, "error", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocationIntervals(t *testing.T) {
+	intervals, err := parseLocationIntervals(" 5300=1m, 5020=5m ,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"5300": time.Minute, "5020": 5 * time.Minute}, intervals)
+
+	for _, spec := range []string{"5300", "=5m", "5300=often", "5300=0s"} {
+		_, err := parseLocationIntervals(spec)
+		assert.Error(t, err, spec)
+	}
+	assert.Len(t, (&Config{LocationCheckIntervals: "5300=-1m"}).validate(), 1)
+}
+
+func TestLocationsDue(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", LocationCheckIntervals: "5020=5m"}}, "", nil)
+	ctx := context.Background()
+	locations := []LocationTopics{{Location: "5300"}, {Location: "5020"}}
+	start := time.Date(2025, 5, 5, 10, 0, 0, 0, time.UTC)
+
+	// Never checked: everything is due
+	assert.Equal(t, locations, handler.locationsDue(ctx, locations, start))
+	handler.recordLocationChecked(ctx, "5300", start)
+	handler.recordLocationChecked(ctx, "5020", start)
+	value, _ := handler.State.GetCursor(ctx, lastCheckedCursorPrefix+"5300")
+	assert.Empty(t, value, "locations without an override are not tracked")
+
+	// Locations without an override are checked every run
+	assert.Equal(t, []LocationTopics{{Location: "5300"}}, handler.locationsDue(ctx, locations, start.Add(time.Minute)))
+	assert.Equal(t, []LocationTopics{{Location: "5300"}}, handler.locationsDue(ctx, locations, start.Add(4*time.Minute)))
+
+	// A run a few seconds early still counts as due
+	assert.Equal(t, locations, handler.locationsDue(ctx, locations, start.Add(5*time.Minute-10*time.Second)))
+	assert.Equal(t, locations, handler.locationsDue(ctx, locations, start.Add(5*time.Minute)))
+}
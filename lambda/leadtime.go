@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// slotsAfterLeadTime drops slots starting before earliest. TTP timestamps are local to the
+// enrollment center, so they are read in loc. Slots whose start can't be parsed are kept,
+// so a format change never hides availability.
+func slotsAfterLeadTime(appointments []Appointment, earliest time.Time, loc *time.Location) []Appointment {
+	var result []Appointment
+	for _, appt := range appointments {
+		start, err := time.ParseInLocation(ttpTimestampLayout, appt.StartTimestamp, loc)
+		if err == nil && start.Before(earliest) {
+			continue
+		}
+		result = append(result, appt)
+	}
+	return result
+}
+
+// locationTimeZone returns the enrollment center's time zone from location metadata,
+// falling back to UTC when it can't be resolved
+func (h *LambdaHandler) locationTimeZone(ctx context.Context, serviceType, location string) *time.Location {
+	meta, ok, err := h.Locations.Resolve(ctx, serviceType, location)
+	if err != nil || !ok || meta.TimeZone == "" {
+		slog.Warn("Location time zone unknown, reading slot times as UTC", "service", serviceType, "location", location, "error", err)
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(meta.TimeZone)
+	if err != nil {
+		slog.Warn("Invalid location time zone, reading slot times as UTC", "service", serviceType, "location", location, "timeZone", meta.TimeZone)
+		return time.UTC
+	}
+	return loc
+}
+
+// Fixed zones spanning every UTC offset in use. Reading a slot's wall-clock time in each gives
+// the earliest and latest instant it could denote wherever the center is.
+var (
+	earliestSlotZone = time.FixedZone("UTC+14", 14*60*60)
+	latestSlotZone   = time.FixedZone("UTC-12", -12*60*60)
+)
+
+// bookableSlots runs parsed slots through the filters every check applies, returning what is
+// left after each step: active slots, those that haven't started, and those outside
+// MIN_LEAD_TIME. Anything reporting slots to users should use the last.
+func (h *LambdaHandler) bookableSlots(ctx context.Context, serviceType, location string, appointments []Appointment, now time.Time) (active, upcoming, kept []Appointment) {
+	// Any active slot counts, not just the first entry
+	for _, appt := range appointments {
+		if appt.Active {
+			active = append(active, appt)
+		}
+	}
+	upcoming = h.dropPastSlots(ctx, serviceType, location, active, now)
+	kept = h.applyMinLeadTime(ctx, serviceType, location, upcoming, now)
+	return active, upcoming, kept
+}
+
+// dropPastSlots removes slots that have already started, which the TTP API occasionally still
+// returns. Only slots within a day of now depend on the center's time zone, so it is looked up
+// just for those. Unparseable slots are kept. KEEP_PAST_SLOTS turns the filter off.
+func (h *LambdaHandler) dropPastSlots(ctx context.Context, serviceType, location string, appointments []Appointment, now time.Time) []Appointment {
+	if h.Mode.shared().KeepPastSlots {
+		return appointments
+	}
+	var zone *time.Location
+	var kept []Appointment
+	for _, appt := range appointments {
+		latest, err := time.ParseInLocation(ttpTimestampLayout, appt.StartTimestamp, latestSlotZone)
+		if err == nil && latest.Before(now) {
+			continue // Past in every time zone
+		}
+		earliest, err := time.ParseInLocation(ttpTimestampLayout, appt.StartTimestamp, earliestSlotZone)
+		if err == nil && earliest.Before(now) {
+			if zone == nil {
+				zone = h.locationTimeZone(ctx, serviceType, location)
+			}
+			if start, _ := time.ParseInLocation(ttpTimestampLayout, appt.StartTimestamp, zone); start.Before(now) {
+				continue
+			}
+		}
+		kept = append(kept, appt)
+	}
+	if dropped := len(appointments) - len(kept); dropped > 0 {
+		slog.Warn("Dropping slots that already started", "service", serviceType, "location", location, "dropped", dropped)
+	}
+	return kept
+}
+
+// applyMinLeadTime drops slots too soon to book when MIN_LEAD_TIME is set
+func (h *LambdaHandler) applyMinLeadTime(ctx context.Context, serviceType, location string, appointments []Appointment, now time.Time) []Appointment {
+	lead := h.Mode.shared().MinLeadTime
+	if lead <= 0 || len(appointments) == 0 {
+		return appointments
+	}
+	kept := slotsAfterLeadTime(appointments, now.Add(lead), h.locationTimeZone(ctx, serviceType, location))
+	if dropped := len(appointments) - len(kept); dropped > 0 {
+		slog.Info("Skipping slots inside MIN_LEAD_TIME", "service", serviceType, "location", location, "skipped", dropped, "minLeadTime", lead)
+	}
+	return kept
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotsAfterLeadTime_Boundary(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	earliest := time.Date(2025, 5, 5, 10, 0, 0, 0, loc)
+
+	kept := slotsAfterLeadTime([]Appointment{
+		{StartTimestamp: "2025-05-05T09:59"}, // Just inside the lead time
+		{StartTimestamp: "2025-05-05T10:00"}, // Exactly at the cutoff
+		{StartTimestamp: "2025-05-05T10:01"}, // Just outside
+		{StartTimestamp: "soon"},             // Unparseable slots are kept
+	}, earliest, loc)
+	assert.Equal(t, []Appointment{
+		{StartTimestamp: "2025-05-05T10:00"},
+		{StartTimestamp: "2025-05-05T10:01"},
+		{StartTimestamp: "soon"},
+	}, kept)
+
+	// The same wall-clock slot read as UTC starts four hours earlier, inside the lead time
+	assert.Len(t, slotsAfterLeadTime([]Appointment{{StartTimestamp: "2025-05-05T12:00"}}, earliest, time.UTC), 0)
+}
+
+func TestPersonalMode_MinLeadTimeSkipsSoonSlots(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	handler.Mode.PersonalConfig.MinLeadTime = 24 * time.Hour
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+
+	locationsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK", TimeZone: "America/New_York"}})
+	}))
+	defer locationsServer.Close()
+	handler.Locations.URL = locationsServer.URL
+
+	ny, _ := time.LoadLocation("America/New_York")
+	now := time.Now().In(ny)
+	tooSoon := now.Add(23 * time.Hour).Format(ttpTimestampLayout)
+	bookable := now.Add(25 * time.Hour).Format(ttpTimestampLayout)
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: tooSoon, Active: true},
+			{LocationID: 5300, StartTimestamp: bookable, Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	_, err := handler.handlePersonalMode(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, notifier.sent, 1) {
+		assert.Contains(t, notifier.sent[0].Message, bookable)
+		assert.NotContains(t, notifier.sent[0].Message, tooSoon)
+	}
+
+	// Only slots inside the lead time means nothing to notify
+	notifier.sent = nil
+	handler.Mode.PersonalConfig.MinLeadTime = 48 * time.Hour
+	_, err = handler.handlePersonalMode(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, notifier.sent)
+}
+
+// queryTTPClient serves slots through the URL a real check would request, honoring its limit
+type queryTTPClient struct {
+	cfg   *SharedConfig
+	slots []Appointment
+	urls  []string
+}
+
+func (c *queryTTPClient) FetchSlots(ctx context.Context, serviceType, location string, minimum int) ([]byte, error) {
+	apiURL := getAppointmentURL(c.cfg, serviceType, location, minimum)
+	if isSoonestQuery(ctx) {
+		apiURL = getSoonestAppointmentURL(c.cfg, serviceType, location, minimum)
+	}
+	c.urls = append(c.urls, apiURL)
+	parsed, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := strconv.Atoi(parsed.Query().Get("limit"))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(c.slots[:min(limit, len(c.slots))])
+}
+
+func TestGetAppointmentURL_MinLeadTimeLimit(t *testing.T) {
+	cfg := &SharedConfig{MinLeadTime: 24 * time.Hour}
+	assert.Contains(t, getAppointmentURL(cfg, "Global Entry", "5300", 1), "limit=50&")
+
+	cfg.SlotSurgeThreshold = 80
+	assert.Contains(t, getAppointmentURL(cfg, "Global Entry", "5300", 1), "limit=80&")
+}
+
+func TestMinLeadTime_FindsLaterSlotPastTooSoonOne(t *testing.T) {
+	cfg := &Config{MongoDBPassword: "test", SharedConfig: SharedConfig{MinLeadTime: 24 * time.Hour}}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: cfg}, "", nil)
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	locationsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK", TimeZone: "America/New_York"}})
+	}))
+	defer locationsServer.Close()
+	handler.Locations.URL = locationsServer.URL
+
+	ny, _ := time.LoadLocation("America/New_York")
+	now := time.Now().In(ny)
+	tooSoon := now.Add(2 * time.Hour).Format(ttpTimestampLayout)
+	bookable := now.Add(72 * time.Hour).Format(ttpTimestampLayout)
+	handler.TTP = &queryTTPClient{cfg: handler.Mode.shared(), slots: []Appointment{
+		{LocationID: 5300, StartTimestamp: tooSoon, Active: true},
+		{LocationID: 5300, StartTimestamp: bookable, Active: true},
+	}}
+
+	result, err := handler.checkSingleMinimum(context.Background(), "Global Entry", "5300", []Subscriber{{Topic: "a"}}, 1)
+	assert.NoError(t, err)
+	assert.True(t, result.Found, "the soonest slot being too soon must not hide a later one")
+	if assert.Len(t, notifier.sent, 1) {
+		assert.Contains(t, notifier.sent[0].Message, bookable)
+		assert.NotContains(t, notifier.sent[0].Message, tooSoon)
+	}
+}
+
+func TestDropPastSlots(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	lookups := 0
+	locationsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK", TimeZone: "America/New_York"}})
+	}))
+	defer locationsServer.Close()
+	handler.Locations.URL = locationsServer.URL
+
+	// 10:00 in New York
+	now := time.Date(2099, 5, 4, 14, 0, 0, 0, time.UTC)
+	far := []Appointment{{StartTimestamp: "2099-05-01T10:00"}, {StartTimestamp: "2099-05-08T10:00"}, {StartTimestamp: "soon"}}
+	assert.Equal(t, far[1:], handler.dropPastSlots(context.Background(), "NEXUS", "5300", far, now))
+	assert.Equal(t, 0, lookups, "slots days away don't need the center's time zone")
+
+	today := []Appointment{{StartTimestamp: "2099-05-04T09:45"}, {StartTimestamp: "2099-05-04T10:00"}, {StartTimestamp: "2099-05-04T10:15"}}
+	assert.Equal(t, today[1:], handler.dropPastSlots(context.Background(), "NEXUS", "5300", today, now))
+	assert.Equal(t, 1, lookups)
+
+	handler.Mode.MultiUserConfig.KeepPastSlots = true
+	assert.Equal(t, far, handler.dropPastSlots(context.Background(), "NEXUS", "5300", far, now))
+}
+
+func TestPersonalMode_PastSlotNotNotified(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+
+	past := time.Now().Add(-48 * time.Hour).Format(ttpTimestampLayout)
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{{LocationID: 5300, StartTimestamp: past, Active: true}})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	_, err := handler.handlePersonalMode(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, notifier.sent)
+}
+
+func TestSoonestBookableSlot_SkipsPastAndInactiveSlots(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2020-05-04T10:00", Active: true},
+			{LocationID: 5300, StartTimestamp: "2099-05-01T10:00", Active: false},
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, apiServer.URL+"/%s", nil)
+
+	slot, err := handler.soonestBookableSlot(context.Background(), "Global Entry", "5300")
+	assert.NoError(t, err)
+	assert.Equal(t, "2099-05-04T10:00", slot)
+}
+
+func TestSoonestBookableSlot_IgnoresLatestOrdering(t *testing.T) {
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", SharedConfig: SharedConfig{OrderBy: orderByLatest}}}, "", nil)
+	client := &queryTTPClient{cfg: handler.Mode.shared(), slots: []Appointment{
+		{LocationID: 5300, StartTimestamp: "2020-05-04T10:00", Active: true},
+		{LocationID: 5300, StartTimestamp: "2099-05-01T10:00", Active: false},
+		{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true},
+	}}
+	handler.TTP = client
+
+	slot, err := handler.soonestBookableSlot(context.Background(), "Global Entry", "5300")
+	assert.NoError(t, err)
+	assert.Equal(t, "2099-05-04T10:00", slot, "a stale and an inactive slot at the head of the list don't hide the next one")
+	if assert.Len(t, client.urls, 1) {
+		assert.Contains(t, client.urls[0], "orderBy=soonest&limit=10&")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// locationFilterAttributes maps filter attribute names to the Location flag they test
+var locationFilterAttributes = map[string]func(Location) bool{
+	"operational": func(l Location) bool { return l.Operational },
+	"temporary":   func(l Location) bool { return l.Temporary },
+	"inviteonly":  func(l Location) bool { return l.InviteOnly },
+	"remote":      func(l Location) bool { return l.RemoteInd },
+}
+
+// locationAttributeDescriptions phrase each filter attribute for error messages, as in "location 5300 is invite-only"
+var locationAttributeDescriptions = map[string]string{
+	"operational": "operational",
+	"temporary":   "a temporary center",
+	"inviteonly":  "invite-only",
+	"remote":      "a remote center",
+}
+
+type (
+	// LocationFilter lists enrollment center attributes and the value each must have
+	LocationFilter map[string]bool
+
+	// LocationResolver looks up enrollment center metadata from the TTP locations API. Fetched
+	// locations are kept in locationCache, so they outlive the resolver in a warm container.
+	LocationResolver struct {
+		URL         string // Locations endpoint, overridable for testing
+		HTTPClient  *http.Client
+		Timeout     time.Duration // Per-attempt fetch deadline; zero relies on the client timeout
+		MaxAttempts int           // Fetch attempts before a lookup fails
+		TTL         time.Duration // How long fetched locations are reused; zero fetches on every lookup
+
+		mu sync.Mutex // Serializes fetches so concurrent checks don't all fetch the same list
+	}
+)
+
+// parseLocationFilter parses a comma-separated attribute list such as "operational,!temporary"
+func parseLocationFilter(filter string) (LocationFilter, error) {
+	result := LocationFilter{}
+	for _, part := range strings.Split(filter, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		want := true
+		if strings.HasPrefix(part, "!") {
+			want = false
+			part = strings.TrimPrefix(part, "!")
+		}
+		name := strings.ToLower(part)
+		if _, ok := locationFilterAttributes[name]; !ok {
+			return nil, fmt.Errorf("unknown location filter attribute %q (use operational, temporary, inviteOnly or remote)", part)
+		}
+		result[name] = want
+	}
+	return result, nil
+}
+
+// Matches reports whether the location has every attribute value the filter requires
+func (f LocationFilter) Matches(loc Location) bool {
+	for name, want := range f {
+		if locationFilterAttributes[name](loc) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Mismatch describes the first attribute the location fails, such as "is invite-only",
+// or returns "" when it matches
+func (f LocationFilter) Mismatch(loc Location) string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Stable messages when several attributes fail
+	for _, name := range names {
+		if has := locationFilterAttributes[name](loc); has != f[name] {
+			if has {
+				return "is " + locationAttributeDescriptions[name]
+			}
+			return "is not " + locationAttributeDescriptions[name]
+		}
+	}
+	return ""
+}
+
+// NewLocationResolver creates a LocationResolver for the TTP locations API
+func NewLocationResolver(client *http.Client) *LocationResolver {
+	return &LocationResolver{
+		URL:         ttpBaseURL + "/schedulerapi/locations/",
+		HTTPClient:  client,
+		MaxAttempts: defaultTTPMaxAttempts,
+		TTL:         defaultLocationsCacheTTL,
+	}
+}
+
+// Resolve returns the metadata for a location ID, fetching the service's locations when they
+// aren't cached or the cached copy has expired
+func (r *LocationResolver) Resolve(ctx context.Context, serviceType, locationID string) (Location, bool, error) {
+	if r.TTL <= 0 {
+		locations, err := r.fetchByID(ctx, serviceType)
+		if err != nil {
+			return Location{}, false, err
+		}
+		loc, ok := locations[locationID]
+		return loc, ok, nil
+	}
+	key := r.URL + "|" + serviceType
+	locations, ok := locationCache.get(key)
+	if !ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// Another goroutine may have fetched while this one waited
+		if locations, ok = locationCache.get(key); !ok {
+			var err error
+			if locations, err = r.fetchByID(ctx, serviceType); err != nil {
+				return Location{}, false, err
+			}
+			locationCache.set(key, locations, r.TTL)
+		}
+	}
+	loc, ok := locations[locationID]
+	return loc, ok, nil
+}
+
+// fetchByID loads a service's locations keyed by location ID
+func (r *LocationResolver) fetchByID(ctx context.Context, serviceType string) (map[string]Location, error) {
+	fetched, err := r.fetch(ctx, serviceType)
+	if err != nil {
+		return nil, err
+	}
+	locations := make(map[string]Location, len(fetched))
+	for _, loc := range fetched {
+		locations[strconv.Itoa(loc.ID)] = loc
+	}
+	return locations, nil
+}
+
+// fetch loads all locations for a service from the TTP API, retrying transient failures like
+// slot checks do. Every attempt has its own deadline, since a hung fetch would hold up every
+// check waiting on the resolver.
+func (r *LocationResolver) fetch(ctx context.Context, serviceType string) ([]Location, error) {
+	reqURL := r.URL + "?serviceName=" + url.QueryEscape(serviceType)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create locations request: %v", err)
+	}
+	client := retryClient{HTTPClient: r.HTTPClient, Timeout: r.Timeout}
+	resp, err := client.doWithRetry(ctx, req, r.MaxAttempts)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return nil, fmt.Errorf("locations API %v", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get locations: %v", err)
+	}
+	defer resp.Body.Close()
+	var locations []Location
+	if err := json.NewDecoder(resp.Body).Decode(&locations); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal locations: %v", err)
+	}
+	return locations, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocationFilter(t *testing.T) {
+	filter, err := parseLocationFilter("operational, !temporary,!inviteOnly")
+	assert.NoError(t, err)
+	assert.Equal(t, LocationFilter{"operational": true, "temporary": false, "inviteonly": false}, filter)
+
+	filter, err = parseLocationFilter("")
+	assert.NoError(t, err)
+	assert.Empty(t, filter)
+
+	_, err = parseLocationFilter("onlyRenewals")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown location filter attribute "onlyRenewals"`)
+}
+
+func TestLocationFilter_Matches(t *testing.T) {
+	filter, _ := parseLocationFilter("operational,!temporary,remote")
+
+	assert.True(t, filter.Matches(Location{Operational: true, RemoteInd: true}))
+	assert.False(t, filter.Matches(Location{Operational: true, RemoteInd: true, Temporary: true}))
+	assert.False(t, filter.Matches(Location{Operational: false, RemoteInd: true}))
+	assert.True(t, LocationFilter{}.Matches(Location{}))
+}
+
+func TestLocationFilter_Mismatch(t *testing.T) {
+	filter, _ := parseLocationFilter("!inviteOnly,!temporary,operational")
+	assert.Equal(t, "", filter.Mismatch(Location{Operational: true}))
+	assert.Equal(t, "is invite-only", filter.Mismatch(Location{Operational: true, InviteOnly: true}))
+	assert.Equal(t, "is a temporary center", filter.Mismatch(Location{Operational: true, Temporary: true}))
+	assert.Equal(t, "is not operational", filter.Mismatch(Location{}))
+}
+
+func TestHandleSubscription_RejectsUnbookableLocation(t *testing.T) {
+	locationsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK", Operational: true}, {ID: 5446, Name: "Popup", Operational: true, Temporary: true}, {ID: 5447, Name: "VIP", Operational: true, InviteOnly: true}})
+	}))
+	defer locationsServer.Close()
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", SubscriptionLocationFilter: "!inviteOnly,!temporary"}}, "", nil)
+	handler.Locations.URL = locationsServer.URL
+
+	for location, reason := range map[string]string{"5446": "is a temporary center", "5447": "is invite-only"} {
+		resp, err := handler.handleSubscription(context.Background(), nil, SubscriptionRequest{Action: "subscribe", Location: location, NtfyTopic: "test-topic"})
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode)
+		assert.Contains(t, resp.Body, "location "+location+" "+reason)
+	}
+	assert.Equal(t, "", handler.unbookableLocation(context.Background(), "Global Entry", "5300"))
+	assert.Equal(t, "", handler.unbookableLocation(context.Background(), "Global Entry", "9999"), "unknown locations are accepted")
+
+	handler.Mode.MultiUserConfig.SubscriptionLocationFilter = ""
+	assert.Equal(t, "", handler.unbookableLocation(context.Background(), "Global Entry", "5446"), "an empty filter accepts every location")
+}
+
+func TestLocationResolver_CachesPerService(t *testing.T) {
+	calls := 0
+	var serviceName string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		serviceName = r.URL.Query().Get("serviceName")
+		json.NewEncoder(w).Encode([]Location{
+			{ID: 5300, Name: "JFK International Global Entry EC", Operational: true},
+			{ID: 5140, Name: "LAX Global Entry EC", Operational: true, Temporary: true},
+		})
+	}))
+	defer server.Close()
+
+	resolver := NewLocationResolver(&http.Client{Timeout: 2 * time.Second})
+	resolver.URL = server.URL
+	ctx := context.Background()
+
+	loc, ok, err := resolver.Resolve(ctx, "Global Entry", "5140")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, loc.Temporary)
+	assert.Equal(t, "Global Entry", serviceName)
+
+	_, ok, err = resolver.Resolve(ctx, "Global Entry", "9999")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// Served from cache
+	assert.Equal(t, 1, calls)
+}
+
+func TestLocationResolver_RetriesAndTimesOut(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Query().Get("serviceName") {
+		case "NEXUS":
+			time.Sleep(200 * time.Millisecond) // Hangs past the per-attempt deadline
+		case "Global Entry":
+			if calls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK"}})
+	}))
+	defer server.Close()
+
+	resolver := NewLocationResolver(&http.Client{Timeout: 2 * time.Second})
+	resolver.URL = server.URL
+	resolver.Timeout = 50 * time.Millisecond
+	ctx := context.Background()
+
+	// A transient status is retried
+	_, ok, err := resolver.Resolve(ctx, "Global Entry", "5300")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, calls)
+
+	// A hung fetch fails once every attempt times out
+	resolver.MaxAttempts = 1
+	start := time.Now()
+	_, _, err = resolver.Resolve(ctx, "NEXUS", "5300")
+	assert.ErrorContains(t, err, "failed to get locations")
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestPersonalMode_LocationFilterSkipsLocation(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Mock locations API marking the configured location as temporary
+	locationsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK", Operational: true, Temporary: true}})
+	}))
+	defer locationsServer.Close()
+	handler.Locations.URL = locationsServer.URL
+	handler.Mode.PersonalConfig.LocationFilter = "!temporary"
+
+	// Mock TTP API that should never be called
+	apiCalls := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
+		json.NewEncoder(w).Encode([]Appointment{})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	// Create CloudWatch event
+	event := events.CloudWatchEvent{Source: "aws.events"}
+	eventJSON, _ := json.Marshal(event)
+
+	resp, err := handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 0, apiCalls)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+)
+
+// LOG_TOPIC_REDACTION modes. Topics work like capability URLs, since anyone who knows one can
+// read its alerts, so deployments sharing logs can hide them.
+const (
+	logTopicsHash   = "hash"   // Replace topics with the audit log's topicHash, so log lines still correlate
+	logTopicsRedact = "redact" // Replace topics with a fixed placeholder
+)
+
+// topicLogKeys are the attribute keys that carry ntfy topics
+var topicLogKeys = map[string]bool{"topic": true, "ntfyTopic": true}
+
+// redactTopic hides a topic according to mode; unknown modes leave it unchanged
+func redactTopic(mode, topic string) string {
+	switch mode {
+	case logTopicsHash:
+		return hashTopic(topic)
+	case logTopicsRedact:
+		return "[redacted]"
+	}
+	return topic
+}
+
+// newLogHandler builds the JSON log handler, hiding topic attributes when mode is set.
+// Locations, statuses and other attributes are logged as before.
+func newLogHandler(w io.Writer, mode string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if mode != "" {
+		opts.ReplaceAttr = func(_ []string, a slog.Attr) slog.Attr {
+			if topicLogKeys[a.Key] && a.Value.Kind() == slog.KindString {
+				a.Value = slog.StringValue(redactTopic(mode, a.Value.String()))
+			}
+			return a
+		}
+	}
+	return slog.NewJSONHandler(w, opts)
+}
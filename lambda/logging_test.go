@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogHandler_TopicRedaction(t *testing.T) {
+	tests := []struct {
+		name, mode, want string
+	}{
+		{"off", "", "my-secret-topic"},
+		{"hash", logTopicsHash, hashTopic("my-secret-topic")},
+		{"redact", logTopicsRedact, "[redacted]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			slog.New(newLogHandler(&buf, tt.mode)).Info("Sent notification", "topic", "my-secret-topic", "ntfyTopic", "my-secret-topic", "location", "5300", "topics", 2)
+
+			var entry map[string]any
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, tt.want, entry["topic"])
+			assert.Equal(t, tt.want, entry["ntfyTopic"])
+			assert.Equal(t, "5300", entry["location"])
+			assert.Equal(t, float64(2), entry["topics"], "topic counts are not topics")
+		})
+	}
+}
+
+func TestSharedConfig_LogTopicRedaction(t *testing.T) {
+	assert.Empty(t, (&SharedConfig{LogTopicRedaction: logTopicsHash}).validate())
+	assert.Len(t, (&SharedConfig{LogTopicRedaction: "mask"}).validate(), 1)
+}
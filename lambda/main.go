@@ -1,15 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,15 +18,22 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/kelseyhightower/envconfig"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
 )
 
 var corsHeaders = map[string]string{
 	"Access-Control-Allow-Origin":      "https://arun0009.github.io",
-	"Access-Control-Allow-Methods":     "GET, POST, OPTIONS",
+	"Access-Control-Allow-Methods":     "GET, POST, PATCH, DELETE, OPTIONS",
 	"Access-Control-Allow-Headers":     "Content-Type",
 	"Access-Control-Allow-Credentials": "true",
 }
@@ -33,19 +41,94 @@ var corsHeaders = map[string]string{
 var validNtfyPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
 type (
+	// SharedConfig holds environment variables common to both modes
+	SharedConfig struct {
+		StartupJitterSeconds    int           `envconfig:"STARTUP_JITTER_SECONDS" default:"0"`
+		SlotsPath               string        `envconfig:"SLOTS_PATH" default:"/schedulerapi/slots"`
+		NtfyFormat              string        `envconfig:"NTFY_FORMAT" default:"json"`
+		RequestTimeoutSeconds   int           `envconfig:"REQUEST_TIMEOUT_SECONDS" default:"5"`
+		LocationFilter          string        `envconfig:"LOCATION_FILTER"`
+		NotifyOnTransition      bool          `envconfig:"NOTIFY_ON_TRANSITION" default:"false"`
+		NotifierSelfTest        bool          `envconfig:"NOTIFIER_SELF_TEST" default:"false"`
+		OrderBy                 string        `envconfig:"ORDER_BY" default:"soonest"`
+		DedupTTLSeconds         int           `envconfig:"DEDUP_TTL_SECONDS" default:"0"`
+		TTPMaxAttempts          int           `envconfig:"TTP_MAX_ATTEMPTS" default:"3"`
+		PushgatewayURL          string        `envconfig:"PUSHGATEWAY_URL"`
+		PushgatewayJob          string        `envconfig:"PUSHGATEWAY_JOB" default:"global_entry_appointment"`
+		NtfyAttachICS           bool          `envconfig:"NTFY_ATTACH_ICS" default:"false"`
+		WebhookURL              string        `envconfig:"WEBHOOK_URL"`
+		WebhookSecret           string        `envconfig:"WEBHOOK_SECRET"`
+		WebhookMaxAttempts      int           `envconfig:"WEBHOOK_MAX_ATTEMPTS" default:"3"`
+		WebhookDLQURL           string        `envconfig:"WEBHOOK_DLQ_URL"`
+		Locale                  string        `envconfig:"LOCALE" default:"en"`
+		CheckSchedule           string        `envconfig:"CHECK_SCHEDULE"`
+		CheckScheduleTimezone   string        `envconfig:"CHECK_SCHEDULE_TIMEZONE" default:"UTC"`
+		AdminNtfyTopic          string        `envconfig:"ADMIN_NTFY_TOPIC"`
+		RateLimitAlertThreshold int           `envconfig:"RATE_LIMIT_ALERT_THRESHOLD" default:"5"`
+		NexusScanLimit          int           `envconfig:"NEXUS_SCAN_LIMIT" default:"5"`
+		NexusScanMinimum        int           `envconfig:"NEXUS_SCAN_MINIMUM" default:"0"`
+		LogTopicRedaction       string        `envconfig:"LOG_TOPIC_REDACTION"`
+		MinLeadTime             time.Duration `envconfig:"MIN_LEAD_TIME" default:"0"`
+		MaxRetryDuration        time.Duration `envconfig:"MAX_RETRY_DURATION" default:"0"`
+		ScheduleEventSources    string        `envconfig:"SCHEDULE_EVENT_SOURCES"`
+		EscalateAfter           int           `envconfig:"ESCALATE_AFTER" default:"0"`
+		EscalationPolicy        string        `envconfig:"ESCALATION_POLICY" default:"urgent"`
+		NtfyRateLimit           string        `envconfig:"NTFY_RATE_LIMIT"`
+		WebhookRateLimit        string        `envconfig:"WEBHOOK_RATE_LIMIT"`
+		BookingURLTemplate      string        `envconfig:"BOOKING_URL_TEMPLATE"`
+		LocationsCacheTTL       time.Duration `envconfig:"LOCATIONS_CACHE_TTL" default:"1h"`
+		SNSTopicARN             string        `envconfig:"SNS_TOPIC_ARN"`
+		KeepPastSlots           bool          `envconfig:"KEEP_PAST_SLOTS" default:"false"`
+		SlotSurgeThreshold      int           `envconfig:"SLOT_SURGE_THRESHOLD" default:"0"`
+		SlotSurgeRearmBelow     int           `envconfig:"SLOT_SURGE_REARM_BELOW" default:"0"`
+		DebugResponse           bool          `envconfig:"DEBUG_RESPONSE" default:"false"`
+		DailySummaryTime        string        `envconfig:"DAILY_SUMMARY_TIME"`
+		DailySummaryTimezone    string        `envconfig:"DAILY_SUMMARY_TIMEZONE" default:"UTC"`
+		SchemaAlertThreshold    int           `envconfig:"SCHEMA_ALERT_THRESHOLD" default:"3"`
+	}
+
 	// Config holds environment variables for multi-user mode
 	Config struct {
-		MongoDBPassword string `envconfig:"MONGODB_PASSWORD" required:"true"`
-		NtfyServer      string `envconfig:"NTFY_SERVER" default:"https://ntfy.sh"`
+		SharedConfig
+		MongoDBPassword               string `envconfig:"MONGODB_PASSWORD" required:"true"`
+		NtfyServer                    string `envconfig:"NTFY_SERVER" default:"https://ntfy.sh"`
+		MaxConcurrentRequests         int    `envconfig:"MAX_CONCURRENT_REQUESTS" default:"10"`
+		CircuitBreakerThreshold       int    `envconfig:"CIRCUIT_BREAKER_THRESHOLD" default:"5"`
+		CircuitBreakerCooldownSeconds int    `envconfig:"CIRCUIT_BREAKER_COOLDOWN_SECONDS" default:"30"`
+		MaxDeliveryFailures           int    `envconfig:"MAX_DELIVERY_FAILURES" default:"10"`
+		NtfyBatchTopics               bool   `envconfig:"NTFY_BATCH_TOPICS" default:"false"`
+		SoonestIntervalSeconds        int    `envconfig:"SOONEST_INTERVAL_SECONDS" default:"60"`
+		MaxLocationsPerRun            int    `envconfig:"MAX_LOCATIONS_PER_RUN" default:"0"`
+		AggregationReadPreference     string `envconfig:"AGGREGATION_READ_PREFERENCE" default:"primary"`
+		AuditLog                      bool   `envconfig:"AUDIT_LOG" default:"false"`
+		AuditRetentionDays            int    `envconfig:"AUDIT_RETENTION_DAYS" default:"90"`
+		CheckOnSubscribe              bool   `envconfig:"CHECK_ON_SUBSCRIBE" default:"false"`
+		MongoDBWriteConcern           string `envconfig:"MONGODB_WRITE_CONCERN"`
+		MongoDBReadConcern            string `envconfig:"MONGODB_READ_CONCERN"`
+		MaxSubscriptionsPerTopic      int    `envconfig:"MAX_SUBSCRIPTIONS_PER_TOPIC" default:"20"`
+		AdminAPIToken                 string `envconfig:"ADMIN_API_TOKEN"`
+		MaxNotificationsPerRun        int    `envconfig:"MAX_NOTIFICATIONS_PER_RUN" default:"0"`
+		NtfyGroupByService            bool   `envconfig:"NTFY_GROUP_BY_SERVICE" default:"false"`
+		LocationCheckIntervals        string `envconfig:"LOCATION_CHECK_INTERVALS"`
+		AvailabilityHistory           bool   `envconfig:"AVAILABILITY_HISTORY" default:"false"`
+		AvailabilityHistoryDays       int    `envconfig:"AVAILABILITY_HISTORY_DAYS" default:"30"`
+		SubscriptionLocationFilter    string `envconfig:"SUBSCRIPTION_LOCATION_FILTER" default:"!inviteOnly,!temporary"`
+		CompressMinBytes              int    `envconfig:"COMPRESS_MIN_BYTES" default:"1024"`
+		NotifyOnRemoval               bool   `envconfig:"NOTIFY_ON_REMOVAL" default:"false"`
+		SubscriptionRules             string `envconfig:"SUBSCRIPTION_RULES"`
+		MongoDBMaxAttempts            int    `envconfig:"MONGODB_MAX_ATTEMPTS" default:"3"`
 	}
 
 	// PersonalConfig holds environment variables for personal mode
 	PersonalConfig struct {
-		ServiceType   string `envconfig:"SERVICE_TYPE" default:"Global Entry"`
-		LocationID    string `envconfig:"LOCATION_ID" required:"true"`
-		NtfyTopic     string `envconfig:"NTFY_TOPIC" required:"true"`
-		NtfyServer    string `envconfig:"NTFY_SERVER" default:"https://ntfy.sh"`
-		MinimumSlots  string `envconfig:"MINIMUM_SLOTS" default:"1"`
+		SharedConfig
+		ServiceType  string `envconfig:"SERVICE_TYPE" default:"Global Entry"`
+		LocationID   string `envconfig:"LOCATION_ID"`
+		NtfyTopic    string `envconfig:"NTFY_TOPIC" required:"true"`
+		NtfyServer   string `envconfig:"NTFY_SERVER" default:"https://ntfy.sh"`
+		MinimumSlots string `envconfig:"MINIMUM_SLOTS" default:"1"`
+		TargetDate   string `envconfig:"TARGET_DATE"`
+		DedupTable   string `envconfig:"DEDUP_TABLE"`
 	}
 
 	// AppMode represents the application mode and configuration
@@ -57,16 +140,46 @@ type (
 
 	// Subscription represents a subscription document
 	Subscription struct {
-		ID        string    `bson:"_id"`
-		Location  string    `bson:"location"`
-		NtfyTopic string    `bson:"ntfyTopic"`
-		CreatedAt time.Time `bson:"createdAt"`
+		ID             string    `bson:"_id"`
+		Location       string    `bson:"location"`
+		NtfyTopic      string    `bson:"ntfyTopic"`
+		CreatedAt      time.Time `bson:"createdAt"`
+		FailureCount   int       `bson:"failureCount,omitempty"`
+		TargetDate     string    `bson:"targetDate,omitempty"`
+		OneShot        bool      `bson:"oneShot,omitempty"`
+		ServiceType    string    `bson:"serviceType,omitempty"`
+		NotifiedExpiry bool      `bson:"notifiedExpiry,omitempty"` // Expiry notice already sent
+		Priority       int       `bson:"priority,omitempty"`
+		Tags           []string  `bson:"tags,omitempty"`
+		Locale         string    `bson:"locale,omitempty"`
 	}
 
 	// LocationTopics represents aggregated data: location and its ntfyTopics array
 	LocationTopics struct {
-		Location   string   `bson:"_id"`
-		NtfyTopics []string `bson:"ntfyTopics"`
+		Location    string       `bson:"_id"`
+		NtfyTopics  []string     `bson:"ntfyTopics"`
+		Subscribers []Subscriber `bson:"subscribers"`
+	}
+
+	// Subscriber is a topic to notify along with its subscription preferences
+	Subscriber struct {
+		Topic       string    `bson:"ntfyTopic"`
+		TargetDate  string    `bson:"targetDate,omitempty"`  // YYYY-MM-DD; only slots on or before it are notified
+		OneShot     bool      `bson:"oneShot,omitempty"`     // Unsubscribe after the first delivered alert
+		ServiceType string    `bson:"serviceType,omitempty"` // Empty means Global Entry
+		Priority    int       `bson:"priority,omitempty"`    // ntfy priority 1-5; zero uses the server default
+		Tags        []string  `bson:"tags,omitempty"`        // ntfy tags added to this subscription's alerts
+		Locale      string    `bson:"locale,omitempty"`      // Message catalog key; empty uses LOCALE
+		CreatedAt   time.Time `bson:"createdAt,omitempty"`   // Orders topics under MAX_NOTIFICATIONS_PER_RUN
+	}
+
+	// AvailabilityResult is the outcome of checking one location for one minimum
+	AvailabilityResult struct {
+		Found        bool
+		Appointments []Appointment   // Active slots, empty for asLocations scans
+		Notified     int             // Topics the alert was delivered (or queued) to
+		Decision     string          // Why the check did or didn't notify, for DEBUG_RESPONSE
+		Evaluated    []evaluatedSlot // Every parsed slot and the filter that dropped it, for DEBUG_RESPONSE
 	}
 
 	// Appointment from Global Entry API
@@ -79,11 +192,56 @@ type (
 		RemoteInd      bool   `json:"remoteInd"`
 	}
 
+	// Location from the TTP asLocations API
+	Location struct {
+		ID          int    `json:"id"`
+		Name        string `json:"name"`
+		ShortName   string `json:"shortName"`
+		City        string `json:"city"`
+		State       string `json:"state"`
+		CountryCode string `json:"countryCode"`
+		TimeZone    string `json:"tzData"`
+		Temporary   bool   `json:"temporary"`
+		InviteOnly  bool   `json:"inviteOnly"`
+		Operational bool   `json:"operational"`
+		RemoteInd   bool   `json:"remoteInd"`
+	}
+
+	// SubscriptionUpdate is a PATCH /subscriptions body. Nil fields are left unchanged.
+	SubscriptionUpdate struct {
+		Location   string    `json:"location"`
+		NtfyTopic  string    `json:"ntfyTopic"`
+		TargetDate *string   `json:"targetDate"`
+		OneShot    *bool     `json:"oneShot"`
+		Priority   *int      `json:"priority"`
+		Tags       *[]string `json:"tags"`
+		Locale     *string   `json:"locale"`
+	}
+
+	// subscriptionView is the API representation of a subscription
+	subscriptionView struct {
+		Location    string    `json:"location"`
+		NtfyTopic   string    `json:"ntfyTopic"`
+		ServiceType string    `json:"serviceType"`
+		TargetDate  string    `json:"targetDate,omitempty"`
+		OneShot     bool      `json:"oneShot,omitempty"`
+		Priority    int       `json:"priority,omitempty"`
+		Tags        []string  `json:"tags,omitempty"`
+		Locale      string    `json:"locale,omitempty"`
+		CreatedAt   time.Time `json:"createdAt"`
+	}
+
 	// SubscriptionRequest for registration/unsubscription
 	SubscriptionRequest struct {
-		Action    string `json:"action"` // "subscribe" or "unsubscribe"
-		Location  string `json:"location"`
-		NtfyTopic string `json:"ntfyTopic"`
+		Action      string   `json:"action"` // "subscribe" or "unsubscribe"
+		Location    string   `json:"location"`
+		NtfyTopic   string   `json:"ntfyTopic"`
+		TargetDate  string   `json:"targetDate,omitempty"`  // Optional YYYY-MM-DD deadline
+		OneShot     bool     `json:"oneShot,omitempty"`     // Unsubscribe after the first alert
+		ServiceType string   `json:"serviceType,omitempty"` // "Global Entry" (default) or "NEXUS"
+		Priority    int      `json:"priority,omitempty"`    // Optional ntfy priority 1 (min) to 5 (max)
+		Tags        []string `json:"tags,omitempty"`        // Optional ntfy tags, e.g. ["rotating_light"]
+		Locale      string   `json:"locale,omitempty"`      // Optional notification language, e.g. "es"
 	}
 
 	// LambdaHandler holds dependencies
@@ -92,26 +250,510 @@ type (
 		URL        string
 		Client     *mongo.Client
 		HTTPClient *http.Client
+		Notifier   Notifier  // Overrides the ntfy notifier built from config when set
+		TTP        TTPClient // Overrides the TTP HTTP client built from config when set
+		Locations  *LocationResolver
+		State      StateStore
+		Dedup      DedupStore
+		Deliveries DeliveryStore       // Dead-letter store for webhook events that exhausted their retries
+		Audit      AuditLogger         // Records subscription changes; nil disables auditing
+		History    AvailabilityHistory // Records check results for GET /history; nil disables it
+		Events     *SnsEventPublisher  // Publishes appointment events to SNS alongside the Notifier; nil disables it
+
+		breaker      *circuitBreaker
+		metrics      invocationMetrics
+		soonestLimit *keyRateLimiter
+		ntfyLimit    *tokenBucket // Shared by every ntfy send so warm invocations keep their budget
+		webhookLimit *tokenBucket
+		requestSlots chan struct{}
+		throttle     throttleTracker
+		schema       schemaTracker
+		background   sync.WaitGroup          // Checks started by subscribe requests; awaited before the invocation ends
+		validators   []subscriptionValidator // SUBSCRIPTION_RULES applied to subscribe requests
 	}
 )
 
+// ttpBaseURL is the host serving the TTP scheduler API
+const ttpBaseURL = "https://ttp.cbp.dhs.gov"
+
+// defaultSlotsPath is the TTP slots endpoint path used when SLOTS_PATH is unset
+const defaultSlotsPath = "/schedulerapi/slots"
+
+// Slot orderings accepted by ORDER_BY
+const (
+	orderBySoonest = "soonest"
+	orderByLatest  = "latest"
+)
+
+// defaultTTPMaxAttempts is the TTP attempt budget used when TTP_MAX_ATTEMPTS is unset
+const defaultTTPMaxAttempts = 3
+
+// locationCursorName names the cursor that rotates MAX_LOCATIONS_PER_RUN through all locations
+const locationCursorName = "locations"
+
+// maxSubscriptionTags caps how many ntfy tags a subscription can set
+const maxSubscriptionTags = 5
+
+// maxSoonestLocations caps how many locations one GET /soonest request checks against TTP
+const maxSoonestLocations = 10
+
+// expirySkewTolerance widens the expiry scan window to absorb container clock skew
+const expirySkewTolerance = time.Minute
+
+// dateLayout is the YYYY-MM-DD format used for target dates
+const dateLayout = "2006-01-02"
+
+// maxStartupJitter caps the startup delay well under the Lambda timeout
+const maxStartupJitter = 20 * time.Second
+
+// shared returns the configuration common to both modes
+func (m *AppMode) shared() *SharedConfig {
+	if m.IsPersonalMode {
+		return &m.PersonalConfig.SharedConfig
+	}
+	return &m.MultiUserConfig.SharedConfig
+}
+
+// slotsPath returns the configured slots path without a trailing slash
+func (c *SharedConfig) slotsPath() string {
+	if c.SlotsPath == "" {
+		return defaultSlotsPath
+	}
+	return strings.TrimSuffix(c.SlotsPath, "/")
+}
+
+// orderBy returns the configured slot ordering
+func (c *SharedConfig) orderBy() string {
+	if c.OrderBy == "" {
+		return orderBySoonest
+	}
+	return c.OrderBy
+}
+
+// maxNexusScanLimit caps NEXUS_SCAN_LIMIT so one asLocations response lists at most this many locations
+const maxNexusScanLimit = 50
+
+// defaultNexusScanLimit is the number of locations an asLocations scan returns when NEXUS_SCAN_LIMIT is unset
+const defaultNexusScanLimit = 5
+
+// nexusScanLimit returns how many locations a NEXUS asLocations scan asks for
+func (c *SharedConfig) nexusScanLimit() int {
+	if c.NexusScanLimit <= 0 {
+		return defaultNexusScanLimit
+	}
+	return c.NexusScanLimit
+}
+
+// dedupTTL returns how long sent notifications are remembered, or zero when dedup is disabled
+func (c *SharedConfig) dedupTTL() time.Duration {
+	return time.Duration(c.DedupTTLSeconds) * time.Second
+}
+
+// ttpMaxAttempts returns how many times a TTP call is tried before giving up
+func (c *SharedConfig) ttpMaxAttempts() int {
+	if c.TTPMaxAttempts <= 0 {
+		return defaultTTPMaxAttempts
+	}
+	return c.TTPMaxAttempts
+}
+
+// requestTimeout returns the per-request deadline for outbound calls, or zero for none
+func (c *SharedConfig) requestTimeout() time.Duration {
+	return time.Duration(c.RequestTimeoutSeconds) * time.Second
+}
+
+// validate checks the configuration common to both modes, returning one message per problem
+func (c *SharedConfig) validate() []string {
+	var problems []string
+	if c.DedupTTLSeconds < 0 {
+		problems = append(problems, fmt.Sprintf("DEDUP_TTL_SECONDS must not be negative, got %d", c.DedupTTLSeconds))
+	}
+	if c.RequestTimeoutSeconds < 0 {
+		problems = append(problems, fmt.Sprintf("REQUEST_TIMEOUT_SECONDS must not be negative, got %d", c.RequestTimeoutSeconds))
+	}
+	if c.SlotsPath != "" && !strings.HasPrefix(c.SlotsPath, "/") {
+		problems = append(problems, fmt.Sprintf("SLOTS_PATH must start with \"/\", got %q", c.SlotsPath))
+	}
+	if _, err := parseLocationFilter(c.LocationFilter); err != nil {
+		problems = append(problems, fmt.Sprintf("LOCATION_FILTER is invalid: %v", err))
+	}
+	if c.OrderBy != "" && c.OrderBy != orderBySoonest && c.OrderBy != orderByLatest {
+		problems = append(problems, fmt.Sprintf("ORDER_BY must be %q or %q, got %q", orderBySoonest, orderByLatest, c.OrderBy))
+	}
+	if err := validateLocale(c.Locale); err != nil {
+		problems = append(problems, fmt.Sprintf("LOCALE is invalid: %v", err))
+	}
+	if c.AdminNtfyTopic != "" && !validNtfyPattern.MatchString(c.AdminNtfyTopic) {
+		problems = append(problems, fmt.Sprintf("ADMIN_NTFY_TOPIC must not contain spaces or special characters, got %q", c.AdminNtfyTopic))
+	}
+	if c.SchemaAlertThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("SCHEMA_ALERT_THRESHOLD must not be negative, got %d", c.SchemaAlertThreshold))
+	}
+	if c.RateLimitAlertThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("RATE_LIMIT_ALERT_THRESHOLD must not be negative, got %d", c.RateLimitAlertThreshold))
+	}
+	if c.NexusScanLimit < 0 || c.NexusScanLimit > maxNexusScanLimit {
+		problems = append(problems, fmt.Sprintf("NEXUS_SCAN_LIMIT must be between 1 and %d, got %d", maxNexusScanLimit, c.NexusScanLimit))
+	}
+	if c.NexusScanMinimum < 0 {
+		problems = append(problems, fmt.Sprintf("NEXUS_SCAN_MINIMUM must not be negative, got %d", c.NexusScanMinimum))
+	}
+	if c.WebhookMaxAttempts < 0 {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_MAX_ATTEMPTS must not be negative, got %d", c.WebhookMaxAttempts))
+	}
+	if c.WebhookURL != "" && !strings.HasPrefix(c.WebhookURL, "https://") && !strings.HasPrefix(c.WebhookURL, "http://") {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_URL must be an http(s) URL, got %q", c.WebhookURL))
+	}
+	if _, err := parseCheckSchedule(c.CheckSchedule); err != nil {
+		problems = append(problems, fmt.Sprintf("CHECK_SCHEDULE is invalid: %v", err))
+	}
+	if _, err := c.scheduleLocation(); err != nil {
+		problems = append(problems, fmt.Sprintf("CHECK_SCHEDULE_TIMEZONE must be an IANA time zone such as America/New_York, got %q", c.CheckScheduleTimezone))
+	}
+	if c.DailySummaryTime != "" {
+		if _, err := parseClock(c.DailySummaryTime); err != nil {
+			problems = append(problems, fmt.Sprintf("DAILY_SUMMARY_TIME is invalid: %v", err))
+		}
+	}
+	if _, err := c.summaryTimezone(); err != nil {
+		problems = append(problems, fmt.Sprintf("DAILY_SUMMARY_TIMEZONE must be an IANA time zone such as America/New_York, got %q", c.DailySummaryTimezone))
+	}
+	if c.MaxRetryDuration < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_RETRY_DURATION must not be negative, got %s", c.MaxRetryDuration))
+	}
+	if _, err := parseEventSources(c.ScheduleEventSources); err != nil {
+		problems = append(problems, fmt.Sprintf("SCHEDULE_EVENT_SOURCES is invalid: %v", err))
+	}
+	if c.EscalateAfter < 0 {
+		problems = append(problems, fmt.Sprintf("ESCALATE_AFTER must not be negative, got %d", c.EscalateAfter))
+	}
+	if c.EscalationPolicy != "" && c.EscalationPolicy != escalateUrgent && c.EscalationPolicy != escalateBackoff {
+		problems = append(problems, fmt.Sprintf("ESCALATION_POLICY must be %q or %q, got %q", escalateUrgent, escalateBackoff, c.EscalationPolicy))
+	}
+	if c.LocationsCacheTTL < 0 {
+		problems = append(problems, fmt.Sprintf("LOCATIONS_CACHE_TTL must not be negative, got %s", c.LocationsCacheTTL))
+	}
+	if c.SlotSurgeThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("SLOT_SURGE_THRESHOLD must not be negative, got %d", c.SlotSurgeThreshold))
+	}
+	if c.SlotSurgeRearmBelow < 0 || (c.SlotSurgeRearmBelow > 0 && c.SlotSurgeRearmBelow > c.SlotSurgeThreshold) {
+		problems = append(problems, fmt.Sprintf("SLOT_SURGE_REARM_BELOW must be between 0 and SLOT_SURGE_THRESHOLD, got %d", c.SlotSurgeRearmBelow))
+	}
+	if c.MinLeadTime < 0 {
+		problems = append(problems, fmt.Sprintf("MIN_LEAD_TIME must not be negative, got %s", c.MinLeadTime))
+	}
+	if c.LogTopicRedaction != "" && c.LogTopicRedaction != logTopicsHash && c.LogTopicRedaction != logTopicsRedact {
+		problems = append(problems, fmt.Sprintf("LOG_TOPIC_REDACTION must be %q or %q, got %q", logTopicsHash, logTopicsRedact, c.LogTopicRedaction))
+	}
+	if _, err := parseRateLimit(c.NtfyRateLimit); err != nil {
+		problems = append(problems, fmt.Sprintf("NTFY_RATE_LIMIT is invalid: %v", err))
+	}
+	if _, err := parseRateLimit(c.WebhookRateLimit); err != nil {
+		problems = append(problems, fmt.Sprintf("WEBHOOK_RATE_LIMIT is invalid: %v", err))
+	}
+	if err := validateSNSTopicARN(c.SNSTopicARN); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateBookingURLTemplate(c.BookingURLTemplate); err != nil {
+		problems = append(problems, fmt.Sprintf("BOOKING_URL_TEMPLATE is invalid: %v", err))
+	}
+	if c.NtfyFormat != "" && c.NtfyFormat != NtfyFormatJSON && c.NtfyFormat != NtfyFormatHeaders {
+		problems = append(problems, fmt.Sprintf("NTFY_FORMAT must be %q or %q, got %q", NtfyFormatJSON, NtfyFormatHeaders, c.NtfyFormat))
+	}
+	return problems
+}
+
+// validate checks the personal mode settings, including values derived from several variables
+func (c *PersonalConfig) validate() []string {
+	problems := c.SharedConfig.validate()
+	if c.TargetDate != "" {
+		if _, err := time.Parse(dateLayout, c.TargetDate); err != nil {
+			problems = append(problems, fmt.Sprintf("TARGET_DATE must be a date in YYYY-MM-DD format, got %q", c.TargetDate))
+		}
+	}
+	serviceTypes := parseServiceTypes(c.ServiceType)
+	if _, err := parseServiceMinimums(serviceTypes, c.MinimumSlots); err != nil {
+		problems = append(problems, fmt.Sprintf("MINIMUM_SLOTS %v, got %q", err, c.MinimumSlots))
+	}
+	locations := parseServiceLocations(serviceTypes, c.LocationID)
+	for _, serviceType := range serviceTypes {
+		// NEXUS can scan all locations via asLocations when no location is given
+		if locations[serviceType] == "" && serviceType != "NEXUS" {
+			problems = append(problems, fmt.Sprintf("LOCATION_ID is required for %s", serviceType))
+		}
+	}
+	return problems
+}
+
+// validate checks the multi-user mode settings
+func (c *Config) validate() []string {
+	problems := c.SharedConfig.validate()
+	if _, err := c.aggregationReadPref(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := c.writeConcern(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := c.readConcern(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.MaxSubscriptionsPerTopic < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_SUBSCRIPTIONS_PER_TOPIC must not be negative, got %d", c.MaxSubscriptionsPerTopic))
+	}
+	if _, err := parseLocationIntervals(c.LocationCheckIntervals); err != nil {
+		problems = append(problems, fmt.Sprintf("LOCATION_CHECK_INTERVALS is invalid: %v", err))
+	}
+	if c.AvailabilityHistoryDays < 0 {
+		problems = append(problems, fmt.Sprintf("AVAILABILITY_HISTORY_DAYS must not be negative, got %d", c.AvailabilityHistoryDays))
+	}
+	if _, err := parseLocationFilter(c.SubscriptionLocationFilter); err != nil {
+		problems = append(problems, fmt.Sprintf("SUBSCRIPTION_LOCATION_FILTER is invalid: %v", err))
+	}
+	if _, err := parseSubscriptionRules(c.SubscriptionRules); err != nil {
+		problems = append(problems, fmt.Sprintf("SUBSCRIPTION_RULES is invalid: %v", err))
+	}
+	if c.MongoDBMaxAttempts < 0 {
+		problems = append(problems, fmt.Sprintf("MONGODB_MAX_ATTEMPTS must not be negative, got %d", c.MongoDBMaxAttempts))
+	}
+	if c.CompressMinBytes < 0 {
+		problems = append(problems, fmt.Sprintf("COMPRESS_MIN_BYTES must not be negative, got %d", c.CompressMinBytes))
+	}
+	if c.MaxNotificationsPerRun < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_NOTIFICATIONS_PER_RUN must not be negative, got %d", c.MaxNotificationsPerRun))
+	}
+	if c.AuditLog && c.AuditRetentionDays <= 0 {
+		problems = append(problems, fmt.Sprintf("AUDIT_RETENTION_DAYS must be positive when AUDIT_LOG is set, got %d", c.AuditRetentionDays))
+	}
+	return problems
+}
+
+// configExpectations describes the format envconfig expects for each field type
+var configExpectations = map[string]string{
+	"int":           "a whole number such as 5",
+	"bool":          "true or false",
+	"time.Duration": "a duration such as 24h",
+}
+
+// describeConfigError rewrites envconfig errors to name the variable and the expected format
+func describeConfigError(err error) error {
+	var parseErr *envconfig.ParseError
+	if errors.As(err, &parseErr) {
+		expected, ok := configExpectations[parseErr.TypeName]
+		if !ok {
+			expected = "a " + parseErr.TypeName
+		}
+		return fmt.Errorf("%s must be %s, got %q", parseErr.KeyName, expected, parseErr.Value)
+	}
+	if key, ok := strings.CutPrefix(err.Error(), "required key "); ok {
+		return fmt.Errorf("%s is required but not set", strings.TrimSuffix(key, " missing value"))
+	}
+	return err
+}
+
+// configProblemsError combines validation problems into one error, or nil when there are none
+func configProblemsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
 // NewLambdaHandler creates a new LambdaHandler
 func NewLambdaHandler(mode *AppMode, url string, client *mongo.Client) *LambdaHandler {
-	return &LambdaHandler{
+	h := &LambdaHandler{
 		Mode:   mode,
 		URL:    url,
 		Client: client,
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		breaker:      newCircuitBreaker(0, 0),
+		soonestLimit: newKeyRateLimiter(0),
+	}
+	// Limits are validated at startup, so parse errors leave the notifier unlimited
+	h.ntfyLimit, _ = parseRateLimit(mode.shared().NtfyRateLimit)
+	h.webhookLimit, _ = parseRateLimit(mode.shared().WebhookRateLimit)
+	h.Locations = NewLocationResolver(h.HTTPClient)
+	h.Locations.Timeout = mode.shared().requestTimeout()
+	h.Locations.MaxAttempts = mode.shared().ttpMaxAttempts()
+	h.Locations.TTL = mode.shared().LocationsCacheTTL // Zero turns the cache off
+	h.State = newMemoryStateStore()
+	h.Dedup = newMemoryDedupStore()
+	h.Deliveries = newMemoryDeliveryStore()
+	if !mode.IsPersonalMode && client != nil {
+		db := client.Database("global-entry-appointment-db")
+		h.State = newMongoStateStore(db.Collection("availability_state"))
+		h.Dedup = newMongoDedupStore(db.Collection("notification_dedup"))
+		if config := mode.MultiUserConfig; config.AuditLog {
+			h.Audit = newMongoAuditLogger(db.Collection("audit_log"), time.Duration(config.AuditRetentionDays)*24*time.Hour)
+		}
+		if config := mode.MultiUserConfig; config.AvailabilityHistory {
+			h.History = newMongoAvailabilityHistory(h.historyCollection(), time.Duration(config.historyRetentionDays())*24*time.Hour)
+		}
+	}
+	if !mode.IsPersonalMode {
+		config := mode.MultiUserConfig
+		h.breaker = newCircuitBreaker(config.CircuitBreakerThreshold, time.Duration(config.CircuitBreakerCooldownSeconds)*time.Second)
+		h.soonestLimit = newKeyRateLimiter(time.Duration(config.SoonestIntervalSeconds) * time.Second)
+		if config.MaxConcurrentRequests > 0 {
+			h.requestSlots = make(chan struct{}, config.MaxConcurrentRequests)
+		}
+		// Rules are validated at startup, so parse errors leave subscriptions unrestricted
+		h.validators, _ = parseSubscriptionRules(config.SubscriptionRules)
+	}
+	return h
+}
+
+// subscriptions returns the subscriptions collection with MONGODB_WRITE_CONCERN and
+// MONGODB_READ_CONCERN applied (multi-user mode only)
+func (h *LambdaHandler) subscriptions() *mongo.Collection {
+	return h.Client.Database("global-entry-appointment-db").Collection("subscriptions", h.subscriptionsOptions())
+}
+
+// ensureSubscriptionIndex creates the unique (location, ntfyTopic) index that stops concurrent
+// subscribe requests from inserting duplicates. Creating an existing identical index is a no-op,
+// so this is safe on every cold start; it fails while duplicates from before the index remain.
+func (h *LambdaHandler) ensureSubscriptionIndex(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "location", Value: 1}, {Key: "ntfyTopic", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := h.subscriptions().Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create unique subscription index: %v", err)
+	}
+	return nil
+}
+
+// aggregationSubscriptions returns the subscriptions collection with AGGREGATION_READ_PREFERENCE
+// applied, for the read-heavy availability aggregation. Writes keep using subscriptions().
+func (h *LambdaHandler) aggregationSubscriptions() *mongo.Collection {
+	rp, err := h.Mode.MultiUserConfig.aggregationReadPref()
+	if err != nil {
+		rp = readpref.Primary() // Rejected at startup; fall back for handlers built in tests
+	}
+	opts := h.subscriptionsOptions().SetReadPreference(rp)
+	return h.Client.Database("global-entry-appointment-db").Collection("subscriptions", opts)
+}
+
+// subscriptionsOptions returns the configured concerns; unset or invalid ones keep the client defaults
+func (h *LambdaHandler) subscriptionsOptions() *options.CollectionOptionsBuilder {
+	opts := options.Collection()
+	config := h.Mode.MultiUserConfig
+	if wc, err := config.writeConcern(); err == nil && wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+	if rc, err := config.readConcern(); err == nil && rc != nil {
+		opts.SetReadConcern(rc)
+	}
+	return opts
+}
+
+// writeConcern parses MONGODB_WRITE_CONCERN, returning nil when unset to keep the client default
+func (c *Config) writeConcern() (*writeconcern.WriteConcern, error) {
+	if c.MongoDBWriteConcern == "" {
+		return nil, nil
+	}
+	if c.MongoDBWriteConcern == "majority" {
+		return writeconcern.Majority(), nil
+	}
+	// Unacknowledged writes (w=0) are rejected: unsubscribe relies on the deleted count
+	if n, err := strconv.Atoi(c.MongoDBWriteConcern); err == nil && n > 0 {
+		return &writeconcern.WriteConcern{W: n}, nil
+	}
+	return nil, fmt.Errorf("MONGODB_WRITE_CONCERN must be majority or a positive number of nodes such as 1, got %q", c.MongoDBWriteConcern)
+}
+
+// readConcern parses MONGODB_READ_CONCERN, returning nil when unset to keep the client default
+func (c *Config) readConcern() (*readconcern.ReadConcern, error) {
+	switch c.MongoDBReadConcern {
+	case "":
+		return nil, nil
+	case "local":
+		return readconcern.Local(), nil
+	case "available":
+		return readconcern.Available(), nil
+	case "majority":
+		return readconcern.Majority(), nil
+	case "linearizable":
+		return readconcern.Linearizable(), nil
+	}
+	return nil, fmt.Errorf("MONGODB_READ_CONCERN must be local, available, majority or linearizable, got %q", c.MongoDBReadConcern)
+}
+
+// aggregationReadPref parses AGGREGATION_READ_PREFERENCE, defaulting to primary
+func (c *Config) aggregationReadPref() (*readpref.ReadPref, error) {
+	if c.AggregationReadPreference == "" {
+		return readpref.Primary(), nil
+	}
+	mode, err := readpref.ModeFromString(c.AggregationReadPreference)
+	if err != nil {
+		return nil, fmt.Errorf("AGGREGATION_READ_PREFERENCE must be primary, primaryPreferred, secondary, secondaryPreferred or nearest, got %q", c.AggregationReadPreference)
+	}
+	return readpref.New(mode)
+}
+
+// acquireRequestSlot reserves capacity for an API request, returning a 503 response when the
+// circuit breaker is open or too many requests are in flight
+func (h *LambdaHandler) acquireRequestSlot() (events.APIGatewayV2HTTPResponse, bool) {
+	if wait := h.breaker.retryAfter(); wait > 0 {
+		slog.Warn("Circuit breaker open, rejecting request", "retryAfter", wait.String())
+		return serviceUnavailableResponse(retryAfterSeconds(wait)), false
+	}
+	if h.requestSlots == nil {
+		return events.APIGatewayV2HTTPResponse{}, true
+	}
+	select {
+	case h.requestSlots <- struct{}{}:
+		return events.APIGatewayV2HTTPResponse{}, true
+	default:
+		slog.Warn("Too many concurrent requests, rejecting request", "limit", cap(h.requestSlots))
+		return serviceUnavailableResponse(1), false
+	}
+}
+
+// releaseRequestSlot frees capacity reserved by acquireRequestSlot
+func (h *LambdaHandler) releaseRequestSlot() {
+	if h.requestSlots != nil {
+		<-h.requestSlots
 	}
 }
 
+// serviceUnavailableResponse builds a 503 response asking the client to back off
+func serviceUnavailableResponse(retryAfter int) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 503,
+		Headers:    retryAfterHeaders(retryAfter),
+		Body:       `{"error": "service temporarily unavailable, please retry later"}`,
+	}
+}
+
+// tooManyRequestsResponse builds a 429 response asking the client to slow down
+func tooManyRequestsResponse(retryAfter int) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 429,
+		Headers:    retryAfterHeaders(retryAfter),
+		Body:       `{"error": "too many requests, please retry later"}`,
+	}
+}
+
+// retryAfterHeaders copies the CORS headers and adds Retry-After
+func retryAfterHeaders(retryAfter int) map[string]string {
+	headers := make(map[string]string, len(corsHeaders)+1)
+	for k, v := range corsHeaders {
+		headers[k] = v
+	}
+	headers["Retry-After"] = strconv.Itoa(retryAfter)
+	return headers
+}
+
 // detectAppMode determines if we're running in personal or multi-user mode
 func detectAppMode() (*AppMode, error) {
 	if os.Getenv("PERSONAL_MODE") == "true" {
 		var personalConfig PersonalConfig
 		if err := envconfig.Process("", &personalConfig); err != nil {
+			return nil, fmt.Errorf("failed to load personal config: %v", describeConfigError(err))
+		}
+		if err := configProblemsError(personalConfig.validate()); err != nil {
 			return nil, fmt.Errorf("failed to load personal config: %v", err)
 		}
 		return &AppMode{
@@ -123,6 +765,9 @@ func detectAppMode() (*AppMode, error) {
 	// Multi-user mode
 	var multiUserConfig Config
 	if err := envconfig.Process("", &multiUserConfig); err != nil {
+		return nil, fmt.Errorf("failed to load multi-user config: %v", describeConfigError(err))
+	}
+	if err := configProblemsError(multiUserConfig.validate()); err != nil {
 		return nil, fmt.Errorf("failed to load multi-user config: %v", err)
 	}
 	return &AppMode{
@@ -147,150 +792,821 @@ func parseMinimumSlots(minimumSlots string) []int {
 	return result
 }
 
+// parseServiceTypes parses comma-separated service types into a slice of known service names
+func parseServiceTypes(serviceTypes string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(serviceTypes, ",") {
+		service, ok := normalizeServiceType(part)
+		if !ok {
+			continue
+		}
+		if !seen[service] {
+			seen[service] = true
+			result = append(result, service)
+		}
+	}
+	if len(result) == 0 {
+		result = []string{"Global Entry"} // default to Global Entry if no valid values
+	}
+	return result
+}
+
+// normalizeServiceType returns the canonical name for a service type, matched case-insensitively
+func normalizeServiceType(serviceType string) (string, bool) {
+	serviceType = strings.TrimSpace(serviceType)
+	switch {
+	case strings.EqualFold(serviceType, "Global Entry"):
+		return "Global Entry", true
+	case strings.EqualFold(serviceType, "NEXUS"):
+		return "NEXUS", true
+	}
+	return "", false
+}
+
+// subscriptionServiceType returns a subscription's service type, defaulting to Global Entry
+// for subscriptions created before service types were stored
+func subscriptionServiceType(serviceType string) string {
+	if serviceType == "" {
+		return "Global Entry"
+	}
+	return serviceType
+}
+
+// serviceSubscribers holds the subscribers of one service type at a location
+type serviceSubscribers struct {
+	ServiceType string
+	Subscribers []Subscriber
+}
+
+// groupSubscribersByService splits a location's subscribers by service type, in first-seen order
+func groupSubscribersByService(subscribers []Subscriber) []serviceSubscribers {
+	var groups []serviceSubscribers
+	index := make(map[string]int)
+	for _, sub := range subscribers {
+		service := subscriptionServiceType(sub.ServiceType)
+		i, ok := index[service]
+		if !ok {
+			i = len(groups)
+			index[service] = i
+			groups = append(groups, serviceSubscribers{ServiceType: service})
+		}
+		groups[i].Subscribers = append(groups[i].Subscribers, sub)
+	}
+	return groups
+}
+
+// parseServiceLocations maps each service type to its location ID. A plain value
+// (e.g. "5300") is shared by all services, while "Global Entry=5300,NEXUS=5020"
+// assigns a location per service.
+func parseServiceLocations(serviceTypes []string, locationID string) map[string]string {
+	result := make(map[string]string)
+	if !strings.Contains(locationID, "=") {
+		for _, service := range serviceTypes {
+			result[service] = strings.TrimSpace(locationID)
+		}
+		return result
+	}
+	for _, part := range strings.Split(locationID, ",") {
+		service, location, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		for _, known := range serviceTypes {
+			if strings.EqualFold(strings.TrimSpace(service), known) {
+				result[known] = strings.TrimSpace(location)
+			}
+		}
+	}
+	return result
+}
+
+// errMinimumSlotsFormat describes the MINIMUM_SLOTS formats
+var errMinimumSlotsFormat = errors.New(`must be positive whole numbers separated by commas, e.g. "1", "1,2" or "Global Entry=2,NEXUS=1"`)
+
+// parseServiceMinimums maps each service type to the minimums it is checked with. A plain list
+// (e.g. "1,2") applies to every service, while "Global Entry=2,3,NEXUS=1" sets them per service:
+// values after a service name belong to it until the next name. Services left out of a
+// per-service list are checked with a minimum of 1.
+func parseServiceMinimums(serviceTypes []string, minimumSlots string) (map[string][]int, error) {
+	var plain []int
+	perService := make(map[string][]int)
+	current := ""
+	for _, part := range strings.Split(minimumSlots, ",") {
+		value := part
+		if name, rest, ok := strings.Cut(part, "="); ok {
+			service, known := normalizeServiceType(name)
+			if !known {
+				return nil, fmt.Errorf(`names unknown service %q; use "Global Entry" or "NEXUS"`, strings.TrimSpace(name))
+			}
+			current, value = service, rest
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return nil, errMinimumSlotsFormat
+		}
+		switch {
+		case current != "":
+			perService[current] = append(perService[current], n)
+		case len(perService) > 0:
+			return nil, errMinimumSlotsFormat
+		default:
+			plain = append(plain, n)
+		}
+	}
+	if len(plain) > 0 && len(perService) > 0 {
+		return nil, errMinimumSlotsFormat // "1,NEXUS=2" mixes both forms
+	}
+	result := make(map[string][]int, len(serviceTypes))
+	for _, service := range serviceTypes {
+		switch {
+		case len(plain) > 0:
+			result[service] = plain
+		case len(perService[service]) > 0:
+			result[service] = perService[service]
+		default:
+			result[service] = []int{1}
+		}
+	}
+	return result, nil
+}
+
+// startupJitter returns a random delay between 0 and maxSeconds, capped at maxStartupJitter
+func startupJitter(maxSeconds int) time.Duration {
+	if maxSeconds <= 0 {
+		return 0
+	}
+	limit := time.Duration(maxSeconds) * time.Second
+	if limit > maxStartupJitter {
+		limit = maxStartupJitter
+	}
+	return rand.N(limit + 1)
+}
+
+// waitStartupJitter sleeps for a random delay so independent deployments don't all hit CBP at the top of the minute
+func (h *LambdaHandler) waitStartupJitter(ctx context.Context) {
+	delay := startupJitter(h.Mode.shared().StartupJitterSeconds)
+	if delay == 0 {
+		return
+	}
+	slog.Info("Delaying scheduled check", "delay", delay.String())
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// withRequestTimeout derives a per-request deadline from ctx; a parent deadline that is sooner still applies
+func withRequestTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// subscribersForTopics wraps plain topics as subscribers without preferences
+func subscribersForTopics(topics []string) []Subscriber {
+	subscribers := make([]Subscriber, 0, len(topics))
+	for _, topic := range topics {
+		subscribers = append(subscribers, Subscriber{Topic: topic})
+	}
+	return subscribers
+}
+
+// subscribersForSlot returns the subscribers whose target date, if any, is on or after the slot date
+func subscribersForSlot(subscribers []Subscriber, startTimestamp string) []Subscriber {
+	slotDate := startTimestamp
+	if len(slotDate) > len(dateLayout) {
+		slotDate = slotDate[:len(dateLayout)]
+	}
+	var result []Subscriber
+	for _, sub := range subscribers {
+		// ISO dates compare correctly as strings
+		if sub.TargetDate == "" || slotDate <= sub.TargetDate {
+			result = append(result, sub)
+		}
+	}
+	return result
+}
+
+// targetDatePassed reports whether a YYYY-MM-DD target date is before today (UTC)
+func targetDatePassed(targetDate string, now time.Time) bool {
+	return targetDate != "" && targetDate < now.UTC().Format(dateLayout)
+}
+
+// validateTargetDate checks that a target date is a YYYY-MM-DD date that hasn't passed
+func validateTargetDate(targetDate string, now time.Time) error {
+	if _, err := time.Parse(dateLayout, targetDate); err != nil {
+		return fmt.Errorf("targetDate must be a date in YYYY-MM-DD format")
+	}
+	if targetDatePassed(targetDate, now) {
+		return fmt.Errorf("targetDate must not be in the past")
+	}
+	return nil
+}
+
+// validateNotificationPreferences checks optional per-subscription ntfy priority and tags
+func validateNotificationPreferences(priority int, tags []string) error {
+	if priority < 0 || priority > 5 {
+		return fmt.Errorf("priority must be between 1 and 5")
+	}
+	if len(tags) > maxSubscriptionTags {
+		return fmt.Errorf("at most %d tags are allowed", maxSubscriptionTags)
+	}
+	for _, tag := range tags {
+		if !validNtfyPattern.MatchString(tag) {
+			return fmt.Errorf("tags must not contain spaces or special characters")
+		}
+	}
+	return nil
+}
+
 // getAppointmentURL returns the API URL for checking appointments
-func getAppointmentURL(serviceType, locationID string, minimum int) string {
+func getAppointmentURL(cfg *SharedConfig, serviceType, locationID string, minimum int) string {
+	return appointmentURL(cfg, serviceType, locationID, minimum, cfg.orderBy(), cfg.slotsLimit())
+}
+
+// soonestSlotsLimit is the fewest slots a soonest query asks for, so stale or inactive
+// entries at the head of the list don't hide the next bookable slot
+const soonestSlotsLimit = 10
+
+// getSoonestAppointmentURL returns the API URL listing a location's earliest slots whatever
+// ORDER_BY says, with enough of them to survive the filters checks apply
+func getSoonestAppointmentURL(cfg *SharedConfig, serviceType, locationID string, minimum int) string {
+	return appointmentURL(cfg, serviceType, locationID, minimum, orderBySoonest, max(cfg.slotsLimit(), soonestSlotsLimit))
+}
+
+// appointmentURL builds a slots API URL with the given ordering and page size
+func appointmentURL(cfg *SharedConfig, serviceType, locationID string, minimum int, orderBy string, limit int) string {
+	slotsURL := ttpBaseURL + cfg.slotsPath()
 	if serviceType == "NEXUS" {
 		if locationID == "" {
 			// Use asLocations endpoint for multiple locations
-			return fmt.Sprintf("https://ttp.cbp.dhs.gov/schedulerapi/slots/asLocations?minimum=%d&limit=5&serviceName=NEXUS", minimum)
+			return fmt.Sprintf("%s/asLocations?minimum=%d&limit=%d&serviceName=NEXUS", slotsURL, minimum, cfg.nexusScanLimit())
 		}
 		// NEXUS uses the same slots endpoint as Global Entry
-		return fmt.Sprintf("https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=soonest&limit=1&locationId=%s&minimum=%d", locationID, minimum)
+		return fmt.Sprintf("%s?orderBy=%s&limit=%d&locationId=%s&minimum=%d", slotsURL, orderBy, limit, locationID, minimum)
 	}
 	// Default to Global Entry
-	return fmt.Sprintf("https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=soonest&limit=1&locationId=%s&minimum=%d", locationID, minimum)
+	return fmt.Sprintf("%s?orderBy=%s&limit=%d&locationId=%s&minimum=%d", slotsURL, orderBy, limit, locationID, minimum)
 }
 
 // getNotificationTitle returns service-specific notification title
-func getNotificationTitle(serviceType string) string {
-	return fmt.Sprintf("%s Appointment Notification", serviceType)
+func getNotificationTitle(serviceType, locale string) string {
+	return fmt.Sprintf(messagesFor(locale).NotificationTitle, serviceType)
 }
 
 // getExpirationTitle returns service-specific expiration title
-func getExpirationTitle(serviceType string) string {
-	return fmt.Sprintf("%s Subscription Expired", serviceType)
+func getExpirationTitle(serviceType, locale string) string {
+	return fmt.Sprintf(messagesFor(locale).ExpirationTitle, serviceType)
 }
 
 // getExpirationMessage returns service-specific expiration message
-func getExpirationMessage(serviceType string) string {
-	return fmt.Sprintf("Your %s appointment subscription has expired.", serviceType)
+func getExpirationMessage(serviceType, locale string) string {
+	return fmt.Sprintf(messagesFor(locale).ExpirationMessage, serviceType)
 }
 
 // checkAvailabilityAndNotify checks appointment availability and notifies topics
 func (h *LambdaHandler) checkAvailabilityAndNotify(ctx context.Context, serviceType, location string, topics []string) error {
-	return h.checkAvailabilityAndNotifyWithMinimums(ctx, serviceType, location, topics, []int{1})
+	return h.checkAvailabilityAndNotifyWithMinimums(ctx, serviceType, location, subscribersForTopics(topics), []int{1})
 }
 
 // checkAvailabilityAndNotifyWithMinimums checks appointment availability with multiple minimum values
-func (h *LambdaHandler) checkAvailabilityAndNotifyWithMinimums(ctx context.Context, serviceType, location string, topics []string, minimums []int) error {
+func (h *LambdaHandler) checkAvailabilityAndNotifyWithMinimums(ctx context.Context, serviceType, location string, subscribers []Subscriber, minimums []int) error {
+	if !h.locationMatchesFilter(ctx, serviceType, location) {
+		slog.Info("Skipping location excluded by filter", "service", serviceType, "location", location)
+		debugTraceFromContext(ctx).record(debugCheck{Service: serviceType, Location: location, Decision: checkFiltered})
+		return nil
+	}
 	var lastErr error
 	for _, minimum := range minimums {
-		found, err := h.checkSingleMinimum(ctx, serviceType, location, topics, minimum)
+		result, err := h.checkSingleMinimum(ctx, serviceType, location, subscribers, minimum)
+		debugTraceFromContext(ctx).recordResult(serviceType, location, minimum, result, err)
+		if result.Found {
+			h.recordObservation(ctx, serviceType, location, len(result.Appointments))
+			h.checkSlotSurge(ctx, serviceType, location, subscribers, len(result.Appointments))
+			// Queued alerts save availability once the batch delivers them
+			if err == nil && (result.Notified == 0 || batchFromContext(ctx) == nil) {
+				h.recordAvailability(ctx, serviceType, location, true)
+			}
+			return err // Found appointments, no need to check other minimums
+		}
 		if err != nil {
 			slog.Error("Failed to check minimum", "minimum", minimum, "error", err)
 			lastErr = err
 			continue
 		}
-		if found {
-			return nil // Found appointments, no need to check other minimums
-		}
 	}
 	// If all minimums failed with errors, return the last error
 	if lastErr != nil {
 		return lastErr
 	}
+	h.recordObservation(ctx, serviceType, location, 0)
+	h.checkSlotSurge(ctx, serviceType, location, subscribers, 0)
+	h.recordAvailability(ctx, serviceType, location, false) // Re-arm transition notifications
 	return nil
 }
 
+// suppressedByTransition reports whether notifications should be skipped because the location
+// was already available on the previous check (NOTIFY_ON_TRANSITION only)
+func (h *LambdaHandler) suppressedByTransition(ctx context.Context, serviceType, location string) bool {
+	if !h.Mode.shared().NotifyOnTransition || isImmediateCheck(ctx) {
+		return false
+	}
+	state, err := h.State.Get(ctx, stateKey(serviceType, location))
+	if err != nil {
+		slog.Warn("Failed to load availability state", "service", serviceType, "location", location, "error", err)
+		return false
+	}
+	return state.Available
+}
+
+// recordAvailability saves whether the location currently has availability (NOTIFY_ON_TRANSITION only)
+func (h *LambdaHandler) recordAvailability(ctx context.Context, serviceType, location string, available bool) {
+	if !h.Mode.shared().NotifyOnTransition || isImmediateCheck(ctx) {
+		return
+	}
+	state := LocationState{Available: available, UpdatedAt: time.Now().UTC()}
+	if err := h.State.Put(ctx, stateKey(serviceType, location), state); err != nil {
+		slog.Warn("Failed to save availability state", "service", serviceType, "location", location, "error", err)
+	}
+}
+
+// parseAppointments decodes a TTP slots response, dropping repeated slots with the same
+// StartTimestamp that the API occasionally returns
+func parseAppointments(body []byte) ([]Appointment, error) {
+	var appointments []Appointment
+	if err := json.Unmarshal(body, &appointments); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	seen := make(map[string]bool, len(appointments))
+	unique := appointments[:0]
+	for _, appt := range appointments {
+		if seen[appt.StartTimestamp] {
+			continue
+		}
+		seen[appt.StartTimestamp] = true
+		unique = append(unique, appt)
+	}
+	return unique, nil
+}
+
+// locationMatchesFilter reports whether a location satisfies LOCATION_FILTER. Locations pass
+// when no filter is set or their metadata can't be resolved, so a metadata outage never hides slots.
+func (h *LambdaHandler) locationMatchesFilter(ctx context.Context, serviceType, location string) bool {
+	filter, _ := parseLocationFilter(h.Mode.shared().LocationFilter)
+	if len(filter) == 0 || location == "" {
+		return true
+	}
+	loc, ok, err := h.Locations.Resolve(ctx, serviceType, location)
+	if err != nil {
+		slog.Warn("Failed to resolve location metadata", "service", serviceType, "location", location, "error", err)
+		return true
+	}
+	if !ok {
+		slog.Warn("Location not found in metadata", "service", serviceType, "location", location)
+		return true
+	}
+	return filter.Matches(loc)
+}
+
+// unbookableLocation returns why SUBSCRIPTION_LOCATION_FILTER rejects a location, or "" when it
+// is accepted. Unknown locations and metadata outages are accepted, as with LOCATION_FILTER.
+func (h *LambdaHandler) unbookableLocation(ctx context.Context, serviceType, location string) string {
+	filter, _ := parseLocationFilter(h.Mode.MultiUserConfig.SubscriptionLocationFilter)
+	if len(filter) == 0 {
+		return ""
+	}
+	loc, ok, err := h.Locations.Resolve(ctx, serviceType, location)
+	if err != nil {
+		slog.Warn("Failed to resolve location metadata, accepting subscription", "service", serviceType, "location", location, "error", err)
+		return ""
+	}
+	if !ok {
+		return ""
+	}
+	return filter.Mismatch(loc)
+}
+
 // checkSingleMinimum checks availability for a single minimum value
-func (h *LambdaHandler) checkSingleMinimum(ctx context.Context, serviceType, location string, topics []string, minimum int) (bool, error) {
-	// Retry logic for API call
-	for attempt := 1; attempt <= 3; attempt++ {
-		var apiURL string
-		if h.URL != "" {
-			// Use provided URL (for testing)
-			apiURL = fmt.Sprintf(h.URL, location)
-		} else {
-			// Use real API URL
-			apiURL = getAppointmentURL(serviceType, location, minimum)
+func (h *LambdaHandler) checkSingleMinimum(ctx context.Context, serviceType, location string, subscribers []Subscriber, minimum int) (AvailabilityResult, error) {
+	h.metrics.checks.Add(1)
+	body, err := h.ttp().FetchSlots(ctx, serviceType, location, minimum)
+	if !isImmediateCheck(ctx) {
+		h.throttle.record(err) // On-subscribe checks aren't part of a run's rate-limit streak
+	}
+	if err != nil {
+		h.metrics.errors.Add(1)
+		return AvailabilityResult{}, err
+	}
+
+	if serviceType == "NEXUS" && location == "" {
+		h.checkResponseSchema(ctx, serviceType, location, body, requiredLocationFields)
+		return h.notifyAvailableLocations(ctx, serviceType, body, subscribers, minimum)
+	}
+	h.checkResponseSchema(ctx, serviceType, location, body, requiredSlotFields)
+
+	appointments, err := parseAppointments(body)
+	if err != nil {
+		return AvailabilityResult{}, err
+	}
+
+	active, upcoming, kept := h.bookableSlots(ctx, serviceType, location, appointments, time.Now())
+	result := AvailabilityResult{Decision: checkNoSlots, Evaluated: evaluateSlots(appointments, active, upcoming, kept)}
+
+	if len(kept) > 0 {
+		h.metrics.found.Add(1)
+		result.Found, result.Appointments = true, kept
+		if h.suppressedByTransition(ctx, serviceType, location) {
+			slog.Info("Availability unchanged since last check, skipping notification", "service", serviceType, "location", location)
+			result.Decision = checkTransition
+			return result, nil
 		}
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
-		if err != nil {
-			return false, fmt.Errorf("failed to create request: %v", err)
+		first := result.Appointments[0].StartTimestamp
+		key := dedupKey(serviceType, location, first)
+		if h.alreadyNotified(ctx, key) {
+			slog.Info("Slot already notified, skipping notification", "service", serviceType, "location", location, "slot", first)
+			result.Decision = checkDeduplicated
+			return result, nil
+		}
+		esc := h.slotEscalation(ctx, key)
+		if esc.Skip {
+			result.Decision = checkEscalation
+			return result, nil
 		}
+		result.Decision = checkNotified
+		slots := make([]string, len(result.Appointments))
+		for i, appt := range result.Appointments {
+			slots[i] = appt.StartTimestamp
+		}
+		var attachment *Attachment
+		if h.Mode.shared().NtfyAttachICS {
+			attachment = appointmentAttachment(serviceType, location, result.Appointments[0])
+		}
+		build := func(locale string) Notification {
+			message := fmt.Sprintf(messagesFor(locale).SlotsAvailable, serviceType, location, strings.Join(slots, ", "), minimum)
+			alert := h.withBookingLink(Notification{Title: getNotificationTitle(serviceType, locale), Message: message, Attachment: attachment}, serviceType, location, locale)
+			return esc.apply(alert, locale)
+		}
+		event := AppointmentEvent{ServiceType: serviceType, Location: location, Slots: slots, Minimum: minimum}
+		h.startWebhookEvent(ctx, event)
+		h.publishAppointmentEvent(ctx, event, build(h.locale("")))
+		eligible := subscribersForSlot(subscribers, first)
+		result.Notified, err = h.notifyLocalized(withNotifiedSlot(ctx, notifiedSlot{ServiceType: serviceType, Location: location, Key: key, Escalates: true}), location, eligible, build)
+		if batchFromContext(ctx) == nil { // Batched alerts are recorded once the batch is flushed
+			if result.Notified > 0 {
+				h.countRepeat(ctx, key)
+			}
+			if err == nil {
+				h.markNotified(ctx, key)
+			}
+		}
+		return result, err // Found and notified
+	}
+	return result, nil // No appointments found
+}
+
+// ttp returns the configured TTPClient, defaulting to the TTP HTTP API
+func (h *LambdaHandler) ttp() TTPClient {
+	if h.TTP != nil {
+		return h.TTP
+	}
+	return &TTPHTTPClient{
+		Config:      h.Mode.shared(),
+		URL:         h.URL,
+		Client:      h.retryClient(),
+		MaxAttempts: h.Mode.shared().ttpMaxAttempts(),
+	}
+}
 
-		resp, err := h.HTTPClient.Do(req)
+// retryClient returns a retrying client using the handler's HTTP client, request timeout and retry deadline
+func (h *LambdaHandler) retryClient() retryClient {
+	return retryClient{HTTPClient: h.HTTPClient, Timeout: h.Mode.shared().requestTimeout(), MaxDuration: h.Mode.shared().MaxRetryDuration}
+}
+
+// notifyAvailableLocations parses an asLocations response and notifies topics of every location with availability.
+// The response carries no slot times, so target dates can't be applied here.
+func (h *LambdaHandler) notifyAvailableLocations(ctx context.Context, serviceType string, body []byte, subscribers []Subscriber, minimum int) (AvailabilityResult, error) {
+	var locations []Location
+	if err := json.Unmarshal(body, &locations); err != nil {
+		return AvailabilityResult{}, fmt.Errorf("failed to unmarshal locations response: %v", err)
+	}
+	filter, _ := parseLocationFilter(h.Mode.shared().LocationFilter)
+	matched := locations[:0]
+	for _, loc := range locations {
+		if filter.Matches(loc) {
+			matched = append(matched, loc)
+		}
+	}
+	locations = matched
+	if len(locations) == 0 {
+		return AvailabilityResult{Decision: checkNoSlots}, nil // No locations with availability
+	}
+	h.metrics.found.Add(1)
+	result := AvailabilityResult{Found: true, Decision: checkNotified}
+	if h.suppressedByTransition(ctx, serviceType, "") {
+		slog.Info("Availability unchanged since last check, skipping notification", "service", serviceType)
+		result.Decision = checkTransition
+		return result, nil
+	}
+
+	names := make([]string, 0, len(locations))
+	ids := make([]string, 0, len(locations))
+	for _, loc := range locations {
+		names = append(names, fmt.Sprintf("%s (%d)", loc.Name, loc.ID))
+		ids = append(ids, strconv.Itoa(loc.ID))
+	}
+	key := dedupKey(serviceType, "", strings.Join(ids, ","))
+	if h.alreadyNotified(ctx, key) {
+		slog.Info("Locations already notified, skipping notification", "service", serviceType)
+		result.Decision = checkDeduplicated
+		return result, nil
+	}
+	build := func(locale string) Notification {
+		message := fmt.Sprintf(messagesFor(locale).LocationsAvailable, serviceType, strings.Join(names, ", "), minimum)
+		return Notification{Title: getNotificationTitle(serviceType, locale), Message: message}
+	}
+	event := AppointmentEvent{ServiceType: serviceType, Locations: ids, Minimum: minimum}
+	h.startWebhookEvent(ctx, event)
+	h.publishAppointmentEvent(ctx, event, build(h.locale("")))
+	var err error
+	result.Notified, err = h.notifyLocalized(withNotifiedSlot(ctx, notifiedSlot{ServiceType: serviceType, Key: key}), "", subscribers, build)
+	if err == nil && batchFromContext(ctx) == nil {
+		h.markNotified(ctx, key) // Batched alerts are marked once the batch is flushed
+	}
+	return result, err
+}
+
+// notifyTopics sends the alert to every topic, returning how many topics it reached
+// and the last delivery error
+func (h *LambdaHandler) notifyTopics(ctx context.Context, location string, subscribers []Subscriber, alert Notification) (int, error) {
+	if batch := batchFromContext(ctx); batch != nil {
+		for _, sub := range subscribers {
+			batch.add(sub.Topic, batchedAlert{
+				Location:    location,
+				ServiceType: subscriptionServiceType(sub.ServiceType),
+				Title:       alert.Title,
+				Message:     alert.Message,
+				Attachment:  alert.Attachment,
+				Click:       alert.Click,
+				OneShot:     sub.OneShot,
+				Priority:    max(alert.Priority, sub.Priority),
+				Tags:        sub.Tags,
+				Locale:      sub.Locale,
+				CreatedAt:   sub.CreatedAt,
+				Slot:        notifiedSlotFromContext(ctx),
+			})
+		}
+		return len(subscribers), nil
+	}
+
+	// Subscribers sharing priority and tags can still go out in one batched send
+	errs := make(map[string]error, len(subscribers))
+	for _, group := range groupSubscribersByPreferences(subscribers) {
+		topics := make([]string, len(group))
+		for i, sub := range group {
+			topics[i] = sub.Topic
+		}
+		prefAlert := alert
+		prefAlert.Priority = max(alert.Priority, group[0].Priority) // Escalated alerts keep their raised priority
+		prefAlert.Tags = group[0].Tags
+		for i, err := range h.sendToTopics(ctx, topics, prefAlert) {
+			errs[topics[i]] = err
+		}
+	}
+
+	var lastErr error
+	delivered := 0
+	for _, sub := range subscribers {
+		topic := sub.Topic
+		err := errs[topic]
+		h.recordDeliveryResult(ctx, location, topic, err)
 		if err != nil {
-			slog.Warn("Failed to get appointment slots", "location", location, "minimum", minimum, "attempt", attempt, "error", err)
-			if attempt == 3 {
-				return false, fmt.Errorf("failed after %d attempts: %v", attempt, err)
-			}
-			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+			slog.Error("Failed to deliver notification", "topic", topic, "location", location, "error", err)
+			lastErr = err
 			continue
 		}
-		defer resp.Body.Close()
+		delivered++
+		if sub.OneShot {
+			h.removeOneShot(ctx, location, topic)
+		}
+	}
+	return delivered, lastErr
+}
 
-		if resp.StatusCode != http.StatusOK {
-			slog.Warn("Non-OK status from API", "location", location, "minimum", minimum, "status", resp.StatusCode)
-			return false, fmt.Errorf("API returned status %d", resp.StatusCode)
+// notifyLocalized sends each subscriber the alert built for its locale, returning the total
+// number of topics reached and the last delivery error
+func (h *LambdaHandler) notifyLocalized(ctx context.Context, location string, subscribers []Subscriber, build func(locale string) Notification) (int, error) {
+	var order []string
+	byLocale := make(map[string][]Subscriber)
+	for _, sub := range subscribers {
+		sub.Locale = h.locale(sub.Locale)
+		if _, ok := byLocale[sub.Locale]; !ok {
+			order = append(order, sub.Locale)
 		}
+		byLocale[sub.Locale] = append(byLocale[sub.Locale], sub)
+	}
 
-		body, err := io.ReadAll(resp.Body)
+	var lastErr error
+	notified := 0
+	for _, locale := range order {
+		n, err := h.notifyTopics(ctx, location, byLocale[locale], build(locale))
+		notified += n
 		if err != nil {
-			return false, fmt.Errorf("failed to read response body: %v", err)
+			lastErr = err
+		}
+	}
+	return notified, lastErr
+}
+
+// groupSubscribersByPreferences splits subscribers into runs with the same priority and tags,
+// keeping first-seen order
+func groupSubscribersByPreferences(subscribers []Subscriber) [][]Subscriber {
+	var order []string
+	groups := make(map[string][]Subscriber)
+	for _, sub := range subscribers {
+		key := strconv.Itoa(sub.Priority) + "|" + strings.Join(sub.Tags, ",")
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], sub)
+	}
+	result := make([][]Subscriber, 0, len(order))
+	for _, key := range order {
+		result = append(result, groups[key])
+	}
+	return result
+}
+
+// removeOneShot deletes a one-shot subscription once its alert has been delivered
+func (h *LambdaHandler) removeOneShot(ctx context.Context, location, topic string) {
+	if h.Mode.IsPersonalMode || location == "" {
+		return
+	}
+	filter := bson.M{"location": location, "ntfyTopic": topic, "oneShot": true}
+	if _, err := h.subscriptions().DeleteOne(ctx, filter); err != nil {
+		slog.Error("Failed to remove one-shot subscription", "topic", topic, "location", location, "error", err)
+		return
+	}
+	slog.Info("Removed one-shot subscription after delivery", "topic", topic, "location", location)
+}
+
+// recordDeliveryResult tracks consecutive delivery failures per subscription and
+// auto-unsubscribes topics that keep failing (multi-user mode only)
+func (h *LambdaHandler) recordDeliveryResult(ctx context.Context, location, topic string, sendErr error) {
+	if h.Mode.IsPersonalMode || h.Mode.MultiUserConfig.MaxDeliveryFailures <= 0 || location == "" {
+		return
+	}
+	coll := h.subscriptions()
+	filter := bson.M{"location": location, "ntfyTopic": topic}
+
+	if errors.Is(sendErr, errNotifierRateLimited) {
+		// A send skipped by our own rate limit says nothing about the topic
+		return
+	}
+	if sendErr == nil {
+		// Reset the failure count only when there is something to reset
+		resetFilter := bson.M{"location": location, "ntfyTopic": topic, "failureCount": bson.M{"$gt": 0}}
+		if _, err := coll.UpdateOne(ctx, resetFilter, bson.M{"$set": bson.M{"failureCount": 0}}); err != nil {
+			slog.Warn("Failed to reset delivery failure count", "topic", topic, "location", location, "error", err)
 		}
+		return
+	}
+
+	var updated struct {
+		FailureCount int    `bson:"failureCount"`
+		ServiceType  string `bson:"serviceType"`
+		Locale       string `bson:"locale"`
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"_id": 0, "failureCount": 1, "serviceType": 1, "locale": 1})
+	if err := coll.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"failureCount": 1}}, opts).Decode(&updated); err != nil {
+		slog.Warn("Failed to record delivery failure", "topic", topic, "location", location, "error", err)
+		return
+	}
+	if updated.FailureCount < h.Mode.MultiUserConfig.MaxDeliveryFailures {
+		return
+	}
+	if _, err := coll.DeleteOne(ctx, filter); err != nil {
+		slog.Error("Failed to auto-unsubscribe failing topic", "topic", topic, "location", location, "error", err)
+		return
+	}
+	slog.Warn("Auto-unsubscribed after repeated delivery failures", "topic", topic, "location", location, "failures", updated.FailureCount)
+	h.sendRemovalNotice(ctx, Subscription{Location: location, NtfyTopic: topic, ServiceType: updated.ServiceType, Locale: updated.Locale}, removedForFailures)
+}
+
+// Reasons a subscription was deleted without the user unsubscribing
+const (
+	removedForExpiry     = "expired"
+	removedForFailures   = "deliveryFailures"
+	removedForTargetDate = "targetDatePassed"
+)
+
+// removalMessage returns the localized message telling a topic its subscription was deleted
+func removalMessage(reason, serviceType, location, locale string) string {
+	messages := messagesFor(locale)
+	switch reason {
+	case removedForFailures:
+		return fmt.Sprintf(messages.RemovedAfterFailures, serviceType, location)
+	case removedForTargetDate:
+		return fmt.Sprintf(messages.RemovedAfterTarget, serviceType, location)
+	}
+	return fmt.Sprintf(messages.RemovedAfterExpiry, serviceType, location)
+}
+
+// sendRemovalNotice tells a topic its subscription is gone once it has actually been deleted,
+// so users can tell a warning from a removal (NOTIFY_ON_REMOVAL). It replaces the expiry and
+// target date warnings so each removal sends one message. Failures are only logged.
+func (h *LambdaHandler) sendRemovalNotice(ctx context.Context, sub Subscription, reason string) {
+	if !h.Mode.MultiUserConfig.NotifyOnRemoval {
+		return
+	}
+	serviceType := subscriptionServiceType(sub.ServiceType)
+	locale := h.locale(sub.Locale)
+	title := fmt.Sprintf(messagesFor(locale).RemovedTitle, serviceType)
+	if err := h.sendNotification(ctx, sub.NtfyTopic, title, removalMessage(reason, serviceType, sub.Location, locale)); err != nil {
+		slog.Error("Failed to send removal notification", "topic", sub.NtfyTopic, "location", sub.Location, "reason", reason, "error", err)
+	}
+}
+
+// notifier returns the configured Notifier, defaulting to ntfy
+func (h *LambdaHandler) notifier() Notifier {
+	if h.Notifier != nil {
+		return h.Notifier
+	}
+	var ntfyServer string
+	if h.Mode.IsPersonalMode {
+		ntfyServer = h.Mode.PersonalConfig.NtfyServer
+	} else {
+		ntfyServer = h.Mode.MultiUserConfig.NtfyServer
+	}
+	return &NtfyNotifier{
+		Server:           ntfyServer,
+		Format:           h.Mode.shared().NtfyFormat,
+		HTTPClient:       h.HTTPClient,
+		RequestTimeout:   h.Mode.shared().requestTimeout(),
+		MaxRetryDuration: h.Mode.shared().MaxRetryDuration,
+		Limiter:          h.ntfyLimit,
+	}
+}
 
-		var appointments []Appointment
-		if err := json.Unmarshal(body, &appointments); err != nil {
-			return false, fmt.Errorf("failed to unmarshal response: %v", err)
+// sendToTopics delivers one notification to several topics and returns each topic's delivery error.
+// With NTFY_BATCH_TOPICS the topics go out in a single request, falling back to per-topic sends
+// if the server rejects it.
+func (h *LambdaHandler) sendToTopics(ctx context.Context, topics []string, alert Notification) []error {
+	errs := make([]error, len(topics))
+	if !h.Mode.IsPersonalMode && h.Mode.MultiUserConfig.NtfyBatchTopics && len(topics) > 1 {
+		if sender, ok := h.notifier().(BatchSender); ok {
+			err := sender.SendBatch(ctx, topics, alert)
+			if err == nil {
+				h.recordSendMetric(nil, len(topics))
+				return errs
+			}
+			slog.Warn("Batched topic send failed, falling back to per-topic sends", "topics", len(topics), "error", err)
 		}
+	}
+	for i, topic := range topics {
+		alert.Topic = topic
+		errs[i] = h.deliver(ctx, alert)
+	}
+	return errs
+}
 
-		if len(appointments) > 0 && appointments[0].Active {
-			for _, topic := range topics {
-				message := fmt.Sprintf("%s appointment available at %s on %s (minimum %d slots)", serviceType, location, appointments[0].StartTimestamp, minimum)
-				payload := map[string]string{
-					"topic":   topic,
-					"message": message,
-					"title":   getNotificationTitle(serviceType),
-				}
-				payloadBytes, _ := json.Marshal(payload)
+// checkNotifierConnectivity logs whether the notifier server is reachable. Failures are only
+// logged so a flaky server never blocks startup.
+func (h *LambdaHandler) checkNotifierConnectivity(ctx context.Context) {
+	checker, ok := h.notifier().(ConnectivityChecker)
+	if !ok {
+		slog.Info("Notifier does not support connectivity checks, skipping self-test")
+		return
+	}
+	if err := checker.CheckConnectivity(ctx); err != nil {
+		slog.Warn("Notifier self-test failed", "error", err)
+		return
+	}
+	slog.Info("Notifier self-test passed")
+}
 
-				var ntfyServer string
-				if h.Mode.IsPersonalMode {
-					ntfyServer = h.Mode.PersonalConfig.NtfyServer
-				} else {
-					ntfyServer = h.Mode.MultiUserConfig.NtfyServer
-				}
+// sendNotification delivers a notification to a single topic
+func (h *LambdaHandler) sendNotification(ctx context.Context, topic, title, message string) error {
+	return h.deliver(ctx, Notification{Topic: topic, Title: title, Message: message})
+}
 
-				for ntfyAttempt := 1; ntfyAttempt <= 3; ntfyAttempt++ {
-					ntfyReq, err := http.NewRequestWithContext(ctx, http.MethodPost, ntfyServer, bytes.NewBuffer(payloadBytes))
-					if err != nil {
-						return false, fmt.Errorf("failed to create ntfy request: %v", err)
-					}
-					ntfyReq.Header.Set("Content-Type", "application/json")
-
-					ntfyResp, err := h.HTTPClient.Do(ntfyReq)
-					if err != nil {
-						slog.Warn("Failed to send ntfy notification", "topic", topic, "attempt", ntfyAttempt, "error", err)
-						if ntfyAttempt == 3 {
-							return false, fmt.Errorf("failed to send ntfy notification after %d attempts: %v", ntfyAttempt, err)
-						}
-						time.Sleep(time.Duration(ntfyAttempt) * 100 * time.Millisecond)
-						continue
-					}
-					ntfyResp.Body.Close()
-					if ntfyResp.StatusCode == http.StatusOK {
-						slog.Info("Sent notification", "topic", topic, "location", location, "minimum", minimum)
-						break
-					}
-					slog.Warn("Non-OK status from ntfy", "topic", topic, "status", ntfyResp.StatusCode)
-				}
-			}
-			return true, nil // Found and notified
-		}
-		return false, nil // No appointments found
+// deliver sends a fully built notification and records the send metric
+func (h *LambdaHandler) deliver(ctx context.Context, n Notification) error {
+	err := h.notifier().Send(ctx, n)
+	h.recordSendMetric(err, 1)
+	return err
+}
+
+// recordSendMetric counts a delivery attempt covering the given number of topics
+func (h *LambdaHandler) recordSendMetric(err error, topics int) {
+	if err != nil {
+		h.metrics.errors.Add(1)
+		return
 	}
-	return false, nil
+	h.metrics.sent.Add(int64(topics))
 }
 
 // handleExpiringSubscriptions deletes subscriptions exactly 30 days old and notifies (multi-user mode only)
@@ -299,19 +1615,14 @@ func (h *LambdaHandler) handleExpiringSubscriptions(ctx context.Context, coll *m
 		// Personal mode doesn't have expiring subscriptions
 		return nil
 	}
-	now := time.Now().UTC()
-	// Calculate the 5-minute window for subscriptions exactly 30 days old
-	ttlThreshold := now.Add(-30 * 24 * time.Hour)         // 30 days ago
-	expireStart := ttlThreshold.Truncate(5 * time.Minute) // Start of the 5-minute block
-	expireEnd := expireStart.Add(5 * time.Minute)         // End of the 5-minute block
-
+	expireStart, expireEnd := expiryWindow(time.Now().UTC())
 	filter := bson.M{
 		"createdAt": bson.M{
 			"$gte": expireStart,
 			"$lt":  expireEnd,
 		},
 	}
-	cursor, err := coll.Find(ctx, filter)
+	cursor, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0}))
 	if err != nil {
 		return fmt.Errorf("failed to find expiring subscriptions: %v", err)
 	}
@@ -323,51 +1634,212 @@ func (h *LambdaHandler) handleExpiringSubscriptions(ctx context.Context, coll *m
 	}
 
 	for _, sub := range subscriptions {
-		// Send expiration notification
-		message := getExpirationMessage("Global Entry")
-		payload := map[string]string{
-			"topic":   sub.NtfyTopic,
-			"message": message,
-			"title":   getExpirationTitle("Global Entry"),
-		}
-		payloadBytes, _ := json.Marshal(payload)
-
-		for attempt := 1; attempt <= 3; attempt++ {
-			req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Mode.MultiUserConfig.NtfyServer, bytes.NewBuffer(payloadBytes))
-			if err != nil {
-				return fmt.Errorf("failed to create ntfy request: %v", err)
-			}
-			req.Header.Set("Content-Type", "application/json")
+		key := bson.M{"location": sub.Location, "ntfyTopic": sub.NtfyTopic}
 
-			resp, err := h.HTTPClient.Do(req)
-			if err != nil {
-				slog.Warn("Failed to send expiration notification", "topic", sub.NtfyTopic, "attempt", attempt, "error", err)
-				if attempt == 3 {
-					slog.Error("Failed to send expiration notification after 3 attempts", "topic", sub.NtfyTopic, "error", err)
-					continue
-				}
-				time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
-				continue
-			}
-			resp.Body.Close()
-			if resp.StatusCode == http.StatusOK {
-				slog.Info("Sent expiration notification", "topic", sub.NtfyTopic)
-				break
+		// Claim the expiry notice so overlapping windows and concurrent invocations send it once
+		claim := bson.M{"location": sub.Location, "ntfyTopic": sub.NtfyTopic, "notifiedExpiry": bson.M{"$ne": true}}
+		result, err := coll.UpdateOne(ctx, claim, bson.M{"$set": bson.M{"notifiedExpiry": true}})
+		if err != nil {
+			slog.Error("Failed to mark expiry notification", "topic", sub.NtfyTopic, "location", sub.Location, "error", err)
+			continue
+		}
+		// With NOTIFY_ON_REMOVAL the removal notice below replaces the warning, so the user gets one message
+		if result.ModifiedCount == 1 && !h.Mode.MultiUserConfig.NotifyOnRemoval {
+			serviceType := subscriptionServiceType(sub.ServiceType)
+			locale := h.locale(sub.Locale)
+			if err := h.sendNotification(ctx, sub.NtfyTopic, getExpirationTitle(serviceType, locale), getExpirationMessage(serviceType, locale)); err != nil {
+				slog.Error("Failed to send expiration notification", "topic", sub.NtfyTopic, "error", err)
 			}
-			slog.Warn("Non-OK status from ntfy", "topic", sub.NtfyTopic, "status", resp.StatusCode)
 		}
 
 		// Delete the subscription
-		_, err := coll.DeleteOne(ctx, bson.M{"_id": sub.ID})
-		if err != nil {
-			slog.Error("Failed to delete subscription", "id", sub.ID, "error", err)
+		if _, err := coll.DeleteOne(ctx, key); err != nil {
+			slog.Error("Failed to delete subscription", "topic", sub.NtfyTopic, "location", sub.Location, "error", err)
+		} else {
+			slog.Info("Deleted expired subscription", "topic", sub.NtfyTopic, "location", sub.Location)
+			h.sendRemovalNotice(ctx, sub, removedForExpiry)
+		}
+	}
+	return nil
+}
+
+// expiryWindow returns the createdAt range of subscriptions that reach 30 days in the current
+// 5-minute block. It assumes the scheduler runs at least every 5 minutes (the rule runs every
+// minute), and widens the block by expirySkewTolerance on both sides so clock skew between
+// invocations can't drop a subscription at a block edge. Repeats from the overlap are
+// suppressed by the notifiedExpiry flag.
+func expiryWindow(now time.Time) (time.Time, time.Time) {
+	ttlThreshold := now.Add(-30 * 24 * time.Hour)         // 30 days ago
+	expireStart := ttlThreshold.Truncate(5 * time.Minute) // Start of the 5-minute block
+	expireEnd := expireStart.Add(5 * time.Minute)         // End of the 5-minute block
+	return expireStart.Add(-expirySkewTolerance), expireEnd.Add(expirySkewTolerance)
+}
+
+// handlePassedTargetDates notifies and removes subscriptions whose target date has passed (multi-user mode only)
+func (h *LambdaHandler) handlePassedTargetDates(ctx context.Context, coll *mongo.Collection) error {
+	today := time.Now().UTC().Format(dateLayout)
+	filter := bson.M{"targetDate": bson.M{"$lt": today}}
+	cursor, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0}))
+	if err != nil {
+		return fmt.Errorf("failed to find subscriptions past their target date: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subscriptions []Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return fmt.Errorf("failed to decode subscriptions past their target date: %v", err)
+	}
+
+	for _, sub := range subscriptions {
+		// With NOTIFY_ON_REMOVAL the removal notice sent after the delete replaces this message
+		if !h.Mode.MultiUserConfig.NotifyOnRemoval {
+			serviceType := subscriptionServiceType(sub.ServiceType)
+			locale := h.locale(sub.Locale)
+			message := fmt.Sprintf(messagesFor(locale).TargetDatePassed, sub.TargetDate, serviceType, sub.Location)
+			if err := h.sendNotification(ctx, sub.NtfyTopic, getExpirationTitle(serviceType, locale), message); err != nil {
+				slog.Error("Failed to send target date notification", "topic", sub.NtfyTopic, "error", err)
+			}
+		}
+		if _, err := coll.DeleteOne(ctx, bson.M{"location": sub.Location, "ntfyTopic": sub.NtfyTopic}); err != nil {
+			slog.Error("Failed to delete subscription past its target date", "location", sub.Location, "topic", sub.NtfyTopic, "error", err)
 		} else {
-			slog.Info("Deleted expired subscription", "id", sub.ID)
+			slog.Info("Deleted subscription past its target date", "location", sub.Location, "targetDate", sub.TargetDate)
+			h.sendRemovalNotice(ctx, sub, removedForTargetDate)
 		}
 	}
 	return nil
 }
 
+// errorResponse builds a JSON error response with CORS headers
+func errorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	body, _ := json.Marshal(map[string]string{"error": message})
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers:    corsHeaders,
+		Body:       string(body),
+	}
+}
+
+// locationsForRun returns at most MAX_LOCATIONS_PER_RUN locations, continuing after the last
+// location processed by the previous invocation and wrapping around. With a cap, each location
+// is checked every ceil(total/cap) invocations instead of every invocation.
+func (h *LambdaHandler) locationsForRun(ctx context.Context, locationTopics []LocationTopics) []LocationTopics {
+	limit := h.Mode.MultiUserConfig.MaxLocationsPerRun
+	if limit <= 0 || len(locationTopics) <= limit {
+		return locationTopics
+	}
+	sort.Slice(locationTopics, func(i, j int) bool { return locationTopics[i].Location < locationTopics[j].Location })
+
+	cursor, err := h.State.GetCursor(ctx, locationCursorName)
+	if err != nil {
+		slog.Warn("Failed to load location cursor, starting from the beginning", "error", err)
+	}
+	start := sort.Search(len(locationTopics), func(i int) bool { return locationTopics[i].Location > cursor })
+
+	selected := make([]LocationTopics, 0, limit)
+	for i := 0; i < limit; i++ {
+		selected = append(selected, locationTopics[(start+i)%len(locationTopics)])
+	}
+	if err := h.State.PutCursor(ctx, locationCursorName, selected[len(selected)-1].Location); err != nil {
+		slog.Warn("Failed to save location cursor", "error", err)
+	}
+	slog.Info("Processing a slice of locations", "count", limit, "total", len(locationTopics), "from", selected[0].Location)
+	return selected
+}
+
+// soonestSlot is the response body of GET /soonest
+type soonestSlot struct {
+	Location       string `json:"location"`
+	ServiceType    string `json:"serviceType"`
+	StartTimestamp string `json:"startTimestamp"`
+}
+
+// handleSoonest checks every location the topic is subscribed to and returns the soonest open slot
+func (h *LambdaHandler) handleSoonest(ctx context.Context, coll *mongo.Collection, topic string) (events.APIGatewayV2HTTPResponse, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 0}).SetLimit(maxSoonestLocations)
+	cursor, err := coll.Find(ctx, bson.M{"ntfyTopic": topic}, opts)
+	if err != nil {
+		h.breaker.recordFailure()
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to find subscriptions for topic: %v", err)
+	}
+	defer cursor.Close(ctx)
+	var subscriptions []Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		h.breaker.recordFailure()
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to decode subscriptions for topic: %v", err)
+	}
+	h.breaker.recordSuccess()
+	if len(subscriptions) == 0 {
+		return errorResponse(404, "no subscriptions found for ntfyTopic"), nil
+	}
+
+	var soonest *soonestSlot
+	for _, sub := range subscriptions {
+		serviceType := subscriptionServiceType(sub.ServiceType)
+		slot, err := h.soonestBookableSlot(ctx, serviceType, sub.Location)
+		if err != nil {
+			slog.Warn("Failed to check availability for soonest query", "location", sub.Location, "error", err)
+			continue
+		}
+		if slot != "" && (soonest == nil || slot < soonest.StartTimestamp) {
+			soonest = &soonestSlot{Location: sub.Location, ServiceType: serviceType, StartTimestamp: slot}
+		}
+	}
+	if soonest == nil {
+		return errorResponse(404, "no available slots found for subscribed locations"), nil
+	}
+
+	body, _ := json.Marshal(soonest)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    corsHeaders,
+		Body:       string(body),
+	}, nil
+}
+
+// runSubscription runs a validated subscription request under a request slot and the circuit breaker
+func (h *LambdaHandler) runSubscription(ctx context.Context, ip string, subReq SubscriptionRequest) (events.APIGatewayV2HTTPResponse, error) {
+	slog.Info("Calling handleSubscription", "action", subReq.Action, "location", subReq.Location, "clientIP", ip)
+	// A check on subscribe takes over this request's slot rather than needing a second one
+	slot := &heldRequestSlot{}
+	return h.runDatabaseRequest(slot, func() (events.APIGatewayV2HTTPResponse, error) {
+		return h.handleSubscription(withHeldRequestSlot(withClientIP(ctx, ip), slot), h.subscriptions(), subReq)
+	})
+}
+
+// runDatabaseRequest runs a subscription API handler under a request slot, recording the
+// outcome in the circuit breaker and normalizing the JSON response body. The slot is released
+// on return unless handle passed it on through slot, which may be nil.
+func (h *LambdaHandler) runDatabaseRequest(slot *heldRequestSlot, handle func() (events.APIGatewayV2HTTPResponse, error)) (events.APIGatewayV2HTTPResponse, error) {
+	// Fail fast when degraded rather than hanging on the database
+	if resp, ok := h.acquireRequestSlot(); !ok {
+		return resp, nil
+	}
+	defer func() {
+		if slot == nil || !slot.handedOff {
+			h.releaseRequestSlot()
+		}
+	}()
+	resp, err := handle()
+	if err != nil {
+		h.breaker.recordFailure()
+		return resp, err
+	}
+	h.breaker.recordSuccess()
+	// Ensure response body is JSON string
+	if resp.Body != "" {
+		var bodyMap interface{}
+		if json.Unmarshal([]byte(resp.Body), &bodyMap) == nil {
+			b, err := json.Marshal(bodyMap)
+			if err != nil {
+				slog.Error("Failed to marshal response body", "body", resp.Body, "error", err)
+			}
+			resp.Body = string(b)
+		}
+	}
+	return resp, nil
+}
+
 // handleSubscription manages subscribe/unsubscribe requests
 func (h *LambdaHandler) handleSubscription(ctx context.Context, coll *mongo.Collection, req SubscriptionRequest) (events.APIGatewayV2HTTPResponse, error) {
 	if req.Location == "" || req.NtfyTopic == "" {
@@ -388,12 +1860,46 @@ func (h *LambdaHandler) handleSubscription(ctx context.Context, coll *mongo.Coll
 
 	switch req.Action {
 	case "subscribe":
-		// Check if subscription already exists
-		count, err := coll.CountDocuments(ctx, bson.M{"location": req.Location, "ntfyTopic": req.NtfyTopic})
-		if err != nil {
+		if req.TargetDate != "" {
+			if err := validateTargetDate(req.TargetDate, time.Now()); err != nil {
+				return errorResponse(400, err.Error()), nil
+			}
+		}
+		serviceType := "Global Entry"
+		if req.ServiceType != "" {
+			var ok bool
+			if serviceType, ok = normalizeServiceType(req.ServiceType); !ok {
+				return errorResponse(400, `serviceType must be "Global Entry" or "NEXUS"`), nil
+			}
+		}
+		if err := validateNotificationPreferences(req.Priority, req.Tags); err != nil {
+			return errorResponse(400, err.Error()), nil
+		}
+		if err := validateLocale(req.Locale); err != nil {
+			return errorResponse(400, err.Error()), nil
+		}
+		if reason := h.subscriptionRejection(req); reason != "" {
+			return errorResponse(400, reason), nil
+		}
+		if reason := h.unbookableLocation(ctx, serviceType, req.Location); reason != "" {
+			msg := fmt.Sprintf("location %s %s, so it rarely has bookable appointments; choose another location", req.Location, reason)
+			return errorResponse(400, msg), nil
+		}
+
+		// Check if subscription already exists, possibly for the other service
+		var existing struct {
+			ServiceType string `bson:"serviceType"`
+		}
+		opts := options.FindOne().SetProjection(bson.M{"_id": 0, "serviceType": 1})
+		err := coll.FindOne(ctx, bson.M{"location": req.Location, "ntfyTopic": req.NtfyTopic}, opts).Decode(&existing)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
 			return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to check existing subscription: %v", err)
 		}
-		if count > 0 {
+		if err == nil {
+			if existingService := subscriptionServiceType(existing.ServiceType); existingService != serviceType {
+				msg := fmt.Sprintf("ntfyTopic is already subscribed to %s at this location; use a separate topic for %s", existingService, serviceType)
+				return errorResponse(409, msg), nil
+			}
 			return events.APIGatewayV2HTTPResponse{
 				StatusCode: 400,
 				Headers:    corsHeaders,
@@ -401,16 +1907,64 @@ func (h *LambdaHandler) handleSubscription(ctx context.Context, coll *mongo.Coll
 			}, nil
 		}
 
+		if limit := h.Mode.MultiUserConfig.MaxSubscriptionsPerTopic; limit > 0 {
+			count, err := withMongoRetry(ctx, h.Mode.MultiUserConfig.mongoMaxAttempts(), "countDocuments", func() (int64, error) {
+				return coll.CountDocuments(ctx, bson.M{"ntfyTopic": req.NtfyTopic}, options.Count().SetLimit(int64(limit)))
+			})
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to count subscriptions for topic: %v", err)
+			}
+			if count >= int64(limit) {
+				slog.Warn("Subscription limit reached for topic", "ntfyTopic", req.NtfyTopic, "limit", limit)
+				return errorResponse(403, fmt.Sprintf("ntfyTopic already has the maximum of %d subscriptions; unsubscribe from a location first", limit)), nil
+			}
+		}
+
 		// Insert new subscription
-		_, err = coll.InsertOne(ctx, bson.M{
+		doc := bson.M{
 			"location":  req.Location,
 			"ntfyTopic": req.NtfyTopic,
 			"createdAt": time.Now().UTC(),
+		}
+		if req.TargetDate != "" {
+			doc["targetDate"] = req.TargetDate
+		}
+		if req.OneShot {
+			doc["oneShot"] = true
+		}
+		if serviceType != "Global Entry" {
+			doc["serviceType"] = serviceType
+		}
+		if req.Priority > 0 {
+			doc["priority"] = req.Priority
+		}
+		if len(req.Tags) > 0 {
+			doc["tags"] = req.Tags
+		}
+		if req.Locale != "" {
+			doc["locale"], _ = normalizeLocale(req.Locale)
+		}
+		_, err = withMongoRetry(ctx, h.Mode.MultiUserConfig.mongoMaxAttempts(), "insertOne", func() (*mongo.InsertOneResult, error) {
+			return coll.InsertOne(ctx, doc)
 		})
+		if mongo.IsDuplicateKeyError(err) {
+			// A concurrent request for the same subscription won the race to the unique index
+			return errorResponse(400, "subscription already exists"), nil
+		}
 		if err != nil {
 			return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to insert subscription: %v", err)
 		}
 		slog.Info("Added subscription", "location", req.Location, "ntfyTopic", req.NtfyTopic)
+		h.audit(ctx, auditActionSubscribe, req.Location, req.NtfyTopic)
+		h.startSubscribeCheck(ctx, serviceType, req.Location, Subscriber{
+			Topic:       req.NtfyTopic,
+			TargetDate:  req.TargetDate,
+			OneShot:     req.OneShot,
+			ServiceType: serviceType,
+			Priority:    req.Priority,
+			Tags:        req.Tags,
+			Locale:      req.Locale,
+		})
 		return events.APIGatewayV2HTTPResponse{
 			StatusCode: 200,
 			Headers:    corsHeaders,
@@ -418,7 +1972,9 @@ func (h *LambdaHandler) handleSubscription(ctx context.Context, coll *mongo.Coll
 		}, nil
 
 	case "unsubscribe":
-		result, err := coll.DeleteOne(ctx, bson.M{"location": req.Location, "ntfyTopic": req.NtfyTopic})
+		result, err := withMongoRetry(ctx, h.Mode.MultiUserConfig.mongoMaxAttempts(), "deleteOne", func() (*mongo.DeleteResult, error) {
+			return coll.DeleteOne(ctx, bson.M{"location": req.Location, "ntfyTopic": req.NtfyTopic})
+		})
 		if err != nil {
 			return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to delete subscription: %v", err)
 		}
@@ -430,6 +1986,7 @@ func (h *LambdaHandler) handleSubscription(ctx context.Context, coll *mongo.Coll
 			}, nil
 		}
 		slog.Info("Removed subscription", "location", req.Location, "ntfyTopic", req.NtfyTopic)
+		h.audit(ctx, auditActionUnsubscribe, req.Location, req.NtfyTopic)
 		return events.APIGatewayV2HTTPResponse{
 			StatusCode: 200,
 			Headers:    corsHeaders,
@@ -445,14 +2002,142 @@ func (h *LambdaHandler) handleSubscription(ctx context.Context, coll *mongo.Coll
 	}
 }
 
+// subscriptionViewOf converts a stored subscription for API responses
+func subscriptionViewOf(sub Subscription) subscriptionView {
+	return subscriptionView{
+		Location:    sub.Location,
+		NtfyTopic:   sub.NtfyTopic,
+		ServiceType: subscriptionServiceType(sub.ServiceType),
+		TargetDate:  sub.TargetDate,
+		OneShot:     sub.OneShot,
+		Priority:    sub.Priority,
+		Tags:        sub.Tags,
+		Locale:      sub.Locale,
+		CreatedAt:   sub.CreatedAt,
+	}
+}
+
+// handleSubscriptionUpdate changes the preferences of an existing subscription, leaving fields
+// absent from the request and createdAt untouched. Empty values clear a preference.
+func (h *LambdaHandler) handleSubscriptionUpdate(ctx context.Context, coll *mongo.Collection, req SubscriptionUpdate) (events.APIGatewayV2HTTPResponse, error) {
+	set, unset := bson.M{}, bson.M{}
+	setOrUnset := func(field string, value any, empty bool) {
+		if empty {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+	if req.TargetDate != nil {
+		if *req.TargetDate != "" {
+			if err := validateTargetDate(*req.TargetDate, time.Now()); err != nil {
+				return errorResponse(400, err.Error()), nil
+			}
+		}
+		setOrUnset("targetDate", *req.TargetDate, *req.TargetDate == "")
+	}
+	if req.OneShot != nil {
+		setOrUnset("oneShot", true, !*req.OneShot)
+	}
+	var priority int
+	var tags []string
+	if req.Priority != nil {
+		priority = *req.Priority
+	}
+	if req.Tags != nil {
+		tags = *req.Tags
+	}
+	if err := validateNotificationPreferences(priority, tags); err != nil {
+		return errorResponse(400, err.Error()), nil
+	}
+	if req.Priority != nil {
+		setOrUnset("priority", priority, priority == 0)
+	}
+	if req.Tags != nil {
+		setOrUnset("tags", tags, len(tags) == 0)
+	}
+	if req.Locale != nil {
+		if err := validateLocale(*req.Locale); err != nil {
+			return errorResponse(400, err.Error()), nil
+		}
+		locale, _ := normalizeLocale(*req.Locale)
+		setOrUnset("locale", locale, *req.Locale == "")
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		return errorResponse(400, "no preference fields to update; use targetDate, oneShot, priority, tags or locale"), nil
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	filter := bson.M{"location": req.Location, "ntfyTopic": req.NtfyTopic}
+	result, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to update subscription: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return errorResponse(404, "subscription not found"), nil
+	}
+	slog.Info("Updated subscription", "location", req.Location, "ntfyTopic", req.NtfyTopic)
+	h.audit(ctx, auditActionUpdate, req.Location, req.NtfyTopic)
+
+	var sub Subscription
+	opts := options.FindOne().SetProjection(bson.M{"_id": 0})
+	if err := coll.FindOne(ctx, filter, opts).Decode(&sub); err != nil {
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, fmt.Errorf("failed to load updated subscription: %v", err)
+	}
+	body, _ := json.Marshal(subscriptionViewOf(sub))
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    corsHeaders,
+		Body:       string(body),
+	}, nil
+}
+
 // handlePersonalMode handles CloudWatch events in personal mode
 func (h *LambdaHandler) handlePersonalMode(ctx context.Context) (events.APIGatewayV2HTTPResponse, error) {
 	config := h.Mode.PersonalConfig
-	topics := []string{config.NtfyTopic}
-	minimums := parseMinimumSlots(config.MinimumSlots)
+	subscribers := []Subscriber{{Topic: config.NtfyTopic, TargetDate: config.TargetDate}}
+	if targetDatePassed(config.TargetDate, time.Now()) {
+		slog.Info("Target date has passed, skipping checks", "targetDate", config.TargetDate)
+		return events.APIGatewayV2HTTPResponse{
+				StatusCode: 200,
+				Body:       `{"message": "target date has passed"}`},
+			nil
+	}
+	h.throttle.reset()
+	h.schema.reset()
+	defer h.updateRateLimitStreak(ctx)
+	defer h.updateSchemaDriftStreak(ctx)
+	serviceTypes := parseServiceTypes(config.ServiceType)
+	locations := parseServiceLocations(serviceTypes, config.LocationID)
+	// Validated at startup; a parse error falls back to the lenient plain list below
+	serviceMinimums, _ := parseServiceMinimums(serviceTypes, config.MinimumSlots)
 
-	if err := h.checkAvailabilityAndNotifyWithMinimums(ctx, config.ServiceType, config.LocationID, topics, minimums); err != nil {
-		slog.Error("Failed to check availability in personal mode", "location", config.LocationID, "minimums", minimums, "error", err)
+	var lastErr error
+	for _, serviceType := range serviceTypes {
+		location := locations[serviceType]
+		if location == "" && serviceType != "NEXUS" {
+			slog.Warn("No location configured for service", "service", serviceType)
+			continue
+		}
+		minimums, ok := serviceMinimums[serviceType]
+		if !ok {
+			minimums = parseMinimumSlots(config.MinimumSlots)
+		}
+		if location == "" && config.NexusScanMinimum > 0 {
+			minimums = []int{config.NexusScanMinimum} // asLocations scan with its own minimum
+		}
+		if err := h.checkAvailabilityAndNotifyWithMinimums(ctx, serviceType, location, subscribers, minimums); err != nil {
+			slog.Error("Failed to check availability in personal mode", "service", serviceType, "location", location, "minimums", minimums, "error", err)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
 		return events.APIGatewayV2HTTPResponse{
 				StatusCode: 500,
 				Body:       `{"error": "failed to check availability"}`},
@@ -467,8 +2152,6 @@ func (h *LambdaHandler) handlePersonalMode(ctx context.Context) (events.APIGatew
 
 // handleMultiUserMode handles events in multi-user mode (original functionality)
 func (h *LambdaHandler) handleMultiUserMode(ctx context.Context, event json.RawMessage) (events.APIGatewayV2HTTPResponse, error) {
-	coll := h.Client.Database("global-entry-appointment-db").Collection("subscriptions")
-
 	// Parse event as JSON map
 	var eventMap map[string]interface{}
 	if err := json.Unmarshal(event, &eventMap); err != nil {
@@ -492,61 +2175,28 @@ func (h *LambdaHandler) handleMultiUserMode(ctx context.Context, event json.RawM
 	}
 
 	// Check for CloudWatch Event
-	if source, ok := eventMap["source"].(string); ok && source == "aws.events" {
-		if err := h.handleExpiringSubscriptions(ctx, coll); err != nil {
-			slog.Error("Failed to handle expiring subscriptions", "error", err)
-			return events.APIGatewayV2HTTPResponse{
-				StatusCode: 500,
-				Body:       `{"error": "failed to handle expiring subscriptions"}`,
-			}, nil
-		}
-
-		pipeline := mongo.Pipeline{
-			bson.D{{
-				"$group", bson.D{
-					{"_id", "$location"},
-					{"ntfyTopics", bson.D{{"$push", "$ntfyTopic"}}},
-				},
-			}},
-		}
-		cursor, err := coll.Aggregate(ctx, pipeline)
-		if err != nil {
-			slog.Error("Failed to execute aggregation", "error", err)
-			return events.APIGatewayV2HTTPResponse{
-				StatusCode: 500,
-				Body:       `{"error": "failed to execute aggregation"}`,
-			}, nil
+	if isDailySummaryEvent(eventMap) {
+		return h.handleDailySummary(ctx)
+	}
+	if h.isScheduledEvent(eventMap) {
+		if !h.scheduledCheckDue(time.Now()) {
+			// Only slot checks follow CHECK_SCHEDULE; expiry has to see every 5-minute block
+			h.cleanUpSubscriptions(ctx, h.subscriptions())
+			return scheduleSkippedResponse(), nil
 		}
-		defer cursor.Close(ctx)
-
-		var locationTopics []LocationTopics
-		if err := cursor.All(ctx, &locationTopics); err != nil {
-			slog.Error("Failed to decode aggregation results", "error", err)
+		h.waitStartupJitter(ctx)
+		return h.withDebugResponse(ctx, func(ctx context.Context) (events.APIGatewayV2HTTPResponse, error) {
+			if _, err := h.runAvailabilityPass(ctx); err != nil {
+				return events.APIGatewayV2HTTPResponse{
+					StatusCode: 500,
+					Body:       fmt.Sprintf(`{"error": %q}`, err.Error()),
+				}, nil
+			}
 			return events.APIGatewayV2HTTPResponse{
-				StatusCode: 500,
-				Body:       `{"error": "failed to decode aggregation results"}`,
+				StatusCode: 200,
+				Body:       `{"message": "cloudwatch event processed"}`,
 			}, nil
-		}
-
-		var wg sync.WaitGroup
-		semaphore := make(chan struct{}, 10)
-		for _, lt := range locationTopics {
-			wg.Add(1)
-			go func(lt LocationTopics) {
-				defer wg.Done()
-				semaphore <- struct{}{}
-				defer func() { <-semaphore }()
-				if err := h.checkAvailabilityAndNotify(ctx, "Global Entry", lt.Location, lt.NtfyTopics); err != nil {
-					slog.Error("Failed to check availability", "location", lt.Location, "error", err)
-				}
-			}(lt)
-		}
-		wg.Wait()
-
-		return events.APIGatewayV2HTTPResponse{
-			StatusCode: 200,
-			Body:       `{"message": "cloudwatch event processed"}`,
-		}, nil
+		})
 	}
 
 	// Handle API Gateway V2 HTTP event
@@ -579,6 +2229,61 @@ func (h *LambdaHandler) handleMultiUserMode(ctx context.Context, event json.RawM
 			}, nil
 		}
 		body, _ := eventMap["body"].(string)
+		var httpReq events.APIGatewayV2HTTPRequest
+		_ = json.Unmarshal(event, &httpReq) // Shape already checked above; only used for client details
+		ip := clientIP(httpReq)
+
+		if method == "POST" && strings.HasSuffix(rawPath, "/admin/run") {
+			if resp, ok := h.authorizeAdmin(httpReq); !ok {
+				return resp, nil
+			}
+			return h.withDebugResponse(ctx, func(ctx context.Context) (events.APIGatewayV2HTTPResponse, error) {
+				return h.handleAdminRun(ctx), nil
+			})
+		}
+
+		if method == "GET" && strings.HasSuffix(rawPath, "/admin/subscriptions") {
+			if resp, ok := h.authorizeAdmin(httpReq); !ok {
+				return resp, nil
+			}
+			resp, err := h.runDatabaseRequest(nil, func() (events.APIGatewayV2HTTPResponse, error) {
+				return h.handleAdminSubscriptions(ctx, h.subscriptions(), httpReq.QueryStringParameters)
+			})
+			return h.compressResponse(httpReq, resp), err
+		}
+
+		if method == "GET" && strings.HasSuffix(rawPath, "/history") {
+			if h.History == nil {
+				return errorResponse(404, "availability history is not enabled"), nil
+			}
+			resp, err := h.runDatabaseRequest(nil, func() (events.APIGatewayV2HTTPResponse, error) {
+				return h.handleHistory(ctx, h.historyCollection(), httpReq.QueryStringParameters)
+			})
+			return h.compressResponse(httpReq, resp), err
+		}
+
+		if method == "GET" && strings.HasSuffix(rawPath, "/soonest") {
+			query, _ := eventMap["queryStringParameters"].(map[string]interface{})
+			topic, _ := query["ntfyTopic"].(string)
+			if !validNtfyPattern.MatchString(topic) {
+				return errorResponse(400, "ntfyTopic query parameter is required and must not contain spaces or special characters"), nil
+			}
+			// Limit each client as well as each topic so one caller can't sweep many topics
+			if ip != "" {
+				if wait := h.soonestLimit.allow("ip|" + ip); wait > 0 {
+					slog.Warn("Rate limited soonest request", "clientIP", ip)
+					return tooManyRequestsResponse(retryAfterSeconds(wait)), nil
+				}
+			}
+			if wait := h.soonestLimit.allow(topic); wait > 0 {
+				return tooManyRequestsResponse(retryAfterSeconds(wait)), nil
+			}
+			if resp, ok := h.acquireRequestSlot(); !ok {
+				return resp, nil
+			}
+			defer h.releaseRequestSlot()
+			return h.handleSoonest(ctx, h.subscriptions(), topic)
+		}
 
 		if method == "POST" && strings.HasSuffix(rawPath, "/subscriptions") {
 			if body == "" {
@@ -590,6 +2295,14 @@ func (h *LambdaHandler) handleMultiUserMode(ctx context.Context, event json.RawM
 				}, nil
 			}
 			var subReq SubscriptionRequest
+			if json.Valid([]byte(body)) && !strings.HasPrefix(strings.TrimSpace(body), "{") {
+				slog.Error("Request body is not a JSON object", "body", body)
+				return events.APIGatewayV2HTTPResponse{
+					StatusCode: 400,
+					Headers:    corsHeaders,
+					Body:       `{"error": "request body must be a JSON object with action/location/ntfyTopic"}`,
+				}, nil
+			}
 			if err := json.Unmarshal([]byte(body), &subReq); err != nil {
 				slog.Error("Failed to parse request body", "body", body, "error", err)
 				return events.APIGatewayV2HTTPResponse{
@@ -606,23 +2319,41 @@ func (h *LambdaHandler) handleMultiUserMode(ctx context.Context, event json.RawM
 					Body:       `{"error": "missing required fields"}`,
 				}, nil
 			}
-			slog.Info("Calling handleSubscription", "action", subReq.Action, "location", subReq.Location)
-			resp, err := h.handleSubscription(ctx, coll, subReq)
-			if err != nil {
-				return resp, err
-			}
-			// Ensure response body is JSON string
-			if resp.Body != "" {
-				var bodyMap interface{}
-				if json.Unmarshal([]byte(resp.Body), &bodyMap) == nil {
-					b, err := json.Marshal(bodyMap)
-					if err != nil {
-						slog.Error("Failed to marshal response body", "body", body, "error", err)
-					}
-					resp.Body = string(b)
+			return h.runSubscription(ctx, ip, subReq)
+		}
+
+		if method == "PATCH" && strings.HasSuffix(rawPath, "/subscriptions") {
+			var update SubscriptionUpdate
+			if !strings.HasPrefix(strings.TrimSpace(body), "{") || json.Unmarshal([]byte(body), &update) != nil {
+				slog.Error("Failed to parse request body", "body", body)
+				return errorResponse(400, "request body must be a JSON object with location/ntfyTopic and the fields to update"), nil
+			}
+			if update.Location == "" || update.NtfyTopic == "" {
+				return errorResponse(400, "location and ntfyTopic are required"), nil
+			}
+			slog.Info("Calling handleSubscriptionUpdate", "location", update.Location, "clientIP", ip)
+			return h.runDatabaseRequest(nil, func() (events.APIGatewayV2HTTPResponse, error) {
+				return h.handleSubscriptionUpdate(withClientIP(ctx, ip), h.subscriptions(), update)
+			})
+		}
+
+		// DELETE unsubscribes, taking location and ntfyTopic from a JSON body or the query string
+		if method == "DELETE" && strings.HasSuffix(rawPath, "/subscriptions") {
+			var subReq SubscriptionRequest
+			if strings.TrimSpace(body) != "" {
+				if !strings.HasPrefix(strings.TrimSpace(body), "{") || json.Unmarshal([]byte(body), &subReq) != nil {
+					slog.Error("Failed to parse request body", "body", body)
+					return errorResponse(400, "request body must be a JSON object with location/ntfyTopic"), nil
 				}
+			} else {
+				subReq.Location = httpReq.QueryStringParameters["location"]
+				subReq.NtfyTopic = httpReq.QueryStringParameters["ntfyTopic"]
 			}
-			return resp, nil
+			if subReq.Location == "" || subReq.NtfyTopic == "" {
+				return errorResponse(400, "location and ntfyTopic are required"), nil
+			}
+			subReq.Action = "unsubscribe"
+			return h.runSubscription(ctx, ip, subReq)
 		}
 	}
 
@@ -636,12 +2367,26 @@ func (h *LambdaHandler) handleMultiUserMode(ctx context.Context, event json.RawM
 
 // HandleRequest handles Scheduled Events and API requests - unified entry point
 func (h *LambdaHandler) HandleRequest(ctx context.Context, event json.RawMessage) (events.APIGatewayV2HTTPResponse, error) {
+	if h.Mode.shared().PushgatewayURL != "" {
+		h.metrics.reset()
+		defer h.pushMetrics(ctx)
+	}
+	// Lambda freezes the container once the handler returns, so background work must finish first
+	defer h.background.Wait()
+
 	if h.Mode.IsPersonalMode {
 		// Personal mode only handles CloudWatch events
 		var eventMap map[string]interface{}
 		if err := json.Unmarshal(event, &eventMap); err == nil {
-			if source, ok := eventMap["source"].(string); ok && source == "aws.events" {
-				return h.handlePersonalMode(ctx)
+			if isDailySummaryEvent(eventMap) {
+				return h.handleDailySummary(ctx)
+			}
+			if h.isScheduledEvent(eventMap) {
+				if !h.scheduledCheckDue(time.Now()) {
+					return scheduleSkippedResponse(), nil
+				}
+				h.waitStartupJitter(ctx)
+				return h.withDebugResponse(ctx, h.handlePersonalMode)
 			}
 		}
 		// Personal mode doesn't handle API requests
@@ -657,13 +2402,20 @@ func (h *LambdaHandler) HandleRequest(ctx context.Context, event json.RawMessage
 
 func main() {
 	// Initialize structured logging
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	slog.SetDefault(slog.New(newLogHandler(os.Stdout, "")))
 
 	// Detect application mode
 	mode, err := detectAppMode()
 	if err != nil {
 		panic(fmt.Sprintf("failed to detect app mode: %v", err))
 	}
+	if redaction := mode.shared().LogTopicRedaction; redaction != "" {
+		slog.SetDefault(slog.New(newLogHandler(os.Stdout, redaction)))
+	}
+	logEffectiveConfig(mode)
+	if mode.shared().DebugResponse {
+		slog.Warn("DEBUG_RESPONSE is on, responses include evaluated appointments; turn it off in production")
+	}
 
 	var client *mongo.Client
 	if !mode.IsPersonalMode {
@@ -684,5 +2436,51 @@ func main() {
 	// URL is empty for production (will use real API), set for testing
 	url := ""
 	handler := NewLambdaHandler(mode, url, client)
+	if mode.IsPersonalMode && mode.PersonalConfig.DedupTable != "" {
+		// Personal mode has no database, so dedup state lives in DynamoDB when a table is configured
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			panic(fmt.Sprintf("failed to load AWS config: %v", err))
+		}
+		handler.Dedup = newDynamoDedupStore(dynamodb.NewFromConfig(awsCfg), mode.PersonalConfig.DedupTable)
+	}
+	if !mode.IsPersonalMode {
+		if err := handler.ensureSubscriptionIndex(context.Background()); err != nil {
+			slog.Warn("Duplicate subscriptions are not prevented", "error", err)
+		}
+	}
+	if auditLogger, ok := handler.Audit.(*mongoAuditLogger); ok {
+		if err := auditLogger.ensureTTLIndex(context.Background()); err != nil {
+			slog.Warn("Audit entries will not expire", "error", err)
+		}
+	}
+	if dedup, ok := handler.Dedup.(*mongoDedupStore); ok {
+		if err := dedup.ensureTTLIndex(context.Background()); err != nil {
+			slog.Warn("Notification dedup keys will not expire", "error", err)
+		}
+	}
+	if history, ok := handler.History.(*mongoAvailabilityHistory); ok {
+		if err := history.ensureIndexes(context.Background()); err != nil {
+			slog.Warn("Availability history will not expire", "error", err)
+		}
+	}
+	if mode.shared().WebhookDLQURL != "" {
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			panic(fmt.Sprintf("failed to load AWS config: %v", err))
+		}
+		handler.Deliveries = newSQSDeliveryStore(sqs.NewFromConfig(awsCfg), mode.shared().WebhookDLQURL)
+	}
+	if arn := mode.shared().SNSTopicARN; arn != "" {
+		// SNS gets each appointment event once; ntfy still reaches every subscribed topic
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			panic(fmt.Sprintf("failed to load AWS config: %v", err))
+		}
+		handler.Events = newSnsEventPublisher(sns.NewFromConfig(awsCfg), arn)
+	}
+	if mode.shared().NotifierSelfTest {
+		handler.checkNotifierConnectivity(context.Background())
+	}
 	lambda.Start(handler.HandleRequest)
 }
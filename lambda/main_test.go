@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
 // setupTestHandler creates a LambdaHandler and MongoDB container for testing (multi-user mode)
@@ -159,6 +162,31 @@ func TestHandleRequest_CloudWatchEvent(t *testing.T) {
 	assert.Equal(t, 2, ntfyCalls, "Expected two ntfy notifications")
 }
 
+func TestHandleRequest_CloudWatchEventNoSubscriptions(t *testing.T) {
+	handler, _, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	apiCalls := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
+		json.NewEncoder(w).Encode([]Appointment{})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	resp, err := handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"message": "cloudwatch event processed"}`, resp.Body)
+	assert.Equal(t, 0, apiCalls, "an empty collection should not reach the TTP API")
+
+	summary, err := handler.runAvailabilityPass(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, runSummary{}, summary)
+}
+
 func TestHandleRequest_APIGatewaySubscribe(t *testing.T) {
 	handler, coll, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -241,6 +269,212 @@ func TestHandleRequest_APIGatewayUnsubscribe(t *testing.T) {
 	assert.Equal(t, int64(0), count)
 }
 
+func TestHandleRequest_APIGatewayDeleteSubscription(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	deleteRequest := func(body string, query map[string]string) events.APIGatewayV2HTTPResponse {
+		apiReq := events.APIGatewayV2HTTPRequest{
+			Version:               "2.0",
+			RouteKey:              "DELETE /subscriptions",
+			RawPath:               "/subscriptions",
+			QueryStringParameters: query,
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "DELETE", Path: "/subscriptions"},
+			},
+			Body: body,
+		}
+		eventJSON, _ := json.Marshal(apiReq)
+		resp, err := handler.HandleRequest(ctx, eventJSON)
+		assert.NoError(t, err)
+		return resp
+	}
+	for _, topic := range []string{"user1-jfk", "user2-jfk"} {
+		_, err := coll.InsertOne(ctx, bson.M{"location": "JFK", "ntfyTopic": topic, "createdAt": time.Now().UTC()})
+		assert.NoError(t, err)
+	}
+
+	// JSON body
+	resp := deleteRequest(`{"location":"JFK","ntfyTopic":"user1-jfk"}`, nil)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"message": "Unsubscribed successfully"}`, resp.Body)
+
+	// Query parameters
+	resp = deleteRequest("", map[string]string{"location": "JFK", "ntfyTopic": "user2-jfk"})
+	assert.Equal(t, 200, resp.StatusCode)
+
+	count, err := coll.CountDocuments(ctx, bson.M{"location": "JFK"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	// Already removed
+	resp = deleteRequest("", map[string]string{"location": "JFK", "ntfyTopic": "user2-jfk"})
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestHandleRequest_APIGatewayDeleteSubscriptionValidation(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+
+	tests := []struct {
+		name  string
+		body  string
+		query map[string]string
+	}{
+		{name: "no body or query"},
+		{name: "missing topic in query", query: map[string]string{"location": "JFK"}},
+		{name: "missing location in body", body: `{"ntfyTopic":"user1-jfk"}`},
+		{name: "non-object body", body: `["JFK","user1-jfk"]`},
+		{name: "malformed body", body: `{"location":`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			apiReq := events.APIGatewayV2HTTPRequest{
+				RawPath:               "/subscriptions",
+				QueryStringParameters: tc.query,
+				RequestContext: events.APIGatewayV2HTTPRequestContext{
+					HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "DELETE", Path: "/subscriptions"},
+				},
+				Body: tc.body,
+			}
+			eventJSON, _ := json.Marshal(apiReq)
+			resp, err := handler.HandleRequest(context.Background(), eventJSON)
+			assert.NoError(t, err)
+			assert.Equal(t, 400, resp.StatusCode)
+			assert.Equal(t, corsHeaders, resp.Headers)
+		})
+	}
+}
+
+func TestHandleRequest_APIGatewayPatchSubscription(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	_, err := coll.InsertOne(ctx, bson.M{"location": "JFK", "ntfyTopic": "user1-jfk", "createdAt": createdAt, "oneShot": true, "priority": 3})
+	assert.NoError(t, err)
+
+	patch := func(body string) events.APIGatewayV2HTTPResponse {
+		apiReq := events.APIGatewayV2HTTPRequest{
+			Version:  "2.0",
+			RouteKey: "PATCH /subscriptions",
+			RawPath:  "/subscriptions",
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "PATCH", Path: "/subscriptions"},
+			},
+			Body: body,
+		}
+		eventJSON, _ := json.Marshal(apiReq)
+		resp, err := handler.HandleRequest(ctx, eventJSON)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	targetDate := time.Now().AddDate(0, 1, 0).Format(dateLayout)
+	resp := patch(`{"location":"JFK","ntfyTopic":"user1-jfk","targetDate":"` + targetDate + `","tags":["star"],"locale":"es-MX","oneShot":false}`)
+	assert.Equal(t, 200, resp.StatusCode)
+	var view subscriptionView
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &view))
+	assert.Equal(t, subscriptionView{
+		Location:    "JFK",
+		NtfyTopic:   "user1-jfk",
+		ServiceType: "Global Entry",
+		TargetDate:  targetDate,
+		Priority:    3,
+		Tags:        []string{"star"},
+		Locale:      "es",
+		CreatedAt:   createdAt,
+	}, view)
+
+	// Empty values clear a preference
+	resp = patch(`{"location":"JFK","ntfyTopic":"user1-jfk","priority":0,"tags":[]}`)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &view))
+	assert.Zero(t, view.Priority)
+	assert.Empty(t, view.Tags)
+	assert.Equal(t, "es", view.Locale)
+
+	resp = patch(`{"location":"JFK","ntfyTopic":"someone-else","priority":5}`)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestHandleSubscriptionUpdate_Validation(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	tooManyTags := []string{"a", "b", "c", "d", "e", "f"}
+
+	tests := []struct {
+		name    string
+		update  SubscriptionUpdate
+		wantErr string
+	}{
+		{name: "no fields", wantErr: "no preference fields to update"},
+		{name: "past target date", update: SubscriptionUpdate{TargetDate: str("2000-01-01")}, wantErr: "targetDate"},
+		{name: "malformed target date", update: SubscriptionUpdate{TargetDate: str("01/02/2030")}, wantErr: "targetDate"},
+		{name: "priority out of range", update: SubscriptionUpdate{Priority: num(6)}, wantErr: "priority"},
+		{name: "too many tags", update: SubscriptionUpdate{Tags: &tooManyTags}, wantErr: "tags"},
+		{name: "unsupported locale", update: SubscriptionUpdate{Locale: str("fr")}, wantErr: "locale"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.update.Location, tc.update.NtfyTopic = "JFK", "user1-jfk"
+			resp, err := handler.handleSubscriptionUpdate(context.Background(), nil, tc.update)
+			assert.NoError(t, err)
+			assert.Equal(t, 400, resp.StatusCode)
+			assert.Contains(t, resp.Body, tc.wantErr)
+		})
+	}
+}
+
+func TestHandleRequest_PatchRejectedInPersonalMode(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	apiReq := events.APIGatewayV2HTTPRequest{
+		RawPath: "/subscriptions",
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "PATCH", Path: "/subscriptions"},
+		},
+		Body: `{"location":"JFK","ntfyTopic":"user1-jfk","priority":5}`,
+	}
+	eventJSON, _ := json.Marshal(apiReq)
+	resp, err := handler.HandleRequest(context.Background(), eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestHandleSubscription_MaxSubscriptionsPerTopic(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	handler.Mode.MultiUserConfig.MaxSubscriptionsPerTopic = 2
+
+	subscribe := func(location, topic string) events.APIGatewayV2HTTPResponse {
+		resp, err := handler.handleSubscription(ctx, coll, SubscriptionRequest{Action: "subscribe", Location: location, NtfyTopic: topic})
+		assert.NoError(t, err)
+		return resp
+	}
+	assert.Equal(t, 200, subscribe("5300", "user1").StatusCode)
+	assert.Equal(t, 200, subscribe("5020", "user1").StatusCode)
+
+	resp := subscribe("5140", "user1")
+	assert.Equal(t, 403, resp.StatusCode)
+	assert.JSONEq(t, `{"error": "ntfyTopic already has the maximum of 2 subscriptions; unsubscribe from a location first"}`, resp.Body)
+
+	// Other topics have their own allowance, and freeing a slot allows a new location
+	assert.Equal(t, 200, subscribe("5140", "user2").StatusCode)
+	_, err := handler.handleSubscription(ctx, coll, SubscriptionRequest{Action: "unsubscribe", Location: "5300", NtfyTopic: "user1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, subscribe("5140", "user1").StatusCode)
+
+	// Zero disables the limit
+	handler.Mode.MultiUserConfig.MaxSubscriptionsPerTopic = 0
+	assert.Equal(t, 200, subscribe("5300", "user1").StatusCode)
+}
+
 func TestHandleRequest_InvalidEvent(t *testing.T) {
 	handler, _, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -324,17 +558,20 @@ func TestCheckAvailabilityAndNotify_APIFailure(t *testing.T) {
 	ctx := context.Background()
 
 	// Mock Global Entry API (failing)
+	apiCalls := 0
 	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
 		http.Error(w, "Server Error", http.StatusInternalServerError)
 	}))
 	defer apiServer.Close()
 	handler.URL = apiServer.URL + "/%s"
 	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
 
-	// Call function
+	// Call function: 500 is transient, so it is retried before failing
 	err := handler.checkAvailabilityAndNotify(ctx, "Global Entry", "JFK", []string{"user1-jfk"})
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "API returned status 500")
+	assert.Contains(t, err.Error(), "API returned status 500 after 3 attempts")
+	assert.Equal(t, 3, apiCalls)
 }
 
 func TestHandleExpiringSubscriptions(t *testing.T) {
@@ -411,6 +648,42 @@ func TestHandleSubscription_Duplicate(t *testing.T) {
 	assert.JSONEq(t, `{"error": "subscription already exists"}`, resp.Body)
 }
 
+func TestHandleSubscription_ConcurrentDuplicate(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	assert.NoError(t, handler.ensureSubscriptionIndex(ctx))
+
+	// Identical requests racing past the existence check must still store one subscription
+	req := SubscriptionRequest{Action: "subscribe", Location: "5300", NtfyTopic: "race-topic"}
+	responses := make([]events.APIGatewayV2HTTPResponse, 5)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := handler.handleSubscription(ctx, coll, req)
+			assert.NoError(t, err)
+			responses[i] = resp
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, resp := range responses {
+		if resp.StatusCode == 200 {
+			created++
+			continue
+		}
+		assert.Equal(t, 400, resp.StatusCode)
+		assert.JSONEq(t, `{"error": "subscription already exists"}`, resp.Body)
+	}
+	assert.Equal(t, 1, created)
+	count, err := coll.CountDocuments(ctx, bson.M{"location": "5300", "ntfyTopic": "race-topic"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
 func TestHandleSubscription_UnsubscribeNotFound(t *testing.T) {
 	handler, coll, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -639,34 +912,76 @@ func TestDetectAppMode_MultiUser(t *testing.T) {
 }
 
 func TestGetAppointmentURL(t *testing.T) {
+	cfg := &SharedConfig{}
+
 	// Test Global Entry URL
-	url := getAppointmentURL("Global Entry", "5300", 1)
+	url := getAppointmentURL(cfg, "Global Entry", "5300", 1)
 	expected := "https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=soonest&limit=1&locationId=5300&minimum=1"
 	assert.Equal(t, expected, url)
 
 	// Test Global Entry URL with minimum 2
-	url2 := getAppointmentURL("Global Entry", "5300", 2)
+	url2 := getAppointmentURL(cfg, "Global Entry", "5300", 2)
 	expected2 := "https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=soonest&limit=1&locationId=5300&minimum=2"
 	assert.Equal(t, expected2, url2)
 
 	// Test NEXUS URL with specific location
-	nexusURL := getAppointmentURL("NEXUS", "5020", 1)
+	nexusURL := getAppointmentURL(cfg, "NEXUS", "5020", 1)
 	expectedNexus := "https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=soonest&limit=1&locationId=5020&minimum=1"
 	assert.Equal(t, expectedNexus, nexusURL)
 
 	// Test NEXUS asLocations URL (no specific location)
-	nexusAsLocationsURL := getAppointmentURL("NEXUS", "", 2)
+	nexusAsLocationsURL := getAppointmentURL(cfg, "NEXUS", "", 2)
 	expectedNexusAsLocations := "https://ttp.cbp.dhs.gov/schedulerapi/slots/asLocations?minimum=2&limit=5&serviceName=NEXUS"
 	assert.Equal(t, expectedNexusAsLocations, nexusAsLocationsURL)
 
 	// Test default (empty service type should default to Global Entry)
-	defaultURL := getAppointmentURL("", "5300", 1)
+	defaultURL := getAppointmentURL(cfg, "", "5300", 1)
 	assert.Equal(t, expected, defaultURL)
+
+	// Test overridden slots path
+	override := &SharedConfig{SlotsPath: "/schedulerapi/v2/slots/"}
+	overrideURL := getAppointmentURL(override, "Global Entry", "5300", 1)
+	assert.Equal(t, "https://ttp.cbp.dhs.gov/schedulerapi/v2/slots?orderBy=soonest&limit=1&locationId=5300&minimum=1", overrideURL)
+	overrideNexusURL := getAppointmentURL(override, "NEXUS", "", 1)
+	assert.Equal(t, "https://ttp.cbp.dhs.gov/schedulerapi/v2/slots/asLocations?minimum=1&limit=5&serviceName=NEXUS", overrideNexusURL)
+
+	// Test configured asLocations scan size
+	wide := &SharedConfig{NexusScanLimit: 20}
+	assert.Equal(t, "https://ttp.cbp.dhs.gov/schedulerapi/slots/asLocations?minimum=3&limit=20&serviceName=NEXUS", getAppointmentURL(wide, "NEXUS", "", 3))
+	assert.Equal(t, expected, getAppointmentURL(wide, "Global Entry", "5300", 1), "single-location queries keep limit=1")
+
+	// Test latest ordering
+	latest := &SharedConfig{OrderBy: "latest"}
+	assert.Equal(t, "https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=latest&limit=1&locationId=5300&minimum=1", getAppointmentURL(latest, "Global Entry", "5300", 1))
+	assert.Equal(t, "https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=latest&limit=1&locationId=5020&minimum=1", getAppointmentURL(latest, "NEXUS", "5020", 1))
+	assert.Equal(t, "https://ttp.cbp.dhs.gov/schedulerapi/slots?orderBy=soonest&limit=10&locationId=5300&minimum=1", getSoonestAppointmentURL(latest, "Global Entry", "5300", 1), "soonest queries ignore ORDER_BY")
+}
+
+func TestPersonalMode_NexusScanMinimum(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Mode.PersonalConfig.ServiceType = "NEXUS"
+	handler.Mode.PersonalConfig.LocationID = ""
+	handler.Mode.PersonalConfig.MinimumSlots = "1,2"
+	ttp := &stubTTPClient{responses: []stubTTPResponse{{body: `[]`}}}
+	handler.TTP = ttp
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+
+	handler.HandleRequest(context.Background(), eventJSON)
+	assert.Equal(t, []int{1, 2}, ttp.calls, "MINIMUM_SLOTS applies by default")
+
+	ttp.calls = nil
+	handler.Mode.PersonalConfig.NexusScanMinimum = 3
+	handler.HandleRequest(context.Background(), eventJSON)
+	assert.Equal(t, []int{3}, ttp.calls)
+
+	problems := (&SharedConfig{NexusScanLimit: 51, NexusScanMinimum: -1}).validate()
+	assert.Len(t, problems, 2)
 }
 
 func TestGetNotificationTitle(t *testing.T) {
-	assert.Equal(t, "Global Entry Appointment Notification", getNotificationTitle("Global Entry"))
-	assert.Equal(t, "NEXUS Appointment Notification", getNotificationTitle("NEXUS"))
+	assert.Equal(t, "Global Entry Appointment Notification", getNotificationTitle("Global Entry", ""))
+	assert.Equal(t, "NEXUS Appointment Notification", getNotificationTitle("NEXUS", ""))
 }
 
 func TestParseMinimumSlots(t *testing.T) {
@@ -699,6 +1014,1284 @@ func TestParseMinimumSlots(t *testing.T) {
 	assert.Equal(t, []int{1}, result)
 }
 
+func TestParseServiceMinimums(t *testing.T) {
+	both := []string{"Global Entry", "NEXUS"}
+	tests := []struct {
+		spec    string
+		want    map[string][]int
+		wantErr string
+	}{
+		{spec: "1,2", want: map[string][]int{"Global Entry": {1, 2}, "NEXUS": {1, 2}}},
+		{spec: "Global Entry=2,NEXUS=1", want: map[string][]int{"Global Entry": {2}, "NEXUS": {1}}},
+		{spec: "global entry=3, 2 ,nexus=1", want: map[string][]int{"Global Entry": {3, 2}, "NEXUS": {1}}},
+		{spec: "NEXUS=2", want: map[string][]int{"Global Entry": {1}, "NEXUS": {2}}},
+		{spec: "SENTRI=2", wantErr: `names unknown service "SENTRI"`},
+		{spec: "1,NEXUS=2", wantErr: "must be positive whole numbers"},
+		{spec: "NEXUS=0", wantErr: "must be positive whole numbers"},
+		{spec: "", wantErr: "must be positive whole numbers"},
+	}
+	for _, tt := range tests {
+		got, err := parseServiceMinimums(both, tt.spec)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, tt.spec) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+			continue
+		}
+		assert.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, got, tt.spec)
+	}
+}
+
+func TestPersonalMode_MultipleServiceTypes(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Watch both services from one deployment
+	handler.Mode.PersonalConfig.ServiceType = "Global Entry,NEXUS"
+
+	// Mock HTTP server for the TTP API
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2025-05-04T10:00:00Z", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	// Mock ntfy server
+	var titles []string
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		titles = append(titles, payload["title"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	// Create CloudWatch event
+	event := events.CloudWatchEvent{Source: "aws.events"}
+	eventJSON, _ := json.Marshal(event)
+
+	// Invoke handler
+	resp, err := handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// Verify one notification per service
+	assert.Equal(t, []string{"Global Entry Appointment Notification", "NEXUS Appointment Notification"}, titles)
+}
+
+func TestParseServiceTypes(t *testing.T) {
+	assert.Equal(t, []string{"Global Entry"}, parseServiceTypes("Global Entry"))
+	assert.Equal(t, []string{"Global Entry", "NEXUS"}, parseServiceTypes("Global Entry, nexus"))
+	assert.Equal(t, []string{"NEXUS"}, parseServiceTypes("NEXUS,NEXUS,invalid"))
+	assert.Equal(t, []string{"Global Entry"}, parseServiceTypes(""))
+}
+
+func TestParseServiceLocations(t *testing.T) {
+	services := []string{"Global Entry", "NEXUS"}
+
+	// Shared location for all services
+	assert.Equal(t, map[string]string{"Global Entry": "5300", "NEXUS": "5300"}, parseServiceLocations(services, "5300"))
+
+	// Per-service locations
+	result := parseServiceLocations(services, "Global Entry=5300, nexus=5020")
+	assert.Equal(t, map[string]string{"Global Entry": "5300", "NEXUS": "5020"}, result)
+
+	// Services without a mapping are omitted
+	result = parseServiceLocations(services, "NEXUS=5020")
+	assert.Equal(t, map[string]string{"NEXUS": "5020"}, result)
+}
+
+func TestStartupJitter(t *testing.T) {
+	// Disabled by default
+	assert.Equal(t, time.Duration(0), startupJitter(0))
+	assert.Equal(t, time.Duration(0), startupJitter(-5))
+
+	// Within the configured range
+	for i := 0; i < 100; i++ {
+		delay := startupJitter(3)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, 3*time.Second)
+	}
+
+	// Capped well under the Lambda timeout
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, startupJitter(600), maxStartupJitter)
+	}
+}
+
+func TestPersonalMode_NexusAsLocations(t *testing.T) {
+	// Realistic asLocations payload trimmed to the fields we rely on
+	asLocationsPayload := `[
+		{"id": 5020, "name": "Blaine NEXUS and FAST Enrollment Center", "shortName": "Blaine", "city": "Blaine", "state": "WA", "countryCode": "US", "tzData": "America/Los_Angeles", "temporary": false, "inviteOnly": false, "operational": true, "services": [{"id": 3, "name": "NEXUS"}]},
+		{"id": 5000, "name": "Peace Bridge NEXUS Enrollment Center", "shortName": "Peace Bridge", "city": "Buffalo", "state": "NY", "countryCode": "US", "tzData": "America/New_York", "temporary": false, "inviteOnly": false, "operational": true, "services": [{"id": 3, "name": "NEXUS"}]}
+	]`
+
+	tests := []struct {
+		name             string
+		payload          string
+		expectedCalls    int
+		expectedContains []string
+	}{
+		{
+			name:             "multiple locations",
+			payload:          asLocationsPayload,
+			expectedCalls:    1,
+			expectedContains: []string{"Blaine NEXUS and FAST Enrollment Center (5020)", "Peace Bridge NEXUS Enrollment Center (5000)", "(minimum 1 slots)"},
+		},
+		{
+			name:             "single location",
+			payload:          `[{"id": 5020, "name": "Blaine NEXUS and FAST Enrollment Center", "operational": true}]`,
+			expectedCalls:    1,
+			expectedContains: []string{"NEXUS appointments available at Blaine NEXUS and FAST Enrollment Center (5020)"},
+		},
+		{
+			name:          "no locations",
+			payload:       `[]`,
+			expectedCalls: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, cleanup := setupPersonalTestHandler(t)
+			defer cleanup()
+			ctx := context.Background()
+
+			// NEXUS without a location scans all locations
+			handler.Mode.PersonalConfig.ServiceType = "NEXUS"
+			handler.Mode.PersonalConfig.LocationID = ""
+
+			// Mock asLocations API
+			apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.payload))
+			}))
+			defer apiServer.Close()
+			handler.URL = apiServer.URL + "/%s"
+
+			// Mock ntfy server
+			ntfyCalls := 0
+			var message string
+			ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ntfyCalls++
+				var payload map[string]string
+				json.NewDecoder(r.Body).Decode(&payload)
+				assert.Equal(t, "NEXUS Appointment Notification", payload["title"])
+				message = payload["message"]
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ntfyServer.Close()
+			handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+			handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+			// Create CloudWatch event
+			event := events.CloudWatchEvent{Source: "aws.events"}
+			eventJSON, _ := json.Marshal(event)
+
+			// Invoke handler
+			resp, err := handler.HandleRequest(ctx, eventJSON)
+			assert.NoError(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+
+			// Verify notified locations
+			assert.Equal(t, tt.expectedCalls, ntfyCalls)
+			for _, expected := range tt.expectedContains {
+				assert.Contains(t, message, expected)
+			}
+		})
+	}
+}
+
+func TestDetectAppMode_PersonalLocationRequired(t *testing.T) {
+	os.Setenv("PERSONAL_MODE", "true")
+	os.Setenv("NTFY_TOPIC", "my-topic")
+	defer func() {
+		os.Unsetenv("PERSONAL_MODE")
+		os.Unsetenv("SERVICE_TYPE")
+		os.Unsetenv("NTFY_TOPIC")
+	}()
+
+	// Global Entry requires a location
+	_, err := detectAppMode()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "LOCATION_ID is required for Global Entry")
+
+	// NEXUS can scan all locations
+	os.Setenv("SERVICE_TYPE", "NEXUS")
+	mode, err := detectAppMode()
+	assert.NoError(t, err)
+	assert.Equal(t, "", mode.PersonalConfig.LocationID)
+}
+
+func TestDetectAppMode_InvalidSlotsPath(t *testing.T) {
+	os.Setenv("MONGODB_PASSWORD", "test123")
+	os.Setenv("SLOTS_PATH", "schedulerapi/slots")
+	defer func() {
+		os.Unsetenv("MONGODB_PASSWORD")
+		os.Unsetenv("SLOTS_PATH")
+	}()
+
+	_, err := detectAppMode()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SLOTS_PATH must start with")
+}
+
+func TestHandleRequest_ServiceUnavailable(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	// Create API Gateway V2 request
+	req := SubscriptionRequest{Action: "subscribe", Location: "JFK", NtfyTopic: "user1-jfk"}
+	body, _ := json.Marshal(req)
+	apiReq := events.APIGatewayV2HTTPRequest{
+		Version:  "2.0",
+		RouteKey: "POST /subscriptions",
+		RawPath:  "/subscriptions",
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method: "POST",
+				Path:   "/subscriptions",
+			},
+		},
+		Body:            string(body),
+		IsBase64Encoded: false,
+	}
+	eventJSON, _ := json.Marshal(apiReq)
+
+	newHandler := func() *LambdaHandler {
+		mode := &AppMode{
+			MultiUserConfig: &Config{
+				MongoDBPassword:               "test",
+				MaxConcurrentRequests:         1,
+				CircuitBreakerThreshold:       1,
+				CircuitBreakerCooldownSeconds: 30,
+			},
+		}
+		return NewLambdaHandler(mode, "", nil) // Requests are rejected before touching MongoDB
+	}
+
+	t.Run("circuit breaker open", func(t *testing.T) {
+		handler := newHandler()
+		handler.breaker.recordFailure()
+
+		resp, err := handler.HandleRequest(ctx, eventJSON)
+		assert.NoError(t, err)
+		assert.Equal(t, 503, resp.StatusCode)
+		assert.Equal(t, "30", resp.Headers["Retry-After"])
+		assert.Equal(t, "https://arun0009.github.io", resp.Headers["Access-Control-Allow-Origin"])
+	})
+
+	t.Run("concurrency saturated", func(t *testing.T) {
+		handler := newHandler()
+		handler.requestSlots <- struct{}{}
+
+		resp, err := handler.HandleRequest(ctx, eventJSON)
+		assert.NoError(t, err)
+		assert.Equal(t, 503, resp.StatusCode)
+		assert.Equal(t, "1", resp.Headers["Retry-After"])
+	})
+
+	// Shared CORS headers must not pick up Retry-After
+	_, ok := corsHeaders["Retry-After"]
+	assert.False(t, ok)
+}
+
+func TestDetectAppMode_InvalidNtfyFormat(t *testing.T) {
+	os.Setenv("MONGODB_PASSWORD", "test123")
+	os.Setenv("NTFY_FORMAT", "xml")
+	defer func() {
+		os.Unsetenv("MONGODB_PASSWORD")
+		os.Unsetenv("NTFY_FORMAT")
+	}()
+
+	_, err := detectAppMode()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "NTFY_FORMAT must be")
+}
+
+func TestCheckAvailabilityAndNotify_AutoUnsubscribeAfterFailures(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Insert subscriptions one failure away from the threshold
+	handler.Mode.MultiUserConfig.MaxDeliveryFailures = 3
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "JFK", "ntfyTopic": "dead-topic", "createdAt": time.Now().UTC(), "failureCount": 2},
+		bson.M{"location": "JFK", "ntfyTopic": "live-topic", "createdAt": time.Now().UTC(), "failureCount": 2},
+	})
+	assert.NoError(t, err)
+
+	// Mock Global Entry API
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 123, StartTimestamp: "2025-05-04T10:00:00Z", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	// Mock ntfy server rejecting one topic
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["topic"] == "dead-topic" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.MultiUserConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	// Call function
+	err = handler.checkAvailabilityAndNotify(ctx, "Global Entry", "JFK", []string{"dead-topic", "live-topic"})
+	assert.Error(t, err)
+
+	// Verify failing topic removed
+	count, err := coll.CountDocuments(ctx, bson.M{"ntfyTopic": "dead-topic"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	// Verify successful topic kept with its failure count reset
+	var live bson.M
+	err = coll.FindOne(ctx, bson.M{"ntfyTopic": "live-topic"}).Decode(&live)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, live["failureCount"])
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	// Caps the request deadline
+	ctx, cancel := withRequestTimeout(context.Background(), time.Second)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+
+	// A sooner parent deadline still applies
+	parent, parentCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer parentCancel()
+	ctx, cancel = withRequestTimeout(parent, time.Minute)
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	parentDeadline, _ := parent.Deadline()
+	assert.Equal(t, parentDeadline, deadline)
+
+	// Zero leaves the context without a new deadline
+	ctx, cancel = withRequestTimeout(context.Background(), 0)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+}
+
+func TestPersonalMode_APIRequestTimeout(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Slow TTP API that exceeds the per-request cap
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+		json.NewEncoder(w).Encode([]Appointment{})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+	handler.Mode.PersonalConfig.RequestTimeoutSeconds = 1
+	handler.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+	_, err := handler.checkSingleMinimum(ctx, "Global Entry", "5300", subscribersForTopics([]string{"test-topic"}), 1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed after 3 attempts")
+}
+
+func TestHandleRequest_APIGatewayNonObjectBody(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+	mode := &AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}
+	handler := NewLambdaHandler(mode, "", nil) // Rejected before touching MongoDB
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "array", body: `[{"action": "subscribe", "location": "JFK", "ntfyTopic": "user1-jfk"}]`},
+		{name: "number", body: `42`},
+		{name: "string", body: `"subscribe"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiReq := events.APIGatewayV2HTTPRequest{
+				Version:  "2.0",
+				RouteKey: "POST /subscriptions",
+				RawPath:  "/subscriptions",
+				RequestContext: events.APIGatewayV2HTTPRequestContext{
+					HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+						Method: "POST",
+						Path:   "/subscriptions",
+					},
+				},
+				Body:            tt.body,
+				IsBase64Encoded: false,
+			}
+			eventJSON, _ := json.Marshal(apiReq)
+
+			resp, err := handler.HandleRequest(ctx, eventJSON)
+			assert.NoError(t, err)
+			assert.Equal(t, 400, resp.StatusCode)
+			assert.JSONEq(t, `{"error": "request body must be a JSON object with action/location/ntfyTopic"}`, resp.Body)
+		})
+	}
+}
+
+func TestSubscribersForSlot(t *testing.T) {
+	subscribers := []Subscriber{
+		{Topic: "no-deadline"},
+		{Topic: "before-slot", TargetDate: "2025-05-03"},
+		{Topic: "on-slot-day", TargetDate: "2025-05-04"},
+		{Topic: "after-slot", TargetDate: "2025-06-01"},
+	}
+
+	result := subscribersForSlot(subscribers, "2025-05-04T10:00")
+	assert.Equal(t, []Subscriber{subscribers[0], subscribers[2], subscribers[3]}, result)
+}
+
+func TestTargetDate(t *testing.T) {
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+
+	assert.False(t, targetDatePassed("", now))
+	assert.False(t, targetDatePassed("2025-05-04", now))
+	assert.True(t, targetDatePassed("2025-05-03", now))
+
+	assert.NoError(t, validateTargetDate("2025-05-04", now))
+	assert.EqualError(t, validateTargetDate("2025-05-03", now), "targetDate must not be in the past")
+	assert.EqualError(t, validateTargetDate("05/04/2025", now), "targetDate must be a date in YYYY-MM-DD format")
+}
+
+func TestPersonalMode_TargetDate(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Mock HTTP server returning a slot far in the future
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2999-05-04T10:00", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	// Mock ntfy server
+	ntfyCalls := 0
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ntfyCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	event := events.CloudWatchEvent{Source: "aws.events"}
+	eventJSON, _ := json.Marshal(event)
+
+	// Slot after the target date is not notified
+	handler.Mode.PersonalConfig.TargetDate = "2998-12-31"
+	resp, err := handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 0, ntfyCalls)
+
+	// Slot on the target date is notified
+	handler.Mode.PersonalConfig.TargetDate = "2999-05-04"
+	_, err = handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ntfyCalls)
+
+	// Checks stop once the target date has passed
+	handler.Mode.PersonalConfig.TargetDate = "2000-01-01"
+	resp, err = handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"message": "target date has passed"}`, resp.Body)
+	assert.Equal(t, 1, ntfyCalls)
+}
+
+func TestHandleSubscription_TargetDate(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Reject a past target date
+	req := SubscriptionRequest{Action: "subscribe", Location: "JFK", NtfyTopic: "user1-jfk", TargetDate: "2000-01-01"}
+	resp, err := handler.handleSubscription(ctx, coll, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.JSONEq(t, `{"error": "targetDate must not be in the past"}`, resp.Body)
+
+	// Store a valid target date
+	req.TargetDate = "2999-01-01"
+	resp, err = handler.handleSubscription(ctx, coll, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	count, err := coll.CountDocuments(ctx, bson.M{"location": "JFK", "ntfyTopic": "user1-jfk", "targetDate": "2999-01-01"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestHandlePassedTargetDates(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Insert one subscription past its target date and one still active
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "JFK", "ntfyTopic": "user1-jfk", "createdAt": time.Now().UTC(), "targetDate": "2000-01-01"},
+		bson.M{"location": "JFK", "ntfyTopic": "user2-jfk", "createdAt": time.Now().UTC(), "targetDate": "2999-01-01"},
+	})
+	assert.NoError(t, err)
+
+	// Mock ntfy server
+	var topics []string
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		topics = append(topics, payload["topic"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.MultiUserConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	err = handler.handlePassedTargetDates(ctx, coll)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user1-jfk"}, topics)
+
+	// Verify only the passed subscription was removed
+	count, err := coll.CountDocuments(ctx, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRemovalNotice_ReplacesWarnings(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	handler.Mode.MultiUserConfig.NotifyOnRemoval = true
+
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "JFK", "ntfyTopic": "expired", "createdAt": time.Now().UTC().Add(-30 * 24 * time.Hour)},
+		bson.M{"location": "JFK", "ntfyTopic": "past", "createdAt": time.Now().UTC(), "targetDate": "2000-01-01"},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, handler.handleExpiringSubscriptions(ctx, coll))
+	assert.NoError(t, handler.handlePassedTargetDates(ctx, coll))
+
+	// One removal notice per deleted subscription, no warning ahead of it
+	assert.Equal(t, []Notification{
+		{Topic: "expired", Title: "Global Entry Subscription Removed", Message: "Your expired Global Entry appointment subscription for JFK has been removed. Subscribe again to keep getting alerts."},
+		{Topic: "past", Title: "Global Entry Subscription Removed", Message: "Your Global Entry appointment subscription for JFK has been removed because its target date has passed."},
+	}, notifier.sent)
+
+	count, err := coll.CountDocuments(ctx, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestPersonalMode_NotifyOnTransition(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Mock HTTP server whose availability can be toggled
+	available := true
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			json.NewEncoder(w).Encode([]Appointment{})
+			return
+		}
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	// Mock ntfy server
+	ntfyCalls := 0
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ntfyCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.Mode.PersonalConfig.NotifyOnTransition = true
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	event := events.CloudWatchEvent{Source: "aws.events"}
+	eventJSON, _ := json.Marshal(event)
+	run := func() {
+		resp, err := handler.HandleRequest(ctx, eventJSON)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+
+	// First sighting notifies, persisting availability stays quiet
+	run()
+	run()
+	assert.Equal(t, 1, ntfyCalls)
+
+	// Dry spell re-arms, next sighting notifies again
+	available = false
+	run()
+	available = true
+	run()
+	assert.Equal(t, 2, ntfyCalls)
+}
+
+func TestMemoryStateStore(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStateStore()
+
+	state, err := store.Get(ctx, stateKey("Global Entry", "5300"))
+	assert.NoError(t, err)
+	assert.False(t, state.Available)
+
+	assert.NoError(t, store.Put(ctx, stateKey("Global Entry", "5300"), LocationState{Available: true}))
+	state, _ = store.Get(ctx, stateKey("Global Entry", "5300"))
+	assert.True(t, state.Available)
+	state, _ = store.Get(ctx, stateKey("NEXUS", "5300"))
+	assert.False(t, state.Available)
+}
+
+func TestDetectAppMode_InvalidOrderBy(t *testing.T) {
+	os.Setenv("MONGODB_PASSWORD", "test123")
+	os.Setenv("ORDER_BY", "random")
+	defer func() {
+		os.Unsetenv("MONGODB_PASSWORD")
+		os.Unsetenv("ORDER_BY")
+	}()
+
+	_, err := detectAppMode()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ORDER_BY must be")
+}
+
+func TestNotifyTopics_OneShotRemovedAfterDelivery(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "JFK", "ntfyTopic": "once-ok", "createdAt": time.Now().UTC(), "oneShot": true},
+		bson.M{"location": "JFK", "ntfyTopic": "once-fail", "createdAt": time.Now().UTC(), "oneShot": true},
+		bson.M{"location": "JFK", "ntfyTopic": "always", "createdAt": time.Now().UTC()},
+	})
+	assert.NoError(t, err)
+
+	// Mock ntfy server rejecting one topic
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["topic"] == "once-fail" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.MultiUserConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	subscribers := []Subscriber{{Topic: "once-ok", OneShot: true}, {Topic: "once-fail", OneShot: true}, {Topic: "always"}}
+	notified, err := handler.notifyTopics(ctx, "JFK", subscribers, Notification{Title: "title", Message: "message"})
+	assert.Error(t, err)
+	assert.Equal(t, 2, notified)
+
+	// Only the delivered one-shot subscription is removed
+	for topic, want := range map[string]int64{"once-ok": 0, "once-fail": 1, "always": 1} {
+		count, err := coll.CountDocuments(ctx, bson.M{"ntfyTopic": topic})
+		assert.NoError(t, err)
+		assert.Equal(t, want, count, topic)
+	}
+}
+
+func TestHandleSubscription_ConflictingService(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	req := SubscriptionRequest{Action: "subscribe", Location: "5300", NtfyTopic: "user1-5300"}
+	resp, err := handler.handleSubscription(ctx, coll, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// Same topic and location for the other service is rejected
+	req.ServiceType = "nexus"
+	resp, err = handler.handleSubscription(ctx, coll, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+	assert.JSONEq(t, `{"error": "ntfyTopic is already subscribed to Global Entry at this location; use a separate topic for NEXUS"}`, resp.Body)
+
+	// A separate topic for NEXUS is stored with its service type
+	req.NtfyTopic = "user1-5300-nexus"
+	resp, err = handler.handleSubscription(ctx, coll, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	count, err := coll.CountDocuments(ctx, bson.M{"ntfyTopic": "user1-5300-nexus", "serviceType": "NEXUS"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	// Unknown service types are rejected
+	req.ServiceType = "SENTRI"
+	resp, err = handler.handleSubscription(ctx, coll, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestGroupSubscribersByService(t *testing.T) {
+	groups := groupSubscribersByService([]Subscriber{
+		{Topic: "a"},
+		{Topic: "b", ServiceType: "NEXUS"},
+		{Topic: "c", ServiceType: "Global Entry"},
+	})
+	assert.Equal(t, []serviceSubscribers{
+		{ServiceType: "Global Entry", Subscribers: []Subscriber{{Topic: "a"}, {Topic: "c", ServiceType: "Global Entry"}}},
+		{ServiceType: "NEXUS", Subscribers: []Subscriber{{Topic: "b", ServiceType: "NEXUS"}}},
+	}, groups)
+}
+
+func TestExpiryWindow_ToleratesClockSkew(t *testing.T) {
+	// Subscription created exactly at a 5-minute block boundary
+	createdAt := time.Date(2025, 4, 4, 10, 5, 0, 0, time.UTC)
+	inWindow := func(now time.Time) bool {
+		start, end := expiryWindow(now)
+		return !createdAt.Before(start) && createdAt.Before(end)
+	}
+
+	// Accurate clock inside the block
+	assert.True(t, inWindow(createdAt.Add(30*24*time.Hour+2*time.Minute)))
+	// Clock 30s behind still sees it from the previous block
+	assert.True(t, inWindow(createdAt.Add(30*24*time.Hour-30*time.Second)))
+	// Well outside the block and tolerance
+	assert.False(t, inWindow(createdAt.Add(30*24*time.Hour+10*time.Minute)))
+}
+
+func TestHandleExpiringSubscriptions_NotifiesOnce(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// One subscription already notified by an earlier, skewed invocation whose delete failed
+	expireTime := time.Now().UTC().Add(-30 * 24 * time.Hour)
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "JFK", "ntfyTopic": "fresh", "createdAt": expireTime},
+		bson.M{"location": "JFK", "ntfyTopic": "notified", "createdAt": expireTime, "notifiedExpiry": true},
+	})
+	assert.NoError(t, err)
+
+	// Mock ntfy server
+	var topics []string
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		topics = append(topics, payload["topic"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.MultiUserConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	assert.NoError(t, handler.handleExpiringSubscriptions(ctx, coll))
+	assert.NoError(t, handler.handleExpiringSubscriptions(ctx, coll))
+	assert.Equal(t, []string{"fresh"}, topics)
+
+	// Both subscriptions removed
+	count, err := coll.CountDocuments(ctx, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestSendRemovalNotice(t *testing.T) {
+	notifier := &recordingNotifier{}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+	handler.Notifier = notifier
+	ctx := context.Background()
+	sub := Subscription{Location: "5300", NtfyTopic: "gone", ServiceType: "NEXUS", Locale: "es"}
+
+	// Disabled by default
+	handler.sendRemovalNotice(ctx, sub, removedForExpiry)
+	assert.Empty(t, notifier.sent)
+
+	handler.Mode.MultiUserConfig.NotifyOnRemoval = true
+	handler.sendRemovalNotice(ctx, sub, removedForExpiry)
+	handler.sendRemovalNotice(ctx, Subscription{Location: "5300", NtfyTopic: "failing"}, removedForFailures)
+	handler.sendRemovalNotice(ctx, Subscription{Location: "5300", NtfyTopic: "past"}, removedForTargetDate)
+	assert.Equal(t, []Notification{
+		{Topic: "gone", Title: "Suscripción de NEXUS eliminada", Message: "Tu suscripción vencida a citas de NEXUS en 5300 fue eliminada. Suscríbete de nuevo para seguir recibiendo alertas."},
+		{Topic: "failing", Title: "Global Entry Subscription Removed", Message: "Your Global Entry appointment subscription for 5300 has been removed after repeated delivery failures. Subscribe again to keep getting alerts."},
+		{Topic: "past", Title: "Global Entry Subscription Removed", Message: "Your Global Entry appointment subscription for 5300 has been removed because its target date has passed."},
+	}, notifier.sent)
+}
+
+func TestNotifyTopics_BatchedTopicSend(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	subscribers := []Subscriber{{Topic: "a"}, {Topic: "b"}}
+
+	for _, tc := range []struct {
+		name         string
+		acceptBatch  bool
+		wantRequests []string
+	}{
+		{name: "batched", acceptBatch: true, wantRequests: []string{"a,b"}},
+		{name: "fallback", acceptBatch: false, wantRequests: []string{"a,b", "a", "b"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []string
+			ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload map[string]string
+				json.NewDecoder(r.Body).Decode(&payload)
+				requests = append(requests, payload["topic"])
+				if strings.Contains(payload["topic"], ",") && !tc.acceptBatch {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ntfyServer.Close()
+
+			handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", NtfyServer: ntfyServer.URL, NtfyBatchTopics: true}}, "", nil)
+			handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+			notified, err := handler.notifyTopics(context.Background(), "", subscribers, Notification{Title: "title", Message: "message"})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, notified)
+			assert.Equal(t, tc.wantRequests, requests)
+		})
+	}
+}
+
+func TestFetchSlots_StatusClassification(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var statuses []int
+	apiCalls := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[apiCalls]
+		apiCalls++
+		w.WriteHeader(status)
+		w.Write([]byte("[]"))
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	// Transient statuses are retried until one succeeds
+	statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	body, err := handler.ttp().FetchSlots(ctx, "Global Entry", "5300", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", string(body))
+	assert.Equal(t, 3, apiCalls)
+
+	// Other 4xx statuses fail fast
+	apiCalls = 0
+	statuses = []int{http.StatusNotFound, http.StatusOK}
+	_, err = handler.ttp().FetchSlots(ctx, "Global Entry", "5300", 1)
+	assert.EqualError(t, err, "API returned status 404")
+	assert.Equal(t, 1, apiCalls)
+}
+
+func TestHandleRequest_SoonestValidationAndRateLimit(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", SoonestIntervalSeconds: 60}}, "", nil)
+
+	sourceIP := ""
+	request := func(query map[string]string) events.APIGatewayV2HTTPResponse {
+		apiReq := events.APIGatewayV2HTTPRequest{
+			RawPath:               "/soonest",
+			QueryStringParameters: query,
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "GET", Path: "/soonest", SourceIP: sourceIP},
+			},
+		}
+		eventJSON, _ := json.Marshal(apiReq)
+		resp, err := handler.HandleRequest(ctx, eventJSON)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// Missing or invalid topics are rejected
+	assert.Equal(t, 400, request(nil).StatusCode)
+	assert.Equal(t, 400, request(map[string]string{"ntfyTopic": "bad topic"}).StatusCode)
+
+	// A topic queried again within the interval is throttled before reaching the database
+	handler.soonestLimit.allow("user1-jfk")
+	resp := request(map[string]string{"ntfyTopic": "user1-jfk"})
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "60", resp.Headers["Retry-After"])
+
+	// A client that already queried is throttled even for another topic
+	sourceIP = "203.0.113.7"
+	handler.soonestLimit.allow("ip|203.0.113.7")
+	assert.Equal(t, 429, request(map[string]string{"ntfyTopic": "user2-sfo"}).StatusCode)
+}
+
+func TestHandleSoonest(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "5300", "ntfyTopic": "user1", "createdAt": time.Now().UTC()},
+		bson.M{"location": "5140", "ntfyTopic": "user1", "createdAt": time.Now().UTC()},
+		bson.M{"location": "5020", "ntfyTopic": "other", "createdAt": time.Now().UTC()},
+	})
+	assert.NoError(t, err)
+
+	// Mock Global Entry API with different slots per location; 5140's soonest already started
+	slots := map[string][]string{"5300": {"2099-06-01T10:00"}, "5140": {"2020-05-01T09:00", "2099-05-20T09:00"}, "5020": {"2099-05-01T08:00"}}
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		location := strings.TrimPrefix(r.URL.Path, "/")
+		var appointments []Appointment
+		for _, slot := range slots[location] {
+			appointments = append(appointments, Appointment{StartTimestamp: slot, Active: true})
+		}
+		json.NewEncoder(w).Encode(appointments)
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	resp, err := handler.handleSoonest(ctx, coll, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"location": "5140", "serviceType": "Global Entry", "startTimestamp": "2099-05-20T09:00"}`, resp.Body)
+
+	resp, err = handler.handleSoonest(ctx, coll, "nobody")
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestPersonalMode_DuplicateSlotsListedOnce(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Mock HTTP server repeating the same slot
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true},
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true},
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:15", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	var message string
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		message = payload["message"]
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	_, err := handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, "Global Entry appointment available at 5300 on 2099-05-04T10:00, 2099-05-04T10:15 (minimum 1 slots)", message)
+}
+
+func TestCheckSingleMinimum_Result(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true},
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:15", Active: false},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	result, err := handler.checkSingleMinimum(ctx, "Global Entry", "5300", subscribersForTopics([]string{"a", "b"}), 1)
+	assert.NoError(t, err)
+	assert.True(t, result.Found)
+	assert.Equal(t, []Appointment{{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true}}, result.Appointments)
+	assert.Equal(t, 2, result.Notified)
+}
+
+func TestPersonalMode_InactiveFirstSlot(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// First entry inactive, second active
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: false},
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:15", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	var messages []string
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["message"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	_, err := handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Global Entry appointment available at 5300 on 2099-05-04T10:15 (minimum 1 slots)"}, messages)
+}
+
+func TestLocationsForRun_RotatesThroughLocations(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test", MaxLocationsPerRun: 2}}, "", nil)
+
+	all := func() []LocationTopics {
+		return []LocationTopics{{Location: "5300"}, {Location: "5020"}, {Location: "5140"}}
+	}
+	names := func(lts []LocationTopics) []string {
+		var out []string
+		for _, lt := range lts {
+			out = append(out, lt.Location)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"5020", "5140"}, names(handler.locationsForRun(ctx, all())))
+	assert.Equal(t, []string{"5300", "5020"}, names(handler.locationsForRun(ctx, all())))
+	assert.Equal(t, []string{"5140", "5300"}, names(handler.locationsForRun(ctx, all())))
+
+	// No cap processes everything
+	handler.Mode.MultiUserConfig.MaxLocationsPerRun = 0
+	assert.Len(t, handler.locationsForRun(ctx, all()), 3)
+}
+
+func TestCheckSingleMinimum_AttachesICS(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{
+			{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", EndTimestamp: "2099-05-04T10:15", Active: true},
+		})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+
+	_, err := handler.checkSingleMinimum(ctx, "Global Entry", "5300", subscribersForTopics([]string{"a"}), 1)
+	assert.NoError(t, err)
+	assert.Len(t, notifier.sent, 1)
+	assert.Nil(t, notifier.sent[0].Attachment, "attachments are off by default")
+
+	handler.Mode.PersonalConfig.NtfyAttachICS = true
+	notifier.sent = nil
+	_, err = handler.checkSingleMinimum(ctx, "Global Entry", "5300", subscribersForTopics([]string{"a"}), 1)
+	assert.NoError(t, err)
+	assert.Len(t, notifier.sent, 1)
+	attachment := notifier.sent[0].Attachment
+	if assert.NotNil(t, attachment) {
+		assert.Equal(t, "appointment-5300.ics", attachment.Filename)
+		assert.Contains(t, string(attachment.Content), "DTSTART:20990504T100000\r\n")
+	}
+}
+
+func TestValidateNotificationPreferences(t *testing.T) {
+	assert.NoError(t, validateNotificationPreferences(0, nil))
+	assert.NoError(t, validateNotificationPreferences(5, []string{"rotating_light", "star"}))
+	assert.EqualError(t, validateNotificationPreferences(6, nil), "priority must be between 1 and 5")
+	assert.EqualError(t, validateNotificationPreferences(-1, nil), "priority must be between 1 and 5")
+	assert.EqualError(t, validateNotificationPreferences(3, []string{"a", "b", "c", "d", "e", "f"}), "at most 5 tags are allowed")
+	assert.EqualError(t, validateNotificationPreferences(3, []string{"has space"}), "tags must not contain spaces or special characters")
+}
+
+func TestHandleSubscription_InvalidPriority(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, "", nil)
+
+	// Validation runs before any database access
+	resp, err := handler.handleSubscription(context.Background(), nil, SubscriptionRequest{Action: "subscribe", Location: "5300", NtfyTopic: "user1-jfk", Priority: 9})
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, resp.Body, "priority must be between 1 and 5")
+}
+
+func TestNotifyTopics_PerSubscriptionPreferences(t *testing.T) {
+	notifier := &recordingNotifier{}
+	handler := NewLambdaHandler(&AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{}}, "", nil)
+	handler.Notifier = notifier
+
+	subscribers := []Subscriber{
+		{Topic: "dream", Priority: 5, Tags: []string{"rotating_light"}},
+		{Topic: "plain"},
+	}
+	notified, err := handler.notifyTopics(context.Background(), "", subscribers, Notification{Title: "T", Message: "M"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, notified)
+	assert.Equal(t, []Notification{
+		{Topic: "dream", Title: "T", Message: "M", Priority: 5, Tags: []string{"rotating_light"}},
+		{Topic: "plain", Title: "T", Message: "M"},
+	}, notifier.sent)
+}
+
+func TestDetectAppMode_InvalidAggregationReadPreference(t *testing.T) {
+	os.Setenv("MONGODB_PASSWORD", "test123")
+	os.Setenv("AGGREGATION_READ_PREFERENCE", "replica")
+	defer func() {
+		os.Unsetenv("MONGODB_PASSWORD")
+		os.Unsetenv("AGGREGATION_READ_PREFERENCE")
+	}()
+
+	_, err := detectAppMode()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "AGGREGATION_READ_PREFERENCE must be")
+
+	os.Setenv("AGGREGATION_READ_PREFERENCE", "secondaryPreferred")
+	mode, err := detectAppMode()
+	assert.NoError(t, err)
+	rp, err := mode.MultiUserConfig.aggregationReadPref()
+	assert.NoError(t, err)
+	assert.Equal(t, readpref.SecondaryPreferredMode, rp.Mode())
+}
+
+func TestConfig_MongoDBConcerns(t *testing.T) {
+	config := &Config{}
+	wc, err := config.writeConcern()
+	assert.NoError(t, err)
+	assert.Nil(t, wc, "unset keeps the client default")
+	rc, err := config.readConcern()
+	assert.NoError(t, err)
+	assert.Nil(t, rc, "unset keeps the client default")
+
+	config = &Config{MongoDBWriteConcern: "majority", MongoDBReadConcern: "majority"}
+	wc, err = config.writeConcern()
+	assert.NoError(t, err)
+	assert.Equal(t, "majority", wc.W)
+	rc, err = config.readConcern()
+	assert.NoError(t, err)
+	assert.Equal(t, "majority", rc.Level)
+
+	wc, err = (&Config{MongoDBWriteConcern: "2"}).writeConcern()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, wc.W)
+
+	for _, value := range []string{"0", "-1", "all"} {
+		_, err := (&Config{MongoDBWriteConcern: value}).writeConcern()
+		assert.ErrorContains(t, err, "MONGODB_WRITE_CONCERN must be", value)
+	}
+	_, err = (&Config{MongoDBReadConcern: "snapshot"}).readConcern()
+	assert.ErrorContains(t, err, "MONGODB_READ_CONCERN must be")
+
+	problems := (&Config{MongoDBWriteConcern: "0", MongoDBReadConcern: "strong"}).validate()
+	assert.Len(t, problems, 2)
+}
+
+func TestHandleSubscription_AuditLog(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := withClientIP(context.Background(), "203.0.113.7")
+	auditColl := coll.Database().Collection("audit_log")
+	handler.Audit = newMongoAuditLogger(auditColl, 24*time.Hour)
+
+	_, err := handler.handleSubscription(ctx, coll, SubscriptionRequest{Action: "subscribe", Location: "5300", NtfyTopic: "user1-jfk"})
+	assert.NoError(t, err)
+	_, err = handler.handleSubscription(ctx, coll, SubscriptionRequest{Action: "unsubscribe", Location: "5300", NtfyTopic: "user1-jfk"})
+	assert.NoError(t, err)
+
+	cursor, err := auditColl.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"timestamp": 1}))
+	assert.NoError(t, err)
+	var entries []AuditEntry
+	assert.NoError(t, cursor.All(ctx, &entries))
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, auditActionSubscribe, entries[0].Action)
+		assert.Equal(t, auditActionUnsubscribe, entries[1].Action)
+		assert.Equal(t, hashTopic("user1-jfk"), entries[0].TopicHash)
+		assert.Equal(t, "203.0.113.7", entries[0].ClientIP)
+		assert.WithinDuration(t, entries[0].Timestamp.Add(24*time.Hour), entries[0].ExpiresAt, time.Second)
+	}
+}
+
+func TestDetectAppMode_PersonalMisconfigurations(t *testing.T) {
+	base := map[string]string{"PERSONAL_MODE": "true", "NTFY_TOPIC": "my-topic", "LOCATION_ID": "5300"}
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{name: "missing topic", env: map[string]string{"NTFY_TOPIC": ""}, want: []string{"NTFY_TOPIC is required but not set"}},
+		{name: "non-numeric int", env: map[string]string{"REQUEST_TIMEOUT_SECONDS": "5s"}, want: []string{`REQUEST_TIMEOUT_SECONDS must be a whole number such as 5, got "5s"`}},
+		{name: "unitless duration", env: map[string]string{"MIN_LEAD_TIME": "24"}, want: []string{`MIN_LEAD_TIME must be a duration such as 24h, got "24"`}},
+		{name: "surge rearm above threshold", env: map[string]string{"SLOT_SURGE_THRESHOLD": "5", "SLOT_SURGE_REARM_BELOW": "8"}, want: []string{"SLOT_SURGE_REARM_BELOW must be between 0 and SLOT_SURGE_THRESHOLD, got 8"}},
+		{name: "bad rate limit", env: map[string]string{"NTFY_RATE_LIMIT": "60 per minute"}, want: []string{`NTFY_RATE_LIMIT is invalid: must look like 60/1m`}},
+		{name: "bad bool", env: map[string]string{"NOTIFY_ON_TRANSITION": "yes please"}, want: []string{`NOTIFY_ON_TRANSITION must be true or false, got "yes please"`}},
+		{name: "bad minimum slots", env: map[string]string{"MINIMUM_SLOTS": "1,two"}, want: []string{`MINIMUM_SLOTS must be positive whole numbers separated by commas`, `got "1,two"`}},
+		{name: "unknown service minimum", env: map[string]string{"MINIMUM_SLOTS": "SENTRI=2"}, want: []string{`MINIMUM_SLOTS names unknown service "SENTRI"; use "Global Entry" or "NEXUS", got "SENTRI=2"`}},
+		{name: "bad target date", env: map[string]string{"TARGET_DATE": "08/01/2025"}, want: []string{`TARGET_DATE must be a date in YYYY-MM-DD format, got "08/01/2025"`}},
+		{
+			name: "several problems reported together",
+			env:  map[string]string{"MINIMUM_SLOTS": "0", "ORDER_BY": "random", "LOCATION_ID": ""},
+			want: []string{"MINIMUM_SLOTS must be", "ORDER_BY must be", "LOCATION_ID is required for Global Entry"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for key, value := range base {
+				t.Setenv(key, value)
+			}
+			for key, value := range tc.env {
+				t.Setenv(key, value) // Restores the variable after the test
+				if value == "" {
+					os.Unsetenv(key)
+				}
+			}
+			_, err := detectAppMode()
+			if assert.Error(t, err) {
+				assert.True(t, strings.HasPrefix(err.Error(), "failed to load personal config: "))
+				for _, want := range tc.want {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
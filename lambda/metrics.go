@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultPushgatewayJob is the job label used when PUSHGATEWAY_JOB is unset
+const defaultPushgatewayJob = "global_entry_appointment"
+
+// invocationMetrics counts what happened during one invocation for the Prometheus pushgateway
+type invocationMetrics struct {
+	checks atomic.Int64 // TTP availability checks
+	found  atomic.Int64 // Checks that found availability
+	sent   atomic.Int64 // Notifications delivered to a topic
+	errors atomic.Int64 // Failed checks and deliveries
+}
+
+// reset zeroes the counters at the start of an invocation
+func (m *invocationMetrics) reset() {
+	m.checks.Store(0)
+	m.found.Store(0)
+	m.sent.Store(0)
+	m.errors.Store(0)
+}
+
+// exposition renders the counters in the Prometheus text format
+func (m *invocationMetrics) exposition() string {
+	var b strings.Builder
+	for _, metric := range []struct {
+		name, help string
+		value      int64
+	}{
+		{"appointment_checks_total", "TTP availability checks in the last invocation.", m.checks.Load()},
+		{"appointment_found_total", "Checks that found availability in the last invocation.", m.found.Load()},
+		{"appointment_notifications_sent_total", "Notifications delivered in the last invocation.", m.sent.Load()},
+		{"appointment_errors_total", "Failed checks and deliveries in the last invocation.", m.errors.Load()},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", metric.name, metric.help, metric.name, metric.name, metric.value)
+	}
+	return b.String()
+}
+
+// pushgatewayJob returns the configured job label
+func (c *SharedConfig) pushgatewayJob() string {
+	if c.PushgatewayJob == "" {
+		return defaultPushgatewayJob
+	}
+	return c.PushgatewayJob
+}
+
+// pushMetrics replaces the job's metrics on the pushgateway. Failures are only logged.
+func (h *LambdaHandler) pushMetrics(ctx context.Context) {
+	cfg := h.Mode.shared()
+	pushURL := strings.TrimSuffix(cfg.PushgatewayURL, "/") + "/metrics/job/" + url.PathEscape(cfg.pushgatewayJob())
+
+	reqCtx, cancel := withRequestTimeout(ctx, cfg.requestTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPut, pushURL, strings.NewReader(h.metrics.exposition()))
+	if err != nil {
+		slog.Warn("Failed to create pushgateway request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		slog.Warn("Failed to push metrics", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		slog.Warn("Non-2xx status from pushgateway", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalMode_PushesMetrics(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true}})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+
+	ntfyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ntfyServer.Close()
+
+	var method, path, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	handler.Mode.PersonalConfig.NtfyServer = ntfyServer.URL
+	handler.Mode.PersonalConfig.PushgatewayURL = gateway.URL
+	handler.Mode.PersonalConfig.PushgatewayJob = "scanner"
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	_, err := handler.HandleRequest(context.Background(), eventJSON)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/scanner", path)
+	assert.Contains(t, body, "appointment_checks_total 1\n")
+	assert.Contains(t, body, "appointment_found_total 1\n")
+	assert.Contains(t, body, "appointment_notifications_sent_total 1\n")
+	assert.Contains(t, body, "appointment_errors_total 0\n")
+}
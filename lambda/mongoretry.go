@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// defaultMongoMaxAttempts is used when MONGODB_MAX_ATTEMPTS is unset or zero
+const defaultMongoMaxAttempts = 3
+
+// mongoMaxAttempts returns how many times a transient MongoDB failure is attempted in total
+func (c *Config) mongoMaxAttempts() int {
+	if c.MongoDBMaxAttempts <= 0 {
+		return defaultMongoMaxAttempts
+	}
+	return c.MongoDBMaxAttempts
+}
+
+// transientMongoError reports whether err is worth retrying: network errors, server timeouts
+// and errors the server labels retryable, as during an Atlas primary election
+func transientMongoError(err error) bool {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	var labeled mongo.LabeledError
+	if !errors.As(err, &labeled) {
+		return false
+	}
+	return labeled.HasErrorLabel("RetryableWriteError") || labeled.HasErrorLabel("TransientTransactionError")
+}
+
+// withMongoRetry runs op up to maxAttempts times with the same linear backoff as TTP requests,
+// retrying only transient errors. Callers must tolerate an op that succeeded on the server but
+// reported a network error being run again: inserts then hit the unique subscription index.
+func withMongoRetry[T any](ctx context.Context, maxAttempts int, name string, op func() (T, error)) (T, error) {
+	maxAttempts = max(maxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		result, err := op()
+		if err == nil || attempt == maxAttempts || ctx.Err() != nil || !transientMongoError(err) {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return result, err
+		}
+		slog.Warn("Transient MongoDB error, retrying", "operation", name, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// flakyMongoOp fails with each error in failures, one per call, then succeeds
+type flakyMongoOp struct {
+	failures []error
+	calls    int
+}
+
+func (op *flakyMongoOp) run() (int64, error) {
+	op.calls++
+	if op.calls <= len(op.failures) {
+		return 0, op.failures[op.calls-1]
+	}
+	return 42, nil
+}
+
+func TestWithMongoRetry(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	election := mongo.CommandError{Code: 10107, Name: "NotWritablePrimary", Labels: []string{"RetryableWriteError"}}
+	invalid := mongo.CommandError{Code: 2, Name: "BadValue"}
+
+	tests := []struct {
+		name      string
+		attempts  int
+		failures  []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "success needs one call", attempts: 3, wantCalls: 1},
+		{name: "transient error then success", attempts: 3, failures: []error{election, election}, wantCalls: 3},
+		{name: "gives up after max attempts", attempts: 2, failures: []error{election, election}, wantCalls: 2, wantErr: true},
+		{name: "permanent error is not retried", attempts: 3, failures: []error{invalid}, wantCalls: 1, wantErr: true},
+		{name: "zero attempts still runs once", attempts: 0, failures: []error{election}, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &flakyMongoOp{failures: tt.failures}
+			got, err := withMongoRetry(context.Background(), tt.attempts, "countDocuments", op.run)
+			assert.Equal(t, tt.wantCalls, op.calls)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(42), got)
+		})
+	}
+}
+
+func TestWithMongoRetry_StopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	op := &flakyMongoOp{failures: []error{mongo.CommandError{Labels: []string{"RetryableWriteError"}}}}
+	_, err := withMongoRetry(ctx, 3, "insertOne", op.run)
+	assert.Error(t, err)
+	assert.Equal(t, 1, op.calls)
+}
+
+func TestTransientMongoError(t *testing.T) {
+	assert.True(t, transientMongoError(mongo.CommandError{Labels: []string{"TransientTransactionError"}}))
+	assert.True(t, transientMongoError(context.DeadlineExceeded))
+	assert.False(t, transientMongoError(errors.New("boom")))
+	assert.False(t, transientMongoError(mongo.ErrNoDocuments))
+}
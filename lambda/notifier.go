@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// NtfyFormatJSON posts a JSON payload to the ntfy server root
+	NtfyFormatJSON = "json"
+	// NtfyFormatHeaders posts a plain-text body to the topic URL with X-* headers
+	NtfyFormatHeaders = "headers"
+)
+
+type (
+	// Notification is a message delivered to a single topic
+	Notification struct {
+		Topic      string
+		Title      string
+		Message    string
+		Attachment *Attachment // Optional file delivered with the notification
+		Priority   int         // ntfy priority 1-5; zero uses the server default
+		Tags       []string    // ntfy tags, e.g. emoji shortcodes
+		Click      string      // URL opened when the notification is tapped
+	}
+
+	// Attachment is a file sent alongside a notification
+	Attachment struct {
+		Filename string
+		Content  []byte
+	}
+
+	// Notifier delivers notifications to subscribers
+	Notifier interface {
+		Send(ctx context.Context, n Notification) error
+	}
+
+	// ConnectivityChecker is implemented by notifiers that can verify their server is reachable
+	ConnectivityChecker interface {
+		CheckConnectivity(ctx context.Context) error
+	}
+
+	// BatchSender is implemented by notifiers that can deliver one notification to several topics in one request
+	BatchSender interface {
+		SendBatch(ctx context.Context, topics []string, n Notification) error
+	}
+
+	// NtfyNotifier sends notifications to an ntfy server
+	NtfyNotifier struct {
+		Server           string
+		Format           string
+		HTTPClient       *http.Client
+		RequestTimeout   time.Duration // Per-attempt deadline; zero relies on the client timeout
+		MaxRetryDuration time.Duration // Total time allowed per send including retries; zero only limits attempts
+		Limiter          *tokenBucket  // Caps the send rate (NTFY_RATE_LIMIT); nil is unlimited
+	}
+)
+
+// Send posts the notification to ntfy with retries
+func (n *NtfyNotifier) Send(ctx context.Context, notification Notification) error {
+	if err := n.Limiter.wait(ctx, "ntfy"); err != nil {
+		return err
+	}
+	req, err := n.newRequest(ctx, notification)
+	if err != nil {
+		return fmt.Errorf("failed to create ntfy request: %v", err)
+	}
+	client := retryClient{HTTPClient: n.HTTPClient, Timeout: n.RequestTimeout, MaxDuration: n.MaxRetryDuration}
+	if _, err := client.doWithRetry(ctx, req, 3); err != nil {
+		slog.Warn("Failed to send ntfy notification", "topic", notification.Topic, "error", err)
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			return fmt.Errorf("ntfy %v", err)
+		}
+		return fmt.Errorf("failed to send ntfy notification: %v", err)
+	}
+	slog.Info("Sent notification", "topic", notification.Topic, "title", notification.Title)
+	return nil
+}
+
+// SendBatch publishes the notification to comma-separated topics in a single request. Not every
+// ntfy setup accepts this, so callers should fall back to Send on error.
+func (n *NtfyNotifier) SendBatch(ctx context.Context, topics []string, notification Notification) error {
+	notification.Topic = strings.Join(topics, ",")
+	return n.Send(ctx, notification)
+}
+
+// CheckConnectivity sends a HEAD request to the ntfy server. Any non-5xx response counts as reachable.
+func (n *NtfyNotifier) CheckConnectivity(ctx context.Context) error {
+	reqCtx, cancel := withRequestTimeout(ctx, n.RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodHead, n.Server, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create ntfy request: %v", err)
+	}
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ntfy server unreachable: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("ntfy server returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newRequest builds the ntfy request in the configured format
+func (n *NtfyNotifier) newRequest(ctx context.Context, notification Notification) (*http.Request, error) {
+	if notification.Attachment != nil {
+		return n.newAttachmentRequest(ctx, notification)
+	}
+	if n.Format == NtfyFormatHeaders {
+		topicURL := strings.TrimSuffix(n.Server, "/") + "/" + notification.Topic
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, topicURL, strings.NewReader(notification.Message))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		req.Header.Set("X-Title", encodeHeader(notification.Title))
+		setPreferenceHeaders(req, notification)
+		return req, nil
+	}
+
+	payload := map[string]any{
+		"topic":   notification.Topic,
+		"message": notification.Message,
+		"title":   notification.Title,
+	}
+	if notification.Priority > 0 {
+		payload["priority"] = notification.Priority
+	}
+	if len(notification.Tags) > 0 {
+		payload["tags"] = notification.Tags
+	}
+	if notification.Click != "" {
+		payload["click"] = notification.Click
+	}
+	payloadBytes, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Server, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// newAttachmentRequest uploads the attachment as the body of a PUT to the topic URL, which ntfy
+// accepts in either format. The message moves to X-Message, where ntfy expands literal \n.
+func (n *NtfyNotifier) newAttachmentRequest(ctx context.Context, notification Notification) (*http.Request, error) {
+	topicURL := strings.TrimSuffix(n.Server, "/") + "/" + notification.Topic
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, topicURL, bytes.NewReader(notification.Attachment.Content))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Title", encodeHeader(notification.Title))
+	req.Header.Set("X-Message", encodeHeader(strings.ReplaceAll(notification.Message, "\n", `\n`)))
+	req.Header.Set("X-Filename", notification.Attachment.Filename)
+	setPreferenceHeaders(req, notification)
+	return req, nil
+}
+
+// encodeHeader RFC 2047-encodes non-ASCII text (such as localized titles) for ntfy headers.
+// ASCII text is returned unchanged.
+func encodeHeader(value string) string {
+	return mime.QEncoding.Encode("utf-8", value)
+}
+
+// setPreferenceHeaders sets the ntfy priority, tags and click headers when the notification has them
+func setPreferenceHeaders(req *http.Request, notification Notification) {
+	if notification.Priority > 0 {
+		req.Header.Set("X-Priority", strconv.Itoa(notification.Priority))
+	}
+	if len(notification.Tags) > 0 {
+		req.Header.Set("X-Tags", strings.Join(notification.Tags, ","))
+	}
+	if notification.Click != "" {
+		req.Header.Set("X-Click", notification.Click)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNtfyNotifier_JSONFormat(t *testing.T) {
+	var payload map[string]string
+	var contentType, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatJSON, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	err := notifier.Send(context.Background(), Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, "/", path)
+	assert.Equal(t, map[string]string{"topic": "user1-jfk", "title": "Test Title", "message": "Test message"}, payload)
+}
+
+func TestNtfyNotifier_HeadersFormat(t *testing.T) {
+	var body, title, contentType, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		title = r.Header.Get("X-Title")
+		path = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL + "/", Format: NtfyFormatHeaders, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	err := notifier.Send(context.Background(), Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "text/plain; charset=utf-8", contentType)
+	assert.Equal(t, "/user1-jfk", path)
+	assert.Equal(t, "Test Title", title)
+	assert.Equal(t, "Test message", body)
+}
+
+func TestNtfyNotifier_DefaultsToJSON(t *testing.T) {
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	err := notifier.Send(context.Background(), Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message"})
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+}
+
+func TestNtfyNotifier_NonOKStatus(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	err := notifier.Send(context.Background(), Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ntfy returned status 403")
+	assert.Equal(t, 1, calls, "client errors are not retried")
+}
+
+func TestNtfyNotifier_RetriesServerErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	err := notifier.Send(context.Background(), Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message"})
+	assert.EqualError(t, err, "ntfy returned status 503 after 3 attempts")
+	assert.Equal(t, 3, calls)
+}
+
+func TestNtfyNotifier_RequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Each attempt is cut off well before the shared client timeout
+	notifier := &NtfyNotifier{Server: server.URL, HTTPClient: &http.Client{Timeout: 10 * time.Second}, RequestTimeout: 20 * time.Millisecond}
+	err := notifier.Send(context.Background(), Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "context deadline exceeded")
+}
+
+func TestNtfyNotifier_CheckConnectivity(t *testing.T) {
+	status := http.StatusOK
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	assert.NoError(t, notifier.CheckConnectivity(context.Background()))
+	assert.Equal(t, http.MethodHead, method)
+
+	status = http.StatusBadGateway
+	assert.EqualError(t, notifier.CheckConnectivity(context.Background()), "ntfy server returned status 502")
+
+	server.Close()
+	assert.Error(t, notifier.CheckConnectivity(context.Background()))
+}
+
+func TestNtfyNotifier_Attachment(t *testing.T) {
+	var method, path, title, message, filename, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		title = r.Header.Get("X-Title")
+		message = r.Header.Get("X-Message")
+		filename = r.Header.Get("X-Filename")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatJSON, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	err := notifier.Send(context.Background(), Notification{
+		Topic:      "user1-jfk",
+		Title:      "Test Title",
+		Message:    "line one\nline two",
+		Attachment: &Attachment{Filename: "appointment-5140.ics", Content: []byte("BEGIN:VCALENDAR")},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/user1-jfk", path)
+	assert.Equal(t, "Test Title", title)
+	assert.Equal(t, `line one\nline two`, message)
+	assert.Equal(t, "appointment-5140.ics", filename)
+	assert.Equal(t, "BEGIN:VCALENDAR", body)
+}
+
+func TestNtfyNotifier_PriorityAndTags(t *testing.T) {
+	var payload map[string]any
+	var priority, tags string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			json.NewDecoder(r.Body).Decode(&payload)
+		} else {
+			priority = r.Header.Get("X-Priority")
+			tags = r.Header.Get("X-Tags")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notification := Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message", Priority: 5, Tags: []string{"rotating_light", "star"}}
+	jsonNotifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatJSON, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	assert.NoError(t, jsonNotifier.Send(context.Background(), notification))
+	assert.Equal(t, float64(5), payload["priority"])
+	assert.Equal(t, []any{"rotating_light", "star"}, payload["tags"])
+
+	headersNotifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatHeaders, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	assert.NoError(t, headersNotifier.Send(context.Background(), notification))
+	assert.Equal(t, "5", priority)
+	assert.Equal(t, "rotating_light,star", tags)
+}
+
+func TestNtfyNotifier_Click(t *testing.T) {
+	var payload map[string]any
+	var click string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			json.NewDecoder(r.Body).Decode(&payload)
+		} else {
+			click = r.Header.Get("X-Click")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notification := Notification{Topic: "user1-jfk", Title: "Test Title", Message: "Test message", Click: "https://example.com/book?locationId=5140"}
+	jsonNotifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatJSON, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	assert.NoError(t, jsonNotifier.Send(context.Background(), notification))
+	assert.Equal(t, "https://example.com/book?locationId=5140", payload["click"])
+
+	headersNotifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatHeaders, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	assert.NoError(t, headersNotifier.Send(context.Background(), notification))
+	assert.Equal(t, "https://example.com/book?locationId=5140", click)
+}
+
+func TestNtfyNotifier_EncodesNonASCIIHeaders(t *testing.T) {
+	var title string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title = r.Header.Get("X-Title")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatHeaders, HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	err := notifier.Send(context.Background(), Notification{Topic: "user1-jfk", Title: "Notificación de cita", Message: "m"})
+	assert.NoError(t, err)
+	decoded, err := new(mime.WordDecoder).DecodeHeader(title)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "Notificación de cita", title, "raw UTF-8 is not sent in headers")
+	assert.Equal(t, "Notificación de cita", decoded)
+}
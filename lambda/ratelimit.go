@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNotifierRateLimited is returned when a notification is skipped because its notifier's
+// rate limit would not free up before the invocation deadline
+var errNotifierRateLimited = errors.New("notifier rate limit reached")
+
+// keyRateLimiter allows one request per key per interval
+type keyRateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+	now      func() time.Time
+}
+
+// newKeyRateLimiter creates a keyRateLimiter; an interval of zero disables it
+func newKeyRateLimiter(interval time.Duration) *keyRateLimiter {
+	return &keyRateLimiter{
+		interval: interval,
+		last:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// allow records a request for key, returning how long to wait if it came too soon
+func (l *keyRateLimiter) allow(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.interval <= 0 {
+		return 0
+	}
+	now := l.now()
+	if wait := l.last[key].Add(l.interval).Sub(now); wait > 0 {
+		return wait
+	}
+	l.last[key] = now
+	return 0
+}
+
+// tokenBucket allows bursts of up to capacity sends, refilled evenly over each window. A nil
+// bucket allows every send.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	perToken time.Duration // Time to refill one token
+	last     time.Time
+	now      func() time.Time
+}
+
+// newTokenBucket creates a full bucket allowing requests sends per window
+func newTokenBucket(requests int, window time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(requests),
+		tokens:   float64(requests),
+		perToken: window / time.Duration(requests),
+		now:      time.Now,
+	}
+}
+
+// parseRateLimit parses a limit such as "60/1m" into a bucket; an empty spec means no limit
+func parseRateLimit(spec string) (*tokenBucket, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	count, per, ok := strings.Cut(spec, "/")
+	requests, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || requests <= 0 {
+		return nil, fmt.Errorf("must look like 60/1m with a positive request count, got %q", spec)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(per))
+	if err != nil || window < time.Second {
+		return nil, fmt.Errorf("window must be a duration of at least 1s, got %q", per)
+	}
+	return newTokenBucket(requests, window), nil
+}
+
+// reserve takes a token and returns how long to wait before using it. Tokens may go negative
+// so concurrent callers queue in order. When the wait would end after deadline, no token is
+// taken and ok is false; a zero deadline waits as long as needed.
+func (b *tokenBucket) reserve(deadline time.Time) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens = min(b.capacity, b.tokens+float64(now.Sub(b.last))/float64(b.perToken))
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait = time.Duration((1 - b.tokens) * float64(b.perToken))
+	if !deadline.IsZero() && now.Add(wait).After(deadline) {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// wait blocks until the bucket allows a send, returning errNotifierRateLimited instead when
+// that would outlast the context deadline
+func (b *tokenBucket) wait(ctx context.Context, notifier string) error {
+	if b == nil {
+		return nil
+	}
+	deadline, _ := ctx.Deadline()
+	delay, ok := b.reserve(deadline)
+	if !ok {
+		slog.Warn("Notifier rate limit reached, skipping notification", "notifier", notifier, "wait", delay)
+		return errNotifierRateLimited
+	}
+	if delay <= 0 {
+		return nil
+	}
+	slog.Info("Notifier rate limit reached, queueing notification", "notifier", notifier, "wait", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRateLimiter(t *testing.T) {
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	limiter := newKeyRateLimiter(time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Duration(0), limiter.allow("a"))
+	assert.Equal(t, time.Minute, limiter.allow("a"))
+	assert.Equal(t, time.Duration(0), limiter.allow("b"), "keys are limited independently")
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, time.Duration(0), limiter.allow("a"))
+}
+
+func TestKeyRateLimiter_Disabled(t *testing.T) {
+	limiter := newKeyRateLimiter(0)
+	assert.Equal(t, time.Duration(0), limiter.allow("a"))
+	assert.Equal(t, time.Duration(0), limiter.allow("a"))
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2025, 5, 4, 10, 0, 0, 0, time.UTC)
+	bucket := newTokenBucket(2, time.Minute)
+	bucket.now = func() time.Time { return now }
+
+	// A full bucket allows a burst of its capacity
+	for i := 0; i < 2; i++ {
+		wait, ok := bucket.reserve(time.Time{})
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(0), wait)
+	}
+
+	// Further sends queue behind each other
+	wait, ok := bucket.reserve(time.Time{})
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+	wait, ok = bucket.reserve(time.Time{})
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, wait)
+
+	// A send that would outlast the deadline is skipped without taking a token
+	wait, ok = bucket.reserve(now.Add(time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, 90*time.Second, wait)
+
+	// Tokens refill over the window
+	now = now.Add(2 * time.Minute)
+	wait, ok = bucket.reserve(now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	var unlimited *tokenBucket
+	assert.NoError(t, unlimited.wait(context.Background(), "ntfy"))
+
+	bucket := newTokenBucket(1, time.Hour)
+	assert.NoError(t, bucket.wait(context.Background(), "ntfy"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.ErrorIs(t, bucket.wait(ctx, "ntfy"), errNotifierRateLimited)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	bucket, err := parseRateLimit("")
+	assert.NoError(t, err)
+	assert.Nil(t, bucket)
+
+	bucket, err = parseRateLimit(" 60 / 1m ")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(60), bucket.capacity)
+	assert.Equal(t, time.Second, bucket.perToken)
+
+	for _, spec := range []string{"60", "0/1m", "x/1m", "60/", "60/500ms"} {
+		_, err := parseRateLimit(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNtfyNotifier_RateLimited(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	notifier := &NtfyNotifier{Server: server.URL, Format: NtfyFormatJSON, HTTPClient: server.Client(), Limiter: newTokenBucket(1, time.Hour)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, notifier.Send(ctx, Notification{Topic: "a", Message: "m"}))
+	assert.ErrorIs(t, notifier.Send(ctx, Notification{Topic: "a", Message: "m"}), errNotifierRateLimited)
+	assert.Equal(t, 1, requests)
+}
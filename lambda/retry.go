@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// retryBackoff is the base delay between attempts; attempt n is followed by an n times longer wait
+const retryBackoff = 100 * time.Millisecond
+
+type (
+	// retryClient sends requests with a per-attempt deadline and linear backoff
+	retryClient struct {
+		HTTPClient  *http.Client
+		Timeout     time.Duration               // Per-attempt deadline; zero relies on the client timeout
+		MaxDuration time.Duration               // Total time allowed across attempts and backoff; zero only limits attempts
+		Prepare     func(attempt *http.Request) // Called on each attempt's request just before it is sent
+	}
+
+	// statusError reports a non-2xx response that was not retried further
+	statusError struct {
+		StatusCode int
+		Attempts   int
+	}
+)
+
+func (e *statusError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("returned status %d after %d attempts", e.StatusCode, e.Attempts)
+	}
+	return fmt.Sprintf("returned status %d", e.StatusCode)
+}
+
+// doWithRetry sends req up to maxAttempts times. Transport errors and retryable statuses (5xx, 429)
+// are retried; other statuses fail immediately with a *statusError. A 2xx response is returned with
+// its body already read, so it stays readable after the attempt deadline. Retries stop as soon as
+// ctx is done, or when the next backoff would end past MaxDuration, and no attempt's deadline runs
+// past it either. The request body must be replayable (GetBody set), as it is for in-memory readers.
+func (c retryClient) doWithRetry(ctx context.Context, req *http.Request, maxAttempts int) (*http.Response, error) {
+	maxAttempts = max(maxAttempts, 1)
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err := c.do(ctx, req, c.attemptTimeout(time.Since(start)))
+		backoff := time.Duration(attempt) * retryBackoff
+		last := attempt == maxAttempts
+		if !last && c.MaxDuration > 0 && time.Since(start)+backoff >= c.MaxDuration {
+			if err != nil || retryableStatus(resp.StatusCode) {
+				slog.Warn("Retry deadline reached, not retrying", "host", req.URL.Host, "attempt", attempt, "maxRetryDuration", c.MaxDuration)
+			}
+			last = true
+		}
+		switch {
+		case err != nil:
+			if last || ctx.Err() != nil {
+				return gaveUp(attempt, nil, err)
+			}
+			slog.Warn("Request failed, retrying", "host", req.URL.Host, "attempt", attempt, "error", err)
+		case resp.StatusCode/100 == 2:
+			return resp, nil
+		case !retryableStatus(resp.StatusCode) || last:
+			return gaveUp(attempt, resp, nil)
+		default:
+			slog.Warn("Retryable status, retrying", "host", req.URL.Host, "attempt", attempt, "status", resp.StatusCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed after %d attempts: %v", attempt, ctx.Err())
+		case <-time.After(backoff):
+		}
+		if c.MaxDuration > 0 && time.Since(start) >= c.MaxDuration {
+			// The backoff overran MaxDuration, leaving no time for another attempt
+			slog.Warn("Retry deadline reached, not retrying", "host", req.URL.Host, "attempt", attempt, "maxRetryDuration", c.MaxDuration)
+			return gaveUp(attempt, resp, err)
+		}
+	}
+}
+
+// attemptTimeout returns the deadline for an attempt starting elapsed into the call: Timeout,
+// shortened to what is left of MaxDuration
+func (c retryClient) attemptTimeout(elapsed time.Duration) time.Duration {
+	if c.MaxDuration <= 0 {
+		return c.Timeout
+	}
+	remaining := c.MaxDuration - elapsed
+	if c.Timeout <= 0 || remaining < c.Timeout {
+		return remaining
+	}
+	return c.Timeout
+}
+
+// gaveUp reports the outcome of the final attempt: its transport error, or its unsuccessful status
+func gaveUp(attempts int, resp *http.Response, err error) (*http.Response, error) {
+	if err != nil {
+		return nil, fmt.Errorf("failed after %d attempts: %v", attempts, err)
+	}
+	return resp, &statusError{StatusCode: resp.StatusCode, Attempts: attempts}
+}
+
+// do sends a single attempt under its own deadline and buffers the response body
+func (c retryClient) do(ctx context.Context, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	attemptCtx, cancel := withRequestTimeout(ctx, timeout)
+	defer cancel()
+
+	attemptReq := req.Clone(attemptCtx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay request body: %v", err)
+		}
+		attemptReq.Body = body
+	}
+	if c.Prepare != nil {
+		c.Prepare(attemptReq)
+	}
+
+	resp, err := c.HTTPClient.Do(attemptReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// retryableStatus reports whether a status is transient: 5xx and 429 are retried, other 4xx fail fast
+func retryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoWithRetry_Success(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := retryClient{HTTPClient: &http.Client{Timeout: 2 * time.Second}, Timeout: time.Second}
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, strings.NewReader("payload"))
+	resp, err := client.doWithRetry(context.Background(), req, 3)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "ok", string(body), "body stays readable after the attempt deadline")
+	assert.Equal(t, []string{"payload", "payload"}, bodies, "the body is replayed on retry")
+}
+
+func TestDoWithRetry_RetryableFailure(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := retryClient{HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.doWithRetry(context.Background(), req, 2)
+	assert.EqualError(t, err, "returned status 429 after 2 attempts")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDoWithRetry_NonRetryableStatus(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := retryClient{HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := client.doWithRetry(context.Background(), req, 3)
+	assert.EqualError(t, err, "returned status 404")
+	assert.Equal(t, 1, calls)
+}
+
+func TestDoWithRetry_StopsWhenContextDone(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := retryClient{HTTPClient: &http.Client{Timeout: 2 * time.Second}}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := client.doWithRetry(ctx, req, 5)
+	assert.ErrorContains(t, err, "context deadline exceeded")
+	assert.Equal(t, 1, calls, "the 100ms backoff outlasts the context")
+}
+
+func TestDoWithRetry_StopsAtMaxDuration(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Backoffs of 100ms then 200ms: the second would end past the 250ms budget
+	client := retryClient{HTTPClient: &http.Client{Timeout: 2 * time.Second}, MaxDuration: 250 * time.Millisecond}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	start := time.Now()
+	resp, err := client.doWithRetry(context.Background(), req, 10)
+	assert.EqualError(t, err, "returned status 503 after 2 attempts")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 2, calls)
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestDoWithRetry_AttemptDeadlineClampedToMaxDuration(t *testing.T) {
+	var calls atomic.Int32 // The handler may outlive the aborted attempt
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	// A 5s per-attempt deadline would outlast the 200ms budget on its own
+	client := retryClient{HTTPClient: &http.Client{Timeout: 10 * time.Second}, Timeout: 5 * time.Second, MaxDuration: 200 * time.Millisecond}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	start := time.Now()
+	_, err := client.doWithRetry(context.Background(), req, 10)
+	assert.ErrorContains(t, err, "failed after 1 attempts")
+	assert.Equal(t, int32(1), calls.Load(), "no attempt starts once the budget is spent")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetryClient_AttemptTimeout(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryClient{Timeout: 5 * time.Second}.attemptTimeout(time.Minute), "no MAX_RETRY_DURATION")
+	assert.Equal(t, 2*time.Second, retryClient{Timeout: 5 * time.Second, MaxDuration: 3 * time.Second}.attemptTimeout(time.Second))
+	assert.Equal(t, time.Second, retryClient{Timeout: time.Second, MaxDuration: 3 * time.Second}.attemptTimeout(0))
+	assert.Equal(t, 3*time.Second, retryClient{MaxDuration: 3 * time.Second}.attemptTimeout(0), "no per-attempt deadline")
+}
+
+func TestLambdaHandler_MaxRetryDurationApplied(t *testing.T) {
+	config := &Config{MongoDBPassword: "test"}
+	config.MaxRetryDuration = 2 * time.Second
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: config}, "", nil)
+
+	assert.Equal(t, 2*time.Second, handler.retryClient().MaxDuration, "TTP and webhook retries")
+	if notifier, ok := handler.notifier().(*NtfyNotifier); assert.True(t, ok) {
+		assert.Equal(t, 2*time.Second, notifier.MaxRetryDuration, "notification retries")
+	}
+}
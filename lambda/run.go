@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// runSummary reports what one availability pass did
+type runSummary struct {
+	Locations         int   `json:"locations"`
+	Checks            int64 `json:"checks"`
+	Found             int64 `json:"found"`
+	NotificationsSent int64 `json:"notificationsSent"`
+	Errors            int64 `json:"errors"`
+}
+
+// runAvailabilityPass runs one full multi-user pass: expiring subscriptions and passed target
+// dates are cleaned up, then every location due this run is checked and alerts are batched per
+// topic. It returns early when there are no subscriptions. Returned errors carry a message safe
+// to show to API callers.
+func (h *LambdaHandler) runAvailabilityPass(ctx context.Context) (runSummary, error) {
+	checks, found, sent, failed := h.metrics.checks.Load(), h.metrics.found.Load(), h.metrics.sent.Load(), h.metrics.errors.Load()
+
+	coll := h.subscriptions()
+	attempts := h.Mode.MultiUserConfig.mongoMaxAttempts()
+	// Empty deployments have nothing to expire or check, so skip the scans entirely
+	n, err := withMongoRetry(ctx, attempts, "countDocuments", func() (int64, error) {
+		return coll.CountDocuments(ctx, bson.M{}, options.Count().SetLimit(1))
+	})
+	if err != nil {
+		slog.Warn("Failed to count subscriptions, running full pass", "error", err)
+	} else if n == 0 {
+		slog.Info("No subscriptions, no work to do")
+		return runSummary{}, nil
+	}
+	if err := h.cleanUpSubscriptions(ctx, coll); err != nil {
+		return runSummary{}, err
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{
+			"$group", bson.D{
+				{"_id", "$location"},
+				{"ntfyTopics", bson.D{{"$push", "$ntfyTopic"}}},
+				{"subscribers", bson.D{{"$push", bson.M{"ntfyTopic": "$ntfyTopic", "targetDate": "$targetDate", "oneShot": "$oneShot", "serviceType": "$serviceType", "priority": "$priority", "tags": "$tags", "locale": "$locale", "createdAt": "$createdAt"}}}},
+			},
+		}},
+	}
+	cursor, err := withMongoRetry(ctx, attempts, "aggregate", func() (*mongo.Cursor, error) {
+		return h.aggregationSubscriptions().Aggregate(ctx, pipeline)
+	})
+	if err != nil {
+		slog.Error("Failed to execute aggregation", "error", err)
+		return runSummary{}, errors.New("failed to execute aggregation")
+	}
+	defer cursor.Close(ctx)
+
+	var locationTopics []LocationTopics
+	if err := cursor.All(ctx, &locationTopics); err != nil {
+		slog.Error("Failed to decode aggregation results", "error", err)
+		return runSummary{}, errors.New("failed to decode aggregation results")
+	}
+
+	locationTopics = h.locationsForRun(ctx, h.locationsDue(ctx, locationTopics, time.Now()))
+	h.throttle.reset()
+	h.schema.reset()
+	defer h.updateRateLimitStreak(ctx)
+	defer h.updateSchemaDriftStreak(ctx)
+
+	// Queue alerts so topics watching several locations get one combined notification
+	batch := newNotificationBatch()
+	batchCtx := withNotificationBatch(ctx, batch)
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 10)
+	for _, lt := range locationTopics {
+		wg.Add(1)
+		go func(lt LocationTopics) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			checked := true
+			for _, group := range groupSubscribersByService(lt.Subscribers) {
+				if err := h.checkAvailabilityAndNotifyWithMinimums(batchCtx, group.ServiceType, lt.Location, group.Subscribers, []int{1}); err != nil {
+					slog.Error("Failed to check availability", "service", group.ServiceType, "location", lt.Location, "error", err)
+					checked = false
+				}
+			}
+			// Failed checks are retried on the next invocation rather than after the interval
+			if checked {
+				h.recordLocationChecked(ctx, lt.Location, time.Now())
+			}
+		}(lt)
+	}
+	wg.Wait()
+	if limit := h.Mode.MultiUserConfig.MaxNotificationsPerRun; limit > 0 {
+		batch.applyBudget(newNotificationBudget(limit))
+	}
+	h.flushNotificationBatch(ctx, batch)
+
+	return runSummary{
+		Locations:         len(locationTopics),
+		Checks:            h.metrics.checks.Load() - checks,
+		Found:             h.metrics.found.Load() - found,
+		NotificationsSent: h.metrics.sent.Load() - sent,
+		Errors:            h.metrics.errors.Load() - failed,
+	}, nil
+}
+
+// cleanUpSubscriptions expires subscriptions reaching 30 days and removes those past their
+// target date. It runs on every scheduled tick, including ticks CHECK_SCHEDULE skips, since
+// expiryWindow only covers the current 5-minute block. The returned error is safe to show to
+// API callers.
+func (h *LambdaHandler) cleanUpSubscriptions(ctx context.Context, coll *mongo.Collection) error {
+	if err := h.handleExpiringSubscriptions(ctx, coll); err != nil {
+		slog.Error("Failed to handle expiring subscriptions", "error", err)
+		return errors.New("failed to handle expiring subscriptions")
+	}
+	if err := h.handlePassedTargetDates(ctx, coll); err != nil {
+		slog.Error("Failed to handle passed target dates", "error", err)
+	}
+	return nil
+}
+
+// handleAdminRun runs an availability pass on demand, for catching up after missed schedules
+func (h *LambdaHandler) handleAdminRun(ctx context.Context) events.APIGatewayV2HTTPResponse {
+	slog.Info("Running availability pass on admin request")
+	summary, err := h.runAvailabilityPass(ctx)
+	if err != nil {
+		return errorResponse(500, err.Error())
+	}
+	body, _ := json.Marshal(struct {
+		Message string     `json:"message"`
+		Summary runSummary `json:"summary"`
+	}{"availability check completed", summary})
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    corsHeaders,
+		Body:       string(body),
+	}
+}
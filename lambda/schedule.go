@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	_ "time/tzdata" // CHECK_SCHEDULE_TIMEZONE must resolve on Lambda images without zoneinfo
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type (
+	// scheduleWindow runs checks every Interval between Start and End, in minutes since midnight.
+	// A window with End before Start wraps past midnight; equal times cover the whole day.
+	scheduleWindow struct {
+		Start, End int
+		Interval   int
+	}
+
+	// checkSchedule thins out scheduled checks by time of day. Times outside every window,
+	// and an empty schedule, check on every invocation.
+	checkSchedule []scheduleWindow
+)
+
+// parseCheckSchedule parses a comma-separated window list such as
+// "08:00-10:00=1m,10:00-22:00=5m,22:00-08:00=30m". The first window containing a time wins.
+func parseCheckSchedule(spec string) (checkSchedule, error) {
+	var schedule checkSchedule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		span, every, ok := strings.Cut(part, "=")
+		from, to, ok2 := strings.Cut(span, "-")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("window %q must look like HH:MM-HH:MM=5m", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %v", part, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %v", part, err)
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil || interval < time.Minute || interval%time.Minute != 0 {
+			return nil, fmt.Errorf("window %q: interval must be a whole number of minutes such as 5m, got %q", part, every)
+		}
+		schedule = append(schedule, scheduleWindow{Start: start, End: end, Interval: int(interval / time.Minute)})
+	}
+	return schedule, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("time must be HH:MM, got %q", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether minute (since midnight) falls inside the window
+func (w scheduleWindow) contains(minute int) bool {
+	if w.Start == w.End {
+		return true
+	}
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// due reports whether a check should run at t. Intervals are aligned to midnight, so "30m"
+// checks at :00 and :30 regardless of the window start.
+func (s checkSchedule) due(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s {
+		if w.contains(minute) {
+			return minute%w.Interval == 0
+		}
+	}
+	return true
+}
+
+// scheduleLocation loads CHECK_SCHEDULE_TIMEZONE, defaulting to UTC
+func (c *SharedConfig) scheduleLocation() (*time.Location, error) {
+	if c.CheckScheduleTimezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.CheckScheduleTimezone)
+}
+
+// scheduledCheckDue reports whether CHECK_SCHEDULE allows a scheduled check at now.
+// Settings are validated at startup; if they still fail to parse, checks run as usual.
+func (h *LambdaHandler) scheduledCheckDue(now time.Time) bool {
+	cfg := h.Mode.shared()
+	schedule, err := parseCheckSchedule(cfg.CheckSchedule)
+	if err != nil || len(schedule) == 0 {
+		return true
+	}
+	loc, err := cfg.scheduleLocation()
+	if err != nil {
+		return true
+	}
+	if !schedule.due(now.In(loc)) {
+		slog.Info("Skipping check outside CHECK_SCHEDULE cadence", "time", now.In(loc).Format("15:04"))
+		return false
+	}
+	return true
+}
+
+// scheduleSkippedResponse is returned for scheduled events that CHECK_SCHEDULE skips
+func scheduleSkippedResponse() events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Body:       `{"message": "skipped by check schedule"}`,
+	}
+}
+
+// scheduledEventSource is the EventBridge source of the default scheduled rule
+const scheduledEventSource = "aws.events"
+
+// parseEventSources parses SCHEDULE_EVENT_SOURCES, a comma-separated list of extra EventBridge
+// sources that trigger a check, such as "my.scheduler"
+func parseEventSources(spec string) ([]string, error) {
+	var sources []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if len(part) > 256 || strings.ContainsAny(part, " \t\"") {
+			return nil, fmt.Errorf("source %q must be an EventBridge source without spaces or quotes, at most 256 characters", part)
+		}
+		sources = append(sources, part)
+	}
+	return sources, nil
+}
+
+// isScheduledEvent reports whether an event should trigger an availability check: an event
+// from aws.events or a SCHEDULE_EVENT_SOURCES source, or an SQS batch carrying such an event in
+// a record body, as delivered by an EventBridge rule targeting a queue
+func (h *LambdaHandler) isScheduledEvent(eventMap map[string]interface{}) bool {
+	accepted := map[string]bool{scheduledEventSource: true}
+	extra, _ := parseEventSources(h.Mode.shared().ScheduleEventSources)
+	for _, source := range extra {
+		accepted[source] = true
+	}
+	if source, ok := eventMap["source"].(string); ok {
+		return accepted[source]
+	}
+	records, _ := eventMap["Records"].([]interface{})
+	for _, record := range records {
+		r, _ := record.(map[string]interface{})
+		if r["eventSource"] != "aws:sqs" {
+			continue
+		}
+		body, _ := r["body"].(string)
+		var wrapped struct {
+			Source string `json:"source"`
+		}
+		if json.Unmarshal([]byte(body), &wrapped) == nil && accepted[wrapped.Source] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseCheckSchedule(t *testing.T) {
+	schedule, err := parseCheckSchedule("08:00-10:00=1m, 22:00-08:00=30m")
+	assert.NoError(t, err)
+	assert.Equal(t, checkSchedule{{Start: 480, End: 600, Interval: 1}, {Start: 1320, End: 480, Interval: 30}}, schedule)
+
+	schedule, err = parseCheckSchedule("")
+	assert.NoError(t, err)
+	assert.Empty(t, schedule)
+
+	for _, spec := range []string{"08:00-10:00", "8-10=5m", "08:00-10:00=30s", "08:00-10:00=90s", "08:00-25:00=5m"} {
+		_, err := parseCheckSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCheckScheduleDue(t *testing.T) {
+	schedule, err := parseCheckSchedule("08:00-10:00=1m,10:00-22:00=5m,22:00-08:00=30m")
+	assert.NoError(t, err)
+	at := func(clock string) time.Time {
+		parsed, _ := time.Parse("15:04", clock)
+		return parsed
+	}
+
+	assert.True(t, schedule.due(at("08:07")), "dense window checks every minute")
+	assert.True(t, schedule.due(at("10:05")))
+	assert.False(t, schedule.due(at("10:07")))
+	assert.True(t, schedule.due(at("23:30")), "overnight window wraps past midnight")
+	assert.True(t, schedule.due(at("00:00")))
+	assert.False(t, schedule.due(at("03:10")))
+
+	allDay := checkSchedule{{Start: 0, End: 0, Interval: 15}}
+	assert.True(t, allDay.due(at("13:15")))
+	assert.False(t, allDay.due(at("13:17")))
+
+	partial := checkSchedule{{Start: 0, End: 360, Interval: 60}}
+	assert.True(t, partial.due(at("13:17")), "times outside every window always check")
+}
+
+func TestPersonalMode_CheckScheduleSkipsOffCadence(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+
+	apiCalls := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
+		json.NewEncoder(w).Encode([]Appointment{})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	handler.Mode.PersonalConfig.CheckScheduleTimezone = "America/New_York"
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+
+	// A daily interval is only due at midnight
+	if now := time.Now().In(mustLoadLocation(t, "America/New_York")); now.Hour() != 0 || now.Minute() != 0 {
+		handler.Mode.PersonalConfig.CheckSchedule = "00:00-00:00=1440m"
+		resp, err := handler.HandleRequest(context.Background(), eventJSON)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"message": "skipped by check schedule"}`, resp.Body)
+		assert.Zero(t, apiCalls)
+	}
+
+	handler.Mode.PersonalConfig.CheckSchedule = "00:00-00:00=1m"
+	handler.HandleRequest(context.Background(), eventJSON)
+	assert.Equal(t, 1, apiCalls)
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestIsScheduledEvent(t *testing.T) {
+	config := &Config{MongoDBPassword: "test"}
+	config.ScheduleEventSources = "my.scheduler, ops.appointments"
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: config}, "", nil)
+
+	sqsEvent := func(bodies ...string) map[string]interface{} {
+		records := make([]interface{}, len(bodies))
+		for i, body := range bodies {
+			records[i] = map[string]interface{}{"eventSource": "aws:sqs", "body": body}
+		}
+		return map[string]interface{}{"Records": records}
+	}
+	tests := []struct {
+		name  string
+		event map[string]interface{}
+		want  bool
+	}{
+		{"default rule", map[string]interface{}{"source": "aws.events"}, true},
+		{"custom bus source", map[string]interface{}{"source": "ops.appointments"}, true},
+		{"unknown source", map[string]interface{}{"source": "aws.s3"}, false},
+		{"API request", map[string]interface{}{"rawPath": "/subscriptions"}, false},
+		{"queued scheduled event", sqsEvent(`{"not json`, `{"source":"my.scheduler","detail-type":"Scheduled Event"}`), true},
+		{"queued other message", sqsEvent(`{"source":"aws.s3"}`, `hello`), false},
+		{"non-SQS record", map[string]interface{}{"Records": []interface{}{map[string]interface{}{"eventSource": "aws:s3", "body": `{"source":"aws.events"}`}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, handler.isScheduledEvent(tt.event))
+		})
+	}
+}
+
+func TestParseEventSources(t *testing.T) {
+	sources, err := parseEventSources(" my.scheduler,,ops.appointments ")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"my.scheduler", "ops.appointments"}, sources)
+
+	_, err = parseEventSources("my scheduler")
+	assert.Error(t, err)
+	assert.Len(t, (&SharedConfig{ScheduleEventSources: `"quoted"`}).validate(), 1)
+}
+
+func TestPersonalMode_CustomEventSourceTriggersCheck(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Mode.PersonalConfig.ScheduleEventSources = "my.scheduler"
+	stub := &stubTTPClient{responses: []stubTTPResponse{{body: `[]`}}}
+	handler.TTP = stub
+
+	eventJSON, _ := json.Marshal(events.SQSEvent{Records: []events.SQSMessage{{EventSource: "aws:sqs", Body: `{"source":"my.scheduler"}`}}})
+	resp, err := handler.HandleRequest(context.Background(), eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, stub.calls, 1)
+}
+
+func TestMultiUser_CheckScheduleSkipStillExpiresSubscriptions(t *testing.T) {
+	handler, coll, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if now.Hour() == 0 && now.Minute() == 0 {
+		t.Skip("a daily check is due at midnight")
+	}
+
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.M{"location": "5300", "ntfyTopic": "expiring", "createdAt": now.Add(-30 * 24 * time.Hour)},
+		bson.M{"location": "5300", "ntfyTopic": "past", "createdAt": now, "targetDate": "2000-01-01"},
+		bson.M{"location": "5300", "ntfyTopic": "active", "createdAt": now},
+	})
+	assert.NoError(t, err)
+
+	apiCalls := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
+		json.NewEncoder(w).Encode([]Appointment{})
+	}))
+	defer apiServer.Close()
+	handler.URL = apiServer.URL + "/%s"
+	handler.Notifier = &recordingNotifier{}
+	handler.Mode.MultiUserConfig.CheckSchedule = "00:00-00:00=1440m"
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	resp, err := handler.HandleRequest(ctx, eventJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"message": "skipped by check schedule"}`, resp.Body)
+	assert.Zero(t, apiCalls, "slot checks follow the schedule")
+
+	// Expiry and target dates are handled on every tick
+	count, err := coll.CountDocuments(ctx, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
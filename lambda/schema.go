@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+)
+
+// schemaDriftCursorName names the cursor holding the number of consecutive runs whose TTP
+// responses were missing expected fields
+const schemaDriftCursorName = "schemaDriftStreak"
+
+// defaultSchemaAlertThreshold is the streak that is reported when SCHEMA_ALERT_THRESHOLD is unset
+const defaultSchemaAlertThreshold = 3
+
+// Fields every element of a TTP response must carry. json.Unmarshal leaves renamed fields at
+// their zero value, so a slot without them would silently never count as available.
+var (
+	requiredSlotFields     = []string{"startTimestamp", "active"}
+	requiredLocationFields = []string{"id"}
+)
+
+// schemaTracker counts how TTP response shapes looked during one scheduled run
+type schemaTracker struct {
+	drifted atomic.Int64 // Responses with slot-like entries missing required fields
+	matched atomic.Int64 // Responses that parsed as expected
+}
+
+// reset zeroes the counters at the start of a scheduled run
+func (t *schemaTracker) reset() {
+	t.drifted.Store(0)
+	t.matched.Store(0)
+}
+
+// missingField returns the first required field absent from an element of a JSON array body,
+// or "" when every element has them all. Bodies that aren't arrays of objects are left to the
+// normal decoding errors, and empty arrays can't show drift.
+func missingField(body []byte, required []string) string {
+	var elements []map[string]json.RawMessage
+	if json.Unmarshal(body, &elements) != nil {
+		return ""
+	}
+	for _, element := range elements {
+		for _, field := range required {
+			if _, ok := element[field]; !ok {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// checkResponseSchema records whether a TTP response had the expected fields, logging the
+// first one it lacks. On-subscribe checks aren't part of a run, so they don't count.
+func (h *LambdaHandler) checkResponseSchema(ctx context.Context, serviceType, location string, body []byte, required []string) {
+	if isImmediateCheck(ctx) {
+		return
+	}
+	field := missingField(body, required)
+	if field == "" {
+		h.schema.matched.Add(1)
+		return
+	}
+	h.schema.drifted.Add(1)
+	slog.Warn("TTP response is missing an expected field, the API schema may have changed", "service", serviceType, "location", location, "field", field)
+}
+
+// schemaAlertThreshold returns how many consecutive runs with drifted responses are reported
+func (c *SharedConfig) schemaAlertThreshold() int {
+	if c.SchemaAlertThreshold <= 0 {
+		return defaultSchemaAlertThreshold
+	}
+	return c.SchemaAlertThreshold
+}
+
+// updateSchemaDriftStreak extends or resets the streak of consecutive scheduled runs that got
+// responses missing expected fields. Reaching the threshold logs an error and alerts
+// ADMIN_NTFY_TOPIC if set; matching responses afterwards report the recovery. Runs that got no
+// responses leave the streak unchanged.
+func (h *LambdaHandler) updateSchemaDriftStreak(ctx context.Context) {
+	drifted := h.schema.drifted.Load() > 0
+	if !drifted && h.schema.matched.Load() == 0 {
+		return
+	}
+	value, err := h.State.GetCursor(ctx, schemaDriftCursorName)
+	if err != nil {
+		slog.Warn("Failed to load schema drift streak", "error", err)
+		return
+	}
+	streak, _ := strconv.Atoi(value)
+	threshold := h.Mode.shared().schemaAlertThreshold()
+
+	next := 0
+	if drifted {
+		next = streak + 1
+	}
+	if next == streak {
+		return
+	}
+	if err := h.State.PutCursor(ctx, schemaDriftCursorName, strconv.Itoa(next)); err != nil {
+		slog.Warn("Failed to save schema drift streak", "error", err)
+		return
+	}
+
+	adminTopic := h.Mode.shared().AdminNtfyTopic != ""
+	switch {
+	case next == threshold:
+		slog.Error("TTP responses were missing expected fields for consecutive runs, the API schema may have changed", "runs", next)
+		if adminTopic {
+			h.sendAdminAlert(ctx, "Possible TTP API change",
+				fmt.Sprintf("The last %d scheduled runs got appointment data without the fields this watcher reads, so open slots may be missed. Check the logs and the TTP API response format.", next))
+		}
+	case next == 0 && streak >= threshold:
+		slog.Info("TTP responses match the expected schema again", "runs", streak)
+		if adminTopic {
+			h.sendAdminAlert(ctx, "TTP API responses recovered",
+				fmt.Sprintf("Appointment data has the expected fields again after %d runs.", streak))
+		}
+	}
+}
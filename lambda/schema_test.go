@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingField(t *testing.T) {
+	assert.Equal(t, "", missingField([]byte(`[]`), requiredSlotFields))
+	assert.Equal(t, "", missingField([]byte(`{"error":"maintenance"}`), requiredSlotFields), "decoding errors are reported elsewhere")
+	assert.Equal(t, "", missingField([]byte(`[{"startTimestamp":"2099-05-04T10:00","active":false}]`), requiredSlotFields))
+	assert.Equal(t, "startTimestamp", missingField([]byte(`[{"startTime":"2099-05-04T10:00","active":true}]`), requiredSlotFields))
+	assert.Equal(t, "active", missingField([]byte(`[{"startTimestamp":"2099-05-04T10:00","active":true},{"startTimestamp":"2099-05-04T11:00"}]`), requiredSlotFields))
+	assert.Equal(t, "id", missingField([]byte(`[{"locationId":5020,"name":"Blaine"}]`), requiredLocationFields))
+}
+
+func TestPersonalMode_SchemaDriftAlertsAdmin(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Mode.PersonalConfig.AdminNtfyTopic = "ops"
+	handler.Mode.PersonalConfig.SchemaAlertThreshold = 2
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	renamed := stubTTPResponse{body: `[{"locationId":5300,"slotStart":"2099-05-04T10:00","isActive":true}]`}
+	ttp := &stubTTPClient{responses: []stubTTPResponse{renamed}}
+	handler.TTP = ttp
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	run := func() { handler.HandleRequest(context.Background(), eventJSON) }
+	adminTitles := func() []string {
+		var got []string
+		for _, n := range notifier.sent {
+			if n.Topic == "ops" {
+				got = append(got, n.Title)
+			}
+		}
+		return got
+	}
+
+	run()
+	assert.Empty(t, notifier.sent, "renamed fields find no slots and stay below the threshold")
+	run()
+	run()
+	assert.Equal(t, []string{"Possible TTP API change"}, adminTitles(), "alerted once when the streak reaches the threshold")
+
+	ttp.responses = []stubTTPResponse{{body: `[]`}}
+	run()
+	assert.Equal(t, []string{"Possible TTP API change", "TTP API responses recovered"}, adminTitles())
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// maxSNSSubjectLength is the longest subject SNS accepts; longer titles are truncated
+const maxSNSSubjectLength = 100
+
+type (
+	// snsAPI is the subset of the SNS client used by SnsEventPublisher
+	snsAPI interface {
+		Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+	}
+
+	// SnsEventPublisher publishes each appointment event once to an SNS topic, alongside the ntfy
+	// alerts, so the topic's subscriptions (email, SMS, Lambda, ...) can fan it out. Messages
+	// addressed to one topic, such as expiry warnings or admin alerts, stay on the Notifier. The
+	// event, service and location travel as message attributes for subscription filter policies.
+	SnsEventPublisher struct {
+		Client   snsAPI
+		TopicARN string
+	}
+)
+
+// newSnsEventPublisher creates a publisher for the SNS topic at topicARN
+func newSnsEventPublisher(client snsAPI, topicARN string) *SnsEventPublisher {
+	return &SnsEventPublisher{Client: client, TopicARN: topicARN}
+}
+
+// Publish sends the alert built for the event with its title as the subject. Attachments aren't
+// supported by SNS and are dropped; the message already describes the slot.
+func (p *SnsEventPublisher) Publish(ctx context.Context, event AppointmentEvent, alert Notification) error {
+	attributes := map[string]types.MessageAttributeValue{
+		"event":       {DataType: aws.String("String"), StringValue: aws.String(event.Event)},
+		"serviceType": {DataType: aws.String("String"), StringValue: aws.String(event.ServiceType)},
+	}
+	location := event.Location
+	if location == "" {
+		location = strings.Join(event.Locations, ",")
+	}
+	if location != "" {
+		attributes["location"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(location)}
+	}
+	if alert.Priority > 0 {
+		attributes["priority"] = types.MessageAttributeValue{DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(alert.Priority))}
+	}
+	if alert.Click != "" {
+		attributes["click"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(alert.Click)}
+	}
+	input := &sns.PublishInput{
+		TopicArn:          aws.String(p.TopicARN),
+		Message:           aws.String(alert.Message),
+		MessageAttributes: attributes,
+	}
+	if subject := snsSubject(alert.Title); subject != "" {
+		input.Subject = aws.String(subject)
+	}
+	if _, err := p.Client.Publish(ctx, input); err != nil {
+		return fmt.Errorf("failed to publish to SNS: %v", err)
+	}
+	slog.Info("Published appointment event to SNS", "service", event.ServiceType, "location", location)
+	return nil
+}
+
+// publishAppointmentEvent sends the event to SNS_TOPIC_ARN when configured, with the alert in
+// the default locale. Like webhook events, on-subscribe checks are left to the scheduled run,
+// and failures are only logged so they never block ntfy alerts.
+func (h *LambdaHandler) publishAppointmentEvent(ctx context.Context, event AppointmentEvent, alert Notification) {
+	if h.Events == nil || isImmediateCheck(ctx) {
+		return
+	}
+	event.Event = webhookEventAvailable
+	event.DetectedAt = time.Now().UTC()
+	if err := h.Events.Publish(ctx, event, alert); err != nil {
+		slog.Warn("Failed to publish SNS appointment event", "service", event.ServiceType, "location", event.Location, "error", err)
+	}
+}
+
+// snsSubject makes a title valid as an SNS subject, which must be a single line of at most
+// 100 characters
+func snsSubject(title string) string {
+	subject := strings.Join(strings.Fields(title), " ")
+	if runes := []rune(subject); len(runes) > maxSNSSubjectLength {
+		subject = string(runes[:maxSNSSubjectLength])
+	}
+	return subject
+}
+
+// validateSNSTopicARN checks that an SNS_TOPIC_ARN, when set, looks like an SNS topic ARN
+func validateSNSTopicARN(arn string) error {
+	parts := strings.Split(arn, ":")
+	if arn != "" && (len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || parts[5] == "") {
+		return fmt.Errorf("SNS_TOPIC_ARN must look like arn:aws:sns:us-east-1:123456789012:appointments, got %q", arn)
+	}
+	return nil
+}
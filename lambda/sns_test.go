@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSNS records published messages and optionally fails
+type fakeSNS struct {
+	inputs []*sns.PublishInput
+	err    error
+}
+
+func (f *fakeSNS) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &sns.PublishOutput{}, f.err
+}
+
+func TestSnsEventPublisher_Publish(t *testing.T) {
+	client := &fakeSNS{}
+	publisher := newSnsEventPublisher(client, "arn:aws:sns:us-west-2:123456789012:appointments")
+
+	err := publisher.Publish(context.Background(), AppointmentEvent{Event: webhookEventAvailable, ServiceType: "Global Entry", Location: "5300"}, Notification{
+		Title:    "Global Entry Appointment Notification",
+		Message:  "Global Entry appointment available at 5300 on 2025-05-04T10:00",
+		Priority: 5,
+		Click:    "https://example.com/book?location=5300",
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, client.inputs, 1) {
+		input := client.inputs[0]
+		assert.Equal(t, "arn:aws:sns:us-west-2:123456789012:appointments", *input.TopicArn)
+		assert.Equal(t, "Global Entry Appointment Notification", *input.Subject)
+		assert.Equal(t, "Global Entry appointment available at 5300 on 2025-05-04T10:00", *input.Message)
+		assert.Equal(t, webhookEventAvailable, *input.MessageAttributes["event"].StringValue)
+		assert.Equal(t, "Global Entry", *input.MessageAttributes["serviceType"].StringValue)
+		assert.Equal(t, "5300", *input.MessageAttributes["location"].StringValue)
+		assert.Equal(t, "5", *input.MessageAttributes["priority"].StringValue)
+		assert.Equal(t, "Number", *input.MessageAttributes["priority"].DataType)
+		assert.Equal(t, "https://example.com/book?location=5300", *input.MessageAttributes["click"].StringValue)
+	}
+
+	client.err = errors.New("throttled")
+	err = publisher.Publish(context.Background(), AppointmentEvent{ServiceType: "NEXUS", Locations: []string{"5020", "5140"}}, Notification{Message: "m"})
+	assert.EqualError(t, err, "failed to publish to SNS: throttled")
+	assert.Nil(t, client.inputs[1].Subject, "empty titles send no subject")
+	assert.Equal(t, "5020,5140", *client.inputs[1].MessageAttributes["location"].StringValue)
+	assert.NotContains(t, client.inputs[1].MessageAttributes, "priority")
+}
+
+func TestCheckAvailability_PublishesEventToSNSOnceAlongsideNtfy(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Appointment{{LocationID: 5300, StartTimestamp: "2099-05-04T10:00", Active: true}})
+	}))
+	defer apiServer.Close()
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: &Config{MongoDBPassword: "test"}}, apiServer.URL+"/%s", nil)
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	client := &fakeSNS{}
+	handler.Events = newSnsEventPublisher(client, "arn:aws:sns:us-west-2:123456789012:appointments")
+
+	subscribers := []Subscriber{{Topic: "a"}, {Topic: "b", Locale: "es"}}
+	assert.NoError(t, handler.checkAvailabilityAndNotifyWithMinimums(context.Background(), "Global Entry", "5300", subscribers, []int{1}))
+
+	// Every topic still hears through ntfy, while SNS gets the event once
+	assert.Equal(t, []string{"a", "b"}, topicsOfNotifications(notifier.sent))
+	if assert.Len(t, client.inputs, 1) {
+		assert.Contains(t, *client.inputs[0].Message, "2099-05-04T10:00")
+		assert.NotContains(t, client.inputs[0].MessageAttributes, "topic")
+	}
+
+	// On-subscribe checks reach only the new subscriber, so nothing is published
+	handler.Events.Client = &fakeSNS{}
+	assert.NoError(t, handler.checkAvailabilityAndNotifyWithMinimums(withImmediateCheck(context.Background()), "Global Entry", "5300", subscribers[:1], []int{1}))
+	assert.Empty(t, handler.Events.Client.(*fakeSNS).inputs)
+}
+
+func TestSnsSubject(t *testing.T) {
+	assert.Equal(t, "NEXUS (2 locations)", snsSubject("NEXUS\n(2 locations)"))
+	assert.Len(t, []rune(snsSubject(strings.Repeat("é", 150))), maxSNSSubjectLength)
+}
+
+func TestValidateSNSTopicARN(t *testing.T) {
+	assert.NoError(t, validateSNSTopicARN(""))
+	assert.NoError(t, validateSNSTopicARN("arn:aws:sns:us-east-1:123456789012:appointments"))
+	assert.Error(t, validateSNSTopicARN("appointments"))
+	assert.Error(t, validateSNSTopicARN("arn:aws:sqs:us-east-1:123456789012:appointments"))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type (
+	// LocationState is the last-seen availability state for a service and location
+	LocationState struct {
+		Available bool      `bson:"available"`
+		Count     int       `bson:"count"` // Open slots seen, tracked for SLOT_SURGE_THRESHOLD
+		UpdatedAt time.Time `bson:"updatedAt"`
+	}
+
+	// StateStore persists LocationState and named cursors between invocations
+	StateStore interface {
+		Get(ctx context.Context, key string) (LocationState, error)
+		Put(ctx context.Context, key string, state LocationState) error
+		GetCursor(ctx context.Context, name string) (string, error)
+		PutCursor(ctx context.Context, name, value string) error
+	}
+
+	// memoryStateStore keeps state for the lifetime of a warm Lambda container
+	memoryStateStore struct {
+		mu      sync.Mutex
+		states  map[string]LocationState
+		cursors map[string]string
+	}
+
+	// mongoStateStore keeps state in a MongoDB collection keyed by _id
+	mongoStateStore struct {
+		coll *mongo.Collection
+	}
+)
+
+// newMemoryStateStore creates an in-memory StateStore
+func newMemoryStateStore() *memoryStateStore {
+	return &memoryStateStore{states: make(map[string]LocationState), cursors: make(map[string]string)}
+}
+
+// Get returns the stored state, or the zero state if none exists
+func (s *memoryStateStore) Get(ctx context.Context, key string) (LocationState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+// Put stores the state
+func (s *memoryStateStore) Put(ctx context.Context, key string, state LocationState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[key] = state
+	return nil
+}
+
+// GetCursor returns the named cursor, or "" if none exists
+func (s *memoryStateStore) GetCursor(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cursors[name], nil
+}
+
+// PutCursor stores the named cursor
+func (s *memoryStateStore) PutCursor(ctx context.Context, name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[name] = value
+	return nil
+}
+
+// newMongoStateStore creates a StateStore backed by the given collection
+func newMongoStateStore(coll *mongo.Collection) *mongoStateStore {
+	return &mongoStateStore{coll: coll}
+}
+
+// Get returns the stored state, or the zero state if none exists
+func (s *mongoStateStore) Get(ctx context.Context, key string) (LocationState, error) {
+	var state LocationState
+	err := s.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return LocationState{}, nil
+	}
+	if err != nil {
+		return LocationState{}, fmt.Errorf("failed to load state for %s: %v", key, err)
+	}
+	return state, nil
+}
+
+// Put upserts the state
+func (s *mongoStateStore) Put(ctx context.Context, key string, state LocationState) error {
+	_, err := s.coll.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": state}, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save state for %s: %v", key, err)
+	}
+	return nil
+}
+
+// GetCursor returns the named cursor, or "" if none exists
+func (s *mongoStateStore) GetCursor(ctx context.Context, name string) (string, error) {
+	var doc struct {
+		Cursor string `bson:"cursor"`
+	}
+	err := s.coll.FindOne(ctx, bson.M{"_id": cursorKey(name)}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load cursor %s: %v", name, err)
+	}
+	return doc.Cursor, nil
+}
+
+// PutCursor upserts the named cursor
+func (s *mongoStateStore) PutCursor(ctx context.Context, name, value string) error {
+	update := bson.M{"$set": bson.M{"cursor": value, "updatedAt": time.Now().UTC()}}
+	if _, err := s.coll.UpdateOne(ctx, bson.M{"_id": cursorKey(name)}, update, options.UpdateOne().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to save cursor %s: %v", name, err)
+	}
+	return nil
+}
+
+// cursorKey keeps cursor documents apart from location state keys
+func cursorKey(name string) string {
+	return "cursor|" + name
+}
+
+// stateKey identifies the state for a service and location
+func stateKey(serviceType, location string) string {
+	return serviceType + "|" + location
+}
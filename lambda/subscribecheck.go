@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+type (
+	immediateCheckContextKey struct{}
+
+	// heldRequestSlot is the request slot of the subscribe call that may start an on-subscribe
+	// check. The check takes it over, so it never waits on a second slot that
+	// MAX_CONCURRENT_REQUESTS=1 could not grant while the call holds the only one.
+	heldRequestSlot struct {
+		handedOff bool
+	}
+
+	heldRequestSlotContextKey struct{}
+)
+
+// withImmediateCheck marks ctx as an on-subscribe check for a single new subscriber
+func withImmediateCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, immediateCheckContextKey{}, true)
+}
+
+// isImmediateCheck reports whether ctx belongs to an on-subscribe check. Such checks leave
+// transition state, dedup keys and webhook events to the scheduled run, since they only
+// notify one subscriber and must not hide the slot from everyone else watching the location.
+// They also stay out of the rate-limit and schema drift streaks, which count scheduled runs.
+func isImmediateCheck(ctx context.Context) bool {
+	immediate, _ := ctx.Value(immediateCheckContextKey{}).(bool)
+	return immediate
+}
+
+// withHeldRequestSlot returns a context through which an on-subscribe check can take over slot
+func withHeldRequestSlot(ctx context.Context, slot *heldRequestSlot) context.Context {
+	return context.WithValue(ctx, heldRequestSlotContextKey{}, slot)
+}
+
+// takeRequestSlot hands the check the subscribe call's slot when it holds one, and otherwise
+// acquires a slot of its own
+func (h *LambdaHandler) takeRequestSlot(ctx context.Context) bool {
+	if slot, _ := ctx.Value(heldRequestSlotContextKey{}).(*heldRequestSlot); slot != nil && !slot.handedOff {
+		slot.handedOff = true
+		return true
+	}
+	_, ok := h.acquireRequestSlot()
+	return ok
+}
+
+// startSubscribeCheck checks the new subscriber's location in the background when
+// CHECK_ON_SUBSCRIBE is set, so an already open slot is reported without waiting for the
+// next scheduled run. The check runs under the subscribe call's request slot, released once the
+// check finishes. Without one it is skipped rather than queued when no slot is free or the
+// circuit breaker is open, keeping bursts of subscribes off the TTP API.
+func (h *LambdaHandler) startSubscribeCheck(ctx context.Context, serviceType, location string, sub Subscriber) {
+	if !h.Mode.MultiUserConfig.CheckOnSubscribe {
+		return
+	}
+	if !h.takeRequestSlot(ctx) {
+		slog.Info("Skipping check on subscribe, no capacity", "service", serviceType, "location", location)
+		return
+	}
+	checkCtx := withImmediateCheck(ctx)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		defer h.releaseRequestSlot()
+		if err := h.checkAvailabilityAndNotifyWithMinimums(checkCtx, serviceType, location, []Subscriber{sub}, []int{1}); err != nil {
+			slog.Error("Failed to check availability on subscribe", "service", serviceType, "location", location, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartSubscribeCheck(t *testing.T) {
+	slot := "2099-05-04T10:00"
+	apiCalls := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
+		json.NewEncoder(w).Encode([]Appointment{{LocationID: 5300, StartTimestamp: slot, Active: true}})
+	}))
+	defer apiServer.Close()
+
+	newHandler := func(config *Config) (*LambdaHandler, *recordingNotifier) {
+		config.MongoDBPassword = "test"
+		handler := NewLambdaHandler(&AppMode{MultiUserConfig: config}, apiServer.URL+"/%s", nil)
+		handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+		notifier := &recordingNotifier{}
+		handler.Notifier = notifier
+		return handler, notifier
+	}
+	ctx := context.Background()
+
+	t.Run("disabled by default", func(t *testing.T) {
+		handler, notifier := newHandler(&Config{MaxConcurrentRequests: 1})
+		handler.startSubscribeCheck(ctx, "Global Entry", "5300", Subscriber{Topic: "new"})
+		handler.background.Wait()
+		assert.Zero(t, apiCalls)
+		assert.Empty(t, notifier.sent)
+	})
+
+	t.Run("notifies only the new subscriber and leaves dedup to the scheduled run", func(t *testing.T) {
+		config := &Config{CheckOnSubscribe: true, MaxConcurrentRequests: 1}
+		config.DedupTTLSeconds = 3600
+		handler, notifier := newHandler(config)
+		handler.startSubscribeCheck(ctx, "Global Entry", "5300", Subscriber{Topic: "new"})
+		handler.background.Wait()
+		assert.Equal(t, 1, apiCalls)
+		if assert.Len(t, notifier.sent, 1) {
+			assert.Equal(t, "new", notifier.sent[0].Topic)
+		}
+		assert.False(t, handler.alreadyNotified(ctx, dedupKey("Global Entry", "5300", slot)))
+		assert.Len(t, handler.requestSlots, 0, "request slot released")
+		// Run streaks only count scheduled checks
+		assert.Zero(t, handler.throttle.succeeded.Load())
+		assert.Zero(t, handler.schema.matched.Load())
+	})
+
+	t.Run("runs under the subscribe call's slot when it holds the only one", func(t *testing.T) {
+		apiCalls = 0
+		handler, notifier := newHandler(&Config{CheckOnSubscribe: true, MaxConcurrentRequests: 1})
+		held := &heldRequestSlot{}
+		resp, err := handler.runDatabaseRequest(held, func() (events.APIGatewayV2HTTPResponse, error) {
+			handler.startSubscribeCheck(withHeldRequestSlot(ctx, held), "Global Entry", "5300", Subscriber{Topic: "new"})
+			return events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		handler.background.Wait()
+		assert.Equal(t, 1, apiCalls)
+		assert.Len(t, notifier.sent, 1)
+		assert.Len(t, handler.requestSlots, 0, "check released the inherited slot")
+	})
+
+	t.Run("skipped without a free request slot", func(t *testing.T) {
+		apiCalls = 0
+		handler, notifier := newHandler(&Config{CheckOnSubscribe: true, MaxConcurrentRequests: 1})
+		handler.requestSlots <- struct{}{}
+		handler.startSubscribeCheck(ctx, "Global Entry", "5300", Subscriber{Topic: "new"})
+		handler.background.Wait()
+		assert.Zero(t, apiCalls)
+		assert.Empty(t, notifier.sent)
+	})
+}
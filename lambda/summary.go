@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// dailySummaryEventKey marks the event the DAILY_SUMMARY_TIME schedule sends, {"dailySummary": true}
+const dailySummaryEventKey = "dailySummary"
+
+type (
+	// watchedLocation is one service and location that appears in daily summaries
+	watchedLocation struct {
+		ServiceType, Location string
+	}
+
+	// summaryTopic is one topic's daily summary: its preferences and the locations it watches
+	summaryTopic struct {
+		Subscriber Subscriber
+		Locations  []watchedLocation
+	}
+
+	// summarySlot is the soonest bookable slot at a location, or why it isn't known
+	summarySlot struct {
+		StartTimestamp string
+		Err            error
+	}
+)
+
+// isDailySummaryEvent reports whether an event was sent by the DAILY_SUMMARY_TIME schedule
+func isDailySummaryEvent(eventMap map[string]interface{}) bool {
+	summary, _ := eventMap[dailySummaryEventKey].(bool)
+	return summary
+}
+
+// summaryTimezone loads DAILY_SUMMARY_TIMEZONE, defaulting to UTC
+func (c *SharedConfig) summaryTimezone() (*time.Location, error) {
+	if c.DailySummaryTimezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.DailySummaryTimezone)
+}
+
+// handleDailySummary sends every topic one notification listing the soonest open slot at each
+// location it watches. The schedule itself fires at DAILY_SUMMARY_TIME; a topic is summarized
+// at most once per local day, so retried invocations don't repeat it.
+func (h *LambdaHandler) handleDailySummary(ctx context.Context) (events.APIGatewayV2HTTPResponse, error) {
+	cfg := h.Mode.shared()
+	if cfg.DailySummaryTime == "" {
+		slog.Warn("Ignoring daily summary event, DAILY_SUMMARY_TIME is not set")
+		return events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: `{"message": "daily summary disabled"}`}, nil
+	}
+	topics, err := h.summaryTopics(ctx)
+	if err != nil {
+		slog.Error("Failed to load subscriptions for daily summary", "error", err)
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500, Body: `{"error": "failed to load subscriptions"}`}, nil
+	}
+	soonest := h.soonestSlots(ctx, topics)
+
+	loc, err := cfg.summaryTimezone()
+	if err != nil {
+		loc = time.UTC
+	}
+	day := time.Now().In(loc).Format(time.DateOnly)
+	sent := 0
+	for _, topic := range topics {
+		key := "summary|" + day + "|" + topic.Subscriber.Topic
+		if seen, err := h.Dedup.Seen(ctx, key); err != nil {
+			slog.Warn("Failed to check daily summary dedup store", "topic", topic.Subscriber.Topic, "error", err)
+		} else if seen {
+			continue
+		}
+		_, err := h.notifyLocalized(ctx, "", []Subscriber{topic.Subscriber}, func(locale string) Notification {
+			return Notification{Title: messagesFor(locale).SummaryTitle, Message: h.summaryMessage(ctx, topic.Locations, soonest, locale)}
+		})
+		if err != nil {
+			slog.Error("Failed to send daily summary", "topic", topic.Subscriber.Topic, "error", err)
+			continue
+		}
+		sent++
+		if err := h.Dedup.Mark(ctx, key, 24*time.Hour); err != nil {
+			slog.Warn("Failed to update daily summary dedup store", "topic", topic.Subscriber.Topic, "error", err)
+		}
+	}
+	slog.Info("Sent daily summary", "topics", sent)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Body:       fmt.Sprintf(`{"message": "daily summary sent", "topics": %d}`, sent),
+	}, nil
+}
+
+// summaryTopics returns each topic to summarize with the locations it watches, in first-seen
+// order. Personal mode has one topic; multi-user mode reads every subscription. One-shot
+// subscriptions are kept, since a summary isn't the alert they are waiting for.
+func (h *LambdaHandler) summaryTopics(ctx context.Context) ([]summaryTopic, error) {
+	if h.Mode.IsPersonalMode {
+		config := h.Mode.PersonalConfig
+		serviceTypes := parseServiceTypes(config.ServiceType)
+		locations := parseServiceLocations(serviceTypes, config.LocationID)
+		topic := summaryTopic{Subscriber: Subscriber{Topic: config.NtfyTopic}}
+		for _, serviceType := range serviceTypes {
+			if location := locations[serviceType]; location != "" {
+				topic.Locations = append(topic.Locations, watchedLocation{serviceType, location})
+			}
+		}
+		return []summaryTopic{topic}, nil
+	}
+
+	projection := bson.M{"_id": 0, "location": 1, "ntfyTopic": 1, "serviceType": 1, "priority": 1, "tags": 1, "locale": 1}
+	cursor, err := h.subscriptions().Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	var subs []Subscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	var topics []summaryTopic
+	index := make(map[string]int)
+	for _, sub := range subs {
+		i, ok := index[sub.NtfyTopic]
+		if !ok {
+			i = len(topics)
+			index[sub.NtfyTopic] = i
+			topics = append(topics, summaryTopic{Subscriber: Subscriber{Topic: sub.NtfyTopic, Priority: sub.Priority, Tags: sub.Tags, Locale: sub.Locale}})
+		}
+		topics[i].Locations = append(topics[i].Locations, watchedLocation{subscriptionServiceType(sub.ServiceType), sub.Location})
+	}
+	return topics, nil
+}
+
+// soonestSlots looks up the soonest slot of every location the topics watch, checking each
+// location once however many topics watch it
+func (h *LambdaHandler) soonestSlots(ctx context.Context, topics []summaryTopic) map[watchedLocation]summarySlot {
+	results := make(map[watchedLocation]summarySlot)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 10)
+	for _, topic := range topics {
+		for _, loc := range topic.Locations {
+			mu.Lock()
+			_, seen := results[loc]
+			if !seen {
+				results[loc] = summarySlot{}
+			}
+			mu.Unlock()
+			if seen {
+				continue
+			}
+			wg.Add(1)
+			go func(loc watchedLocation) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+				slot, err := h.soonestBookableSlot(ctx, loc.ServiceType, loc.Location)
+				mu.Lock()
+				results[loc] = summarySlot{StartTimestamp: slot, Err: err}
+				mu.Unlock()
+			}(loc)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// soonestBookableSlot returns the earliest slot at a location that checks would alert for, or "" when
+// there is none. Slots are filtered as in checkSingleMinimum but nothing is notified, so
+// GET /soonest and the daily summary agree with alerts. The query is always ordered soonest first,
+// even with ORDER_BY=latest.
+func (h *LambdaHandler) soonestBookableSlot(ctx context.Context, serviceType, location string) (string, error) {
+	body, err := h.ttp().FetchSlots(withSoonestQuery(ctx), serviceType, location, 1)
+	if err != nil {
+		return "", err
+	}
+	appointments, err := parseAppointments(body)
+	if err != nil {
+		return "", err
+	}
+	_, _, kept := h.bookableSlots(ctx, serviceType, location, appointments, time.Now())
+	soonest := ""
+	for _, appt := range kept {
+		// TTP timestamps share one layout, so they sort as strings
+		if soonest == "" || appt.StartTimestamp < soonest {
+			soonest = appt.StartTimestamp
+		}
+	}
+	return soonest, nil
+}
+
+// summaryMessage lists one line per location, naming centers when their metadata resolves
+func (h *LambdaHandler) summaryMessage(ctx context.Context, locations []watchedLocation, soonest map[watchedLocation]summarySlot, locale string) string {
+	messages := messagesFor(locale)
+	lines := make([]string, 0, len(locations))
+	for _, loc := range locations {
+		name := loc.Location
+		if center, ok, err := h.Locations.Resolve(ctx, loc.ServiceType, loc.Location); err == nil && ok && center.Name != "" {
+			name = fmt.Sprintf("%s (%s)", center.Name, loc.Location)
+		}
+		switch slot := soonest[loc]; {
+		case slot.Err != nil:
+			lines = append(lines, fmt.Sprintf(messages.SummaryUnavailable, loc.ServiceType, name))
+		case slot.StartTimestamp == "":
+			lines = append(lines, fmt.Sprintf(messages.SummaryNoSlots, loc.ServiceType, name))
+		default:
+			lines = append(lines, fmt.Sprintf(messages.SummarySoonest, loc.ServiceType, name, slot.StartTimestamp))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
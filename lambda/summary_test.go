@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// locationTTPClient returns one canned response per location
+type locationTTPClient map[string]stubTTPResponse
+
+func (c locationTTPClient) FetchSlots(ctx context.Context, serviceType, location string, minimum int) ([]byte, error) {
+	resp := c[location]
+	return []byte(resp.body), resp.err
+}
+
+func TestHandleRequest_DailySummary(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	locationsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Location{{ID: 5300, Name: "JFK"}})
+	}))
+	defer locationsServer.Close()
+	handler.Locations.URL = locationsServer.URL
+	handler.TTP = locationTTPClient{
+		"5300": {body: `[{"startTimestamp":"2099-06-01T10:00","active":true},{"startTimestamp":"2099-05-04T09:00","active":true}]`},
+		"5020": {body: `[]`},
+	}
+	event := json.RawMessage(`{"dailySummary": true}`)
+
+	resp, err := handler.HandleRequest(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Contains(t, resp.Body, "daily summary disabled")
+	assert.Empty(t, notifier.sent)
+
+	config := handler.Mode.PersonalConfig
+	config.DailySummaryTime = "07:30"
+	config.ServiceType = "Global Entry,NEXUS"
+	config.LocationID = "Global Entry=5300,NEXUS=5020"
+	resp, err = handler.HandleRequest(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []Notification{{
+		Topic:   "test-topic",
+		Title:   "Daily Appointment Summary",
+		Message: "Global Entry at JFK (5300): soonest 2099-05-04T09:00\nNEXUS at 5020: no open slots",
+	}}, notifier.sent)
+
+	// A retried invocation the same day doesn't repeat the summary
+	notifier.sent = nil
+	_, err = handler.HandleRequest(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Empty(t, notifier.sent)
+}
+
+func TestSummaryMessage_Unavailable(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Locations.URL = "http://127.0.0.1:0"
+	loc := watchedLocation{ServiceType: "Global Entry", Location: "5300"}
+	message := handler.summaryMessage(context.Background(), []watchedLocation{loc}, map[watchedLocation]summarySlot{loc: {Err: errors.New("timeout")}}, "es")
+	assert.Equal(t, "Global Entry en 5300: no se pudo consultar", message)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// surgeStateKey keeps the slot count tracked for SLOT_SURGE_THRESHOLD apart from the
+// NOTIFY_ON_TRANSITION state of the same location
+func surgeStateKey(serviceType, location string) string {
+	return "surge|" + stateKey(serviceType, location)
+}
+
+// leadTimeSlotsLimit is how many slots a check asks for under MIN_LEAD_TIME, so bookable slots
+// are still seen after the soonest ones are dropped
+const leadTimeSlotsLimit = 50
+
+// slotsLimit returns how many slots each check asks TTP for. One is enough to detect
+// availability; SLOT_SURGE_THRESHOLD needs to see at least the threshold to count a surge, and
+// MIN_LEAD_TIME needs slots past those it skips.
+func (c *SharedConfig) slotsLimit() int {
+	limit := max(1, c.SlotSurgeThreshold)
+	if c.MinLeadTime > 0 {
+		limit = max(limit, leadTimeSlotsLimit)
+	}
+	return limit
+}
+
+// surgeRearmBelow returns the count a location must drop under before another surge is alerted,
+// defaulting to the threshold itself
+func (c *SharedConfig) surgeRearmBelow() int {
+	if c.SlotSurgeRearmBelow <= 0 || c.SlotSurgeRearmBelow > c.SlotSurgeThreshold {
+		return c.SlotSurgeThreshold
+	}
+	return c.SlotSurgeRearmBelow
+}
+
+// checkSlotSurge alerts subscribers once when a location's open slot count rises to
+// SLOT_SURGE_THRESHOLD, which usually means CBP released a batch of appointments. The
+// alert re-arms once the count drops below SLOT_SURGE_REARM_BELOW. The first count seen for a
+// location is only recorded, since nothing says whether it just rose; seen at or above the
+// threshold, it counts as already surged. Failures are only logged.
+func (h *LambdaHandler) checkSlotSurge(ctx context.Context, serviceType, location string, subscribers []Subscriber, count int) {
+	cfg := h.Mode.shared()
+	if cfg.SlotSurgeThreshold <= 0 || location == "" || isImmediateCheck(ctx) {
+		return
+	}
+	key := surgeStateKey(serviceType, location)
+	previous, err := h.State.Get(ctx, key)
+	if err != nil {
+		slog.Warn("Failed to load slot surge state", "service", serviceType, "location", location, "error", err)
+		return
+	}
+
+	// Available marks a location already at or above the threshold, alerted or first seen there,
+	// so only a rise from below the threshold alerts
+	first := previous.UpdatedAt.IsZero()
+	crossed := !first && !previous.Available && previous.Count < cfg.SlotSurgeThreshold && count >= cfg.SlotSurgeThreshold
+	surged := previous.Available
+	switch {
+	case count >= cfg.SlotSurgeThreshold:
+		surged = true
+	case count < cfg.surgeRearmBelow():
+		surged = false
+	}
+	state := LocationState{Available: surged, Count: count, UpdatedAt: time.Now().UTC()}
+	if err := h.State.Put(ctx, key, state); err != nil {
+		slog.Warn("Failed to save slot surge state", "service", serviceType, "location", location, "error", err)
+		return
+	}
+	if !crossed {
+		return
+	}
+
+	slog.Info("Slot count crossed SLOT_SURGE_THRESHOLD", "service", serviceType, "location", location, "previous", previous.Count, "count", count)
+	_, err = h.notifyLocalized(ctx, location, subscribers, func(locale string) Notification {
+		message := fmt.Sprintf(messagesFor(locale).SlotSurge, count, serviceType, location, previous.Count)
+		return h.withBookingLink(Notification{Title: getNotificationTitle(serviceType, locale), Message: message}, serviceType, location, locale)
+	})
+	if err != nil {
+		slog.Error("Failed to send slot surge notification", "service", serviceType, "location", location, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slotsBody returns a TTP response with n distinct active slots
+func slotsBody(n int) string {
+	slots := make([]string, n)
+	for i := range slots {
+		slots[i] = fmt.Sprintf(`{"locationId":5300,"startTimestamp":"2099-05-%02dT10:00","active":true}`, i+1)
+	}
+	return "[" + strings.Join(slots, ",") + "]"
+}
+
+func TestPersonalMode_SlotSurge(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Mode.PersonalConfig.SlotSurgeThreshold = 5
+	handler.Mode.PersonalConfig.SlotSurgeRearmBelow = 2
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+
+	// The first count is only recorded; 10 after 2 is a surge, then the count must fall
+	// below 2 before the next rise alerts again
+	counts := []int{2, 10, 10, 3, 10, 1, 10}
+	var surges []string
+	for _, n := range counts {
+		handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: slotsBody(n)}}}
+		notifier.sent = nil
+		_, err := handler.handlePersonalMode(context.Background())
+		assert.NoError(t, err)
+		for _, sent := range notifier.sent {
+			if strings.Contains(sent.Message, "up from") {
+				surges = append(surges, sent.Message)
+			}
+		}
+	}
+	assert.Equal(t, []string{
+		"10 Global Entry slots open at 5300, up from 2. A new batch may have been released.",
+		"10 Global Entry slots open at 5300, up from 1. A new batch may have been released.",
+	}, surges)
+}
+
+func TestGetAppointmentURL_SlotSurgeLimit(t *testing.T) {
+	cfg := &SharedConfig{}
+	assert.Contains(t, getAppointmentURL(cfg, "Global Entry", "5300", 1), "limit=1&")
+
+	cfg.SlotSurgeThreshold = 8
+	assert.Contains(t, getAppointmentURL(cfg, "Global Entry", "5300", 1), "limit=8&")
+}
+
+func TestPersonalMode_SlotSurgeNeedsUpwardCrossing(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Mode.PersonalConfig.SlotSurgeThreshold = 5
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+
+	// Already above the threshold when first seen, then still above: nothing rose through it
+	for _, n := range []int{8, 10} {
+		handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: slotsBody(n)}}}
+		_, err := handler.handlePersonalMode(context.Background())
+		assert.NoError(t, err)
+	}
+	for _, sent := range notifier.sent {
+		assert.NotContains(t, sent.Message, "up from")
+	}
+}
+
+func TestMultiUser_SlotSurgeRearmsAfterDrainingToZero(t *testing.T) {
+	handler, _, cleanup := setupTestHandler(t)
+	defer cleanup()
+	ctx := context.Background()
+	handler.Mode.MultiUserConfig.SlotSurgeThreshold = 5
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	assert.IsType(t, &mongoStateStore{}, handler.State)
+
+	// A drained count of zero must be saved, or the old high count blocks the next surge
+	for _, n := range []int{2, 10, 0, 10} {
+		handler.checkSlotSurge(ctx, "Global Entry", "5300", []Subscriber{{Topic: "a"}}, n)
+	}
+	var surges []string
+	for _, sent := range notifier.sent {
+		surges = append(surges, sent.Message)
+	}
+	assert.Equal(t, []string{
+		"10 Global Entry slots open at 5300, up from 2. A new batch may have been released.",
+		"10 Global Entry slots open at 5300, up from 0. A new batch may have been released.",
+	}, surges)
+
+	state, err := handler.State.Get(ctx, surgeStateKey("Global Entry", "5300"))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, state.Count)
+}
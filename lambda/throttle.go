@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// rateLimitCursorName names the cursor holding the number of consecutive rate-limited runs
+const rateLimitCursorName = "rateLimitStreak"
+
+// defaultRateLimitAlertThreshold is the streak that alerts ADMIN_NTFY_TOPIC when RATE_LIMIT_ALERT_THRESHOLD is unset
+const defaultRateLimitAlertThreshold = 5
+
+// throttleTracker counts how the TTP API answered during one scheduled run
+type throttleTracker struct {
+	rateLimited atomic.Int64 // Checks that ended in a 429
+	succeeded   atomic.Int64 // Checks that got a response
+}
+
+// reset zeroes the counters at the start of a scheduled run
+func (t *throttleTracker) reset() {
+	t.rateLimited.Store(0)
+	t.succeeded.Store(0)
+}
+
+// record classifies the outcome of one slots request
+func (t *throttleTracker) record(err error) {
+	var statusErr *statusError
+	switch {
+	case err == nil:
+		t.succeeded.Add(1)
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests:
+		t.rateLimited.Add(1)
+	}
+}
+
+// rateLimitAlertThreshold returns how many consecutive rate-limited runs trigger an operator alert
+func (c *SharedConfig) rateLimitAlertThreshold() int {
+	if c.RateLimitAlertThreshold <= 0 {
+		return defaultRateLimitAlertThreshold
+	}
+	return c.RateLimitAlertThreshold
+}
+
+// updateRateLimitStreak extends or resets the streak of consecutive scheduled runs where CBP
+// rate limited a check, alerting ADMIN_NTFY_TOPIC once when it reaches the threshold and again
+// when checks recover. Runs that made no checks leave the streak unchanged.
+func (h *LambdaHandler) updateRateLimitStreak(ctx context.Context) {
+	cfg := h.Mode.shared()
+	if cfg.AdminNtfyTopic == "" {
+		return
+	}
+	limited := h.throttle.rateLimited.Load() > 0
+	if !limited && h.throttle.succeeded.Load() == 0 {
+		return
+	}
+
+	value, err := h.State.GetCursor(ctx, rateLimitCursorName)
+	if err != nil {
+		slog.Warn("Failed to load rate limit streak", "error", err)
+		return
+	}
+	streak, _ := strconv.Atoi(value)
+	threshold := cfg.rateLimitAlertThreshold()
+
+	next := 0
+	if limited {
+		next = streak + 1
+	}
+	if next == streak {
+		return
+	}
+	if err := h.State.PutCursor(ctx, rateLimitCursorName, strconv.Itoa(next)); err != nil {
+		slog.Warn("Failed to save rate limit streak", "error", err)
+		return
+	}
+
+	switch {
+	case next == threshold:
+		slog.Warn("TTP API rate limited consecutive runs, alerting admin topic", "runs", next)
+		h.sendAdminAlert(ctx, "Appointment checks rate limited",
+			fmt.Sprintf("CBP has rate limited the last %d scheduled runs, so new slots may be missed. Consider checking less often, e.g. with CHECK_SCHEDULE or a longer schedule rate.", next))
+	case next == 0 && streak >= threshold:
+		slog.Info("TTP API rate limiting ended", "runs", streak)
+		h.sendAdminAlert(ctx, "Appointment checks recovered",
+			fmt.Sprintf("Checks are succeeding again after %d rate-limited runs.", streak))
+	}
+}
+
+// sendAdminAlert notifies ADMIN_NTFY_TOPIC; failures are only logged
+func (h *LambdaHandler) sendAdminAlert(ctx context.Context, title, message string) {
+	alert := Notification{Topic: h.Mode.shared().AdminNtfyTopic, Title: title, Message: message, Priority: 4}
+	if err := h.deliver(ctx, alert); err != nil {
+		slog.Error("Failed to send admin alert", "title", title, "error", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleTrackerRecord(t *testing.T) {
+	var tracker throttleTracker
+	tracker.record(nil)
+	tracker.record(fmt.Errorf("API %w", &statusError{StatusCode: 429, Attempts: 3}))
+	tracker.record(fmt.Errorf("API %w", &statusError{StatusCode: 503, Attempts: 3}))
+	assert.Equal(t, int64(1), tracker.succeeded.Load())
+	assert.Equal(t, int64(1), tracker.rateLimited.Load())
+
+	tracker.reset()
+	assert.Zero(t, tracker.succeeded.Load())
+	assert.Zero(t, tracker.rateLimited.Load())
+}
+
+func TestPersonalMode_RateLimitStreakAlertsAdmin(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Mode.PersonalConfig.AdminNtfyTopic = "ops"
+	handler.Mode.PersonalConfig.RateLimitAlertThreshold = 2
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	rateLimited := stubTTPResponse{err: fmt.Errorf("API %w", &statusError{StatusCode: 429, Attempts: 3})}
+	ttp := &stubTTPClient{responses: []stubTTPResponse{rateLimited}}
+	handler.TTP = ttp
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	run := func() { handler.HandleRequest(context.Background(), eventJSON) }
+	titles := func() []string {
+		var got []string
+		for _, n := range notifier.sent {
+			assert.Equal(t, "ops", n.Topic)
+			got = append(got, n.Title)
+		}
+		return got
+	}
+
+	run()
+	assert.Empty(t, notifier.sent, "below the threshold")
+	run()
+	run()
+	assert.Equal(t, []string{"Appointment checks rate limited"}, titles(), "alerted once when the streak reaches the threshold")
+
+	ttp.responses = []stubTTPResponse{{body: `[]`}}
+	run()
+	run()
+	assert.Equal(t, []string{"Appointment checks rate limited", "Appointment checks recovered"}, titles())
+
+	// A short streak that recovers before the threshold sends nothing
+	ttp.responses = []stubTTPResponse{rateLimited}
+	run()
+	ttp.responses = []stubTTPResponse{{body: `[]`}}
+	run()
+	assert.Len(t, notifier.sent, 2)
+}
+
+func TestPersonalMode_RateLimitStreakDisabledWithoutAdminTopic(t *testing.T) {
+	handler, cleanup := setupPersonalTestHandler(t)
+	defer cleanup()
+	handler.Mode.PersonalConfig.RateLimitAlertThreshold = 1
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{err: &statusError{StatusCode: 429}}}}
+
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	handler.HandleRequest(context.Background(), eventJSON)
+	assert.Empty(t, notifier.sent)
+}
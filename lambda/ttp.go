@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+type (
+	// TTPClient fetches raw slot listings from the TTP scheduler API. The body is returned
+	// undecoded because its shape depends on the query: slots for one location, or the
+	// locations with availability for a NEXUS asLocations scan.
+	TTPClient interface {
+		FetchSlots(ctx context.Context, serviceType, location string, minimum int) ([]byte, error)
+	}
+
+	// TTPHTTPClient calls the TTP scheduler API over HTTP with retries
+	TTPHTTPClient struct {
+		Config      *SharedConfig
+		URL         string // fmt template taking the location; overrides the TTP API URL when set
+		Client      retryClient
+		MaxAttempts int
+	}
+)
+
+// soonestQueryContextKey marks fetches that need a location's earliest slots
+type soonestQueryContextKey struct{}
+
+// withSoonestQuery marks ctx so FetchSlots asks for the earliest slots regardless of ORDER_BY
+func withSoonestQuery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, soonestQueryContextKey{}, true)
+}
+
+// isSoonestQuery reports whether ctx was marked by withSoonestQuery
+func isSoonestQuery(ctx context.Context) bool {
+	soonest, _ := ctx.Value(soonestQueryContextKey{}).(bool)
+	return soonest
+}
+
+// FetchSlots calls the TTP slots API with retries and returns the raw response body
+func (c *TTPHTTPClient) FetchSlots(ctx context.Context, serviceType, location string, minimum int) ([]byte, error) {
+	var apiURL string
+	if c.URL != "" {
+		apiURL = fmt.Sprintf(c.URL, location)
+	} else if isSoonestQuery(ctx) {
+		apiURL = getSoonestAppointmentURL(c.Config, serviceType, location, minimum)
+	} else {
+		apiURL = getAppointmentURL(c.Config, serviceType, location, minimum)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := c.Client.doWithRetry(ctx, req, c.MaxAttempts)
+	if err != nil {
+		slog.Warn("Failed to get appointment slots", "location", location, "minimum", minimum, "error", err)
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			return nil, fmt.Errorf("API %w", err)
+		}
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
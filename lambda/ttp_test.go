@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubTTPClient returns canned TTP responses without HTTP, one per call in order
+type stubTTPClient struct {
+	responses []stubTTPResponse
+	calls     []int // minimum requested by each call
+}
+
+type stubTTPResponse struct {
+	body string
+	err  error
+}
+
+func (c *stubTTPClient) FetchSlots(ctx context.Context, serviceType, location string, minimum int) ([]byte, error) {
+	resp := c.responses[min(len(c.calls), len(c.responses)-1)]
+	c.calls = append(c.calls, minimum)
+	return []byte(resp.body), resp.err
+}
+
+func TestPersonalMode_StubbedTTPClient(t *testing.T) {
+	eventJSON, _ := json.Marshal(events.CloudWatchEvent{Source: "aws.events"})
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		serviceType  string // Defaults to Global Entry at 5300
+		locationID   string
+		minimumSlots string
+		responses    []stubTTPResponse
+		wantCalls    []int
+		wantStatus   int
+		wantMessages []string
+	}{
+		{
+			name:         "active slot is notified",
+			minimumSlots: "1",
+			responses:    []stubTTPResponse{{body: `[{"locationId":5300,"startTimestamp":"2099-05-04T10:00","active":true}]`}},
+			wantCalls:    []int{1},
+			wantStatus:   200,
+			wantMessages: []string{"Global Entry appointment available at 5300 on 2099-05-04T10:00 (minimum 1 slots)"},
+		},
+		{
+			name:         "inactive and duplicate slots",
+			minimumSlots: "1",
+			responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T09:00","active":false},` +
+				`{"startTimestamp":"2099-05-04T10:00","active":true},{"startTimestamp":"2099-05-04T10:00","active":true}]`}},
+			wantCalls:    []int{1},
+			wantStatus:   200,
+			wantMessages: []string{"Global Entry appointment available at 5300 on 2099-05-04T10:00 (minimum 1 slots)"},
+		},
+		{
+			name:         "empty response checks every minimum",
+			minimumSlots: "3,1",
+			responses:    []stubTTPResponse{{body: `[]`}},
+			wantCalls:    []int{3, 1},
+			wantStatus:   200,
+		},
+		{
+			name:         "error on one minimum falls through to the next",
+			minimumSlots: "3,1",
+			responses: []stubTTPResponse{
+				{err: errors.New("API returned status 503 after 3 attempts")},
+				{body: `[{"startTimestamp":"2099-05-04T10:00","active":true}]`},
+			},
+			wantCalls:    []int{3, 1},
+			wantStatus:   200,
+			wantMessages: []string{"Global Entry appointment available at 5300 on 2099-05-04T10:00 (minimum 1 slots)"},
+		},
+		{
+			name:         "per-service minimums",
+			serviceType:  "Global Entry,NEXUS",
+			locationID:   "Global Entry=5300,NEXUS=5020",
+			minimumSlots: "Global Entry=3,2,NEXUS=1",
+			responses:    []stubTTPResponse{{body: `[]`}},
+			wantCalls:    []int{3, 2, 1},
+			wantStatus:   200,
+		},
+		{
+			name:         "malformed body fails the check",
+			minimumSlots: "1",
+			responses:    []stubTTPResponse{{body: `{"error":"maintenance"}`}},
+			wantCalls:    []int{1},
+			wantStatus:   500,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, cleanup := setupPersonalTestHandler(t)
+			defer cleanup()
+			handler.Mode.PersonalConfig.MinimumSlots = tc.minimumSlots
+			if tc.serviceType != "" {
+				handler.Mode.PersonalConfig.ServiceType = tc.serviceType
+				handler.Mode.PersonalConfig.LocationID = tc.locationID
+			}
+			ttp := &stubTTPClient{responses: tc.responses}
+			handler.TTP = ttp
+			notifier := &recordingNotifier{}
+			handler.Notifier = notifier
+
+			resp, err := handler.HandleRequest(ctx, eventJSON)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			assert.Equal(t, tc.wantCalls, ttp.calls)
+			var messages []string
+			for _, n := range notifier.sent {
+				messages = append(messages, n.Message)
+			}
+			assert.Equal(t, tc.wantMessages, messages)
+		})
+	}
+}
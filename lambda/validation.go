@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type (
+	// subscriptionValidator is a deployment policy check on subscribe requests. It returns why
+	// the request is rejected, or "" to accept it.
+	subscriptionValidator interface {
+		rejects(req SubscriptionRequest) string
+	}
+
+	// subscriptionRule is one SUBSCRIPTION_RULES entry as configured
+	subscriptionRule struct {
+		Field   string `json:"field"`             // ntfyTopic, location, serviceType, locale or tags
+		Deny    string `json:"deny,omitempty"`    // Reject values matching this pattern
+		Require string `json:"require,omitempty"` // Reject values not matching this pattern
+		Reason  string `json:"reason,omitempty"`  // Error returned to the caller; defaults to a generic message
+	}
+
+	// regexValidator applies a subscriptionRule with its pattern compiled
+	regexValidator struct {
+		rule    subscriptionRule
+		pattern *regexp.Regexp
+		deny    bool
+	}
+)
+
+// subscriptionRuleFields returns the values of a subscribe request a rule may check. Tags are
+// checked one by one, so a deny rule rejects the request if any tag matches.
+var subscriptionRuleFields = map[string]func(SubscriptionRequest) []string{
+	"ntfyTopic":   func(req SubscriptionRequest) []string { return []string{req.NtfyTopic} },
+	"location":    func(req SubscriptionRequest) []string { return []string{req.Location} },
+	"serviceType": func(req SubscriptionRequest) []string { return []string{req.ServiceType} },
+	"locale":      func(req SubscriptionRequest) []string { return []string{req.Locale} },
+	"tags":        func(req SubscriptionRequest) []string { return req.Tags },
+}
+
+// parseSubscriptionRules parses SUBSCRIPTION_RULES, a JSON list of rules such as
+// [{"field":"ntfyTopic","deny":"^test-","reason":"test topics are not allowed"}].
+// Each rule sets exactly one of deny or require.
+func parseSubscriptionRules(spec string) ([]subscriptionValidator, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var rules []subscriptionRule
+	if err := json.Unmarshal([]byte(spec), &rules); err != nil {
+		return nil, fmt.Errorf("must be a JSON list of rules: %v", err)
+	}
+	validators := make([]subscriptionValidator, 0, len(rules))
+	for i, rule := range rules {
+		if _, ok := subscriptionRuleFields[rule.Field]; !ok {
+			return nil, fmt.Errorf("rule %d: field must be ntfyTopic, location, serviceType, locale or tags, got %q", i+1, rule.Field)
+		}
+		if (rule.Deny == "") == (rule.Require == "") {
+			return nil, fmt.Errorf("rule %d: set exactly one of deny or require", i+1)
+		}
+		expr := rule.Deny + rule.Require
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: pattern %q is invalid: %v", i+1, expr, err)
+		}
+		validators = append(validators, regexValidator{rule: rule, pattern: pattern, deny: rule.Deny != ""})
+	}
+	return validators, nil
+}
+
+func (v regexValidator) rejects(req SubscriptionRequest) string {
+	for _, value := range subscriptionRuleFields[v.rule.Field](req) {
+		if v.pattern.MatchString(value) == v.deny {
+			if v.rule.Reason != "" {
+				return v.rule.Reason
+			}
+			return fmt.Sprintf("%s %q is not allowed on this deployment", v.rule.Field, value)
+		}
+	}
+	return ""
+}
+
+// subscriptionRejection returns the first reason a configured validator rejects req, or ""
+func (h *LambdaHandler) subscriptionRejection(req SubscriptionRequest) string {
+	for _, validator := range h.validators {
+		if reason := validator.rejects(req); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubscriptionRules(t *testing.T) {
+	validators, err := parseSubscriptionRules("")
+	assert.NoError(t, err)
+	assert.Empty(t, validators)
+
+	for spec, want := range map[string]string{
+		`{"field":"ntfyTopic"}`:                                                   "must be a JSON list of rules",
+		`[{"field":"email","deny":"x"}]`:                                          `rule 1: field must be ntfyTopic, location, serviceType, locale or tags, got "email"`,
+		`[{"field":"ntfyTopic"}]`:                                                 "rule 1: set exactly one of deny or require",
+		`[{"field":"ntfyTopic","deny":"a","require":"b"}]`:                        "rule 1: set exactly one of deny or require",
+		`[{"field":"location","require":"^[0-9]+$"},{"field":"tags","deny":"("}]`: `rule 2: pattern "(" is invalid`,
+	} {
+		_, err := parseSubscriptionRules(spec)
+		if assert.Error(t, err, spec) {
+			assert.Contains(t, err.Error(), want)
+		}
+	}
+}
+
+func TestRegexValidator_Rejects(t *testing.T) {
+	validators, err := parseSubscriptionRules(`[
+		{"field":"ntfyTopic","require":"^team-"},
+		{"field":"tags","deny":"^skull$","reason":"that tag is not allowed"}
+	]`)
+	assert.NoError(t, err)
+	h := &LambdaHandler{validators: validators}
+
+	assert.Empty(t, h.subscriptionRejection(SubscriptionRequest{NtfyTopic: "team-alerts", Tags: []string{"tada"}}))
+	assert.Equal(t, `ntfyTopic "alerts" is not allowed on this deployment`, h.subscriptionRejection(SubscriptionRequest{NtfyTopic: "alerts"}))
+	assert.Equal(t, "that tag is not allowed", h.subscriptionRejection(SubscriptionRequest{NtfyTopic: "team-alerts", Tags: []string{"tada", "skull"}}))
+}
+
+func TestHandleSubscription_DenyRuleFromConfig(t *testing.T) {
+	os.Setenv("MONGODB_PASSWORD", "test123")
+	os.Setenv("SUBSCRIPTION_RULES", `[{"field":"ntfyTopic","deny":"^test-","reason":"test topics are not allowed"}]`)
+	defer func() {
+		os.Unsetenv("MONGODB_PASSWORD")
+		os.Unsetenv("SUBSCRIPTION_RULES")
+	}()
+	mode, err := detectAppMode()
+	assert.NoError(t, err)
+	handler := NewLambdaHandler(mode, "", nil)
+
+	// Rejected before the database is touched, so no collection is needed
+	resp, err := handler.handleSubscription(context.Background(), nil, SubscriptionRequest{Action: "subscribe", Location: "5300", NtfyTopic: "test-topic"})
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
+	assert.Equal(t, "test topics are not allowed", body["error"])
+
+	os.Setenv("SUBSCRIPTION_RULES", `[{"field":"ntfyTopic","deny":"("}]`)
+	_, err = detectAppMode()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "SUBSCRIPTION_RULES is invalid: rule 1: pattern")
+	}
+}
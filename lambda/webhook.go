@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// webhookEventAvailable is the event name for newly found availability
+const webhookEventAvailable = "appointments.available"
+
+// Webhook signature headers. X-Signature is "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with WEBHOOK_SECRET, where timestamp is X-Signature-Timestamp.
+const (
+	webhookSignatureHeader = "X-Signature"
+	webhookTimestampHeader = "X-Signature-Timestamp"
+)
+
+// AppointmentEvent is the machine-readable payload posted to WEBHOOK_URL
+type AppointmentEvent struct {
+	Event       string    `json:"event"`
+	ServiceType string    `json:"serviceType"`
+	Location    string    `json:"location,omitempty"`  // Empty for asLocations scans
+	Locations   []string  `json:"locations,omitempty"` // Location IDs found by an asLocations scan
+	Slots       []string  `json:"slots,omitempty"`     // Start timestamps of the open slots
+	Minimum     int       `json:"minimum"`
+	DetectedAt  time.Time `json:"detectedAt"`
+}
+
+// signWebhookPayload returns the X-Signature value for body sent at timestamp (Unix seconds)
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// defaultWebhookMaxAttempts is the webhook attempt budget used when WEBHOOK_MAX_ATTEMPTS is unset
+const defaultWebhookMaxAttempts = 3
+
+// webhookMaxAttempts returns how many times a webhook delivery is tried before it is dead-lettered
+func (c *SharedConfig) webhookMaxAttempts() int {
+	if c.WebhookMaxAttempts <= 0 {
+		return defaultWebhookMaxAttempts
+	}
+	return c.WebhookMaxAttempts
+}
+
+// sendWebhookEvent posts the event to WEBHOOK_URL with retries, signing it when WEBHOOK_SECRET is set.
+// Events skipped by WEBHOOK_RATE_LIMIT fail like any other, so they are dead-lettered and replayed.
+func (h *LambdaHandler) sendWebhookEvent(ctx context.Context, event AppointmentEvent) error {
+	cfg := h.Mode.shared()
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %v", err)
+	}
+
+	if err := h.webhookLimit.wait(ctx, "webhook"); err != nil {
+		return fmt.Errorf("webhook %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := h.retryClient()
+	if cfg.WebhookSecret != "" {
+		// Signed as each attempt goes out, so time spent queued behind WEBHOOK_RATE_LIMIT or in
+		// retry backoff doesn't age the timestamp receivers check
+		client.Prepare = func(attempt *http.Request) {
+			timestamp := time.Now().Unix()
+			attempt.Header.Set(webhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+			attempt.Header.Set(webhookSignatureHeader, signWebhookPayload(cfg.WebhookSecret, timestamp, body))
+		}
+	}
+	if _, err := client.doWithRetry(ctx, req, cfg.webhookMaxAttempts()); err != nil {
+		return fmt.Errorf("webhook %v", err)
+	}
+	return nil
+}
+
+// webhookReplayTimeout bounds how long one emit spends resending buffered events, so a long
+// backlog or a slow receiver can't hold the invocation open
+const webhookReplayTimeout = 15 * time.Second
+
+// startWebhookEvent emits the event on h.background, so webhook replay, rate-limit waits and
+// retries never delay the ntfy alert sent next. HandleRequest waits for it before returning.
+func (h *LambdaHandler) startWebhookEvent(ctx context.Context, event AppointmentEvent) {
+	if h.Mode.shared().WebhookURL == "" || isImmediateCheck(ctx) {
+		return
+	}
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		h.emitWebhookEvent(ctx, event)
+	}()
+}
+
+// emitWebhookEvent sends the event when WEBHOOK_URL is configured, first replaying events buffered
+// by earlier failures. Events that still fail go to the delivery store.
+func (h *LambdaHandler) emitWebhookEvent(ctx context.Context, event AppointmentEvent) {
+	if h.Mode.shared().WebhookURL == "" || isImmediateCheck(ctx) {
+		return
+	}
+	h.replayFailedDeliveries(ctx)
+	event.Event = webhookEventAvailable
+	event.DetectedAt = time.Now().UTC()
+	h.deliverWebhookEvent(ctx, event)
+}
+
+// deliverWebhookEvent sends one event and dead-letters it on failure, reporting whether it was delivered
+func (h *LambdaHandler) deliverWebhookEvent(ctx context.Context, event AppointmentEvent) bool {
+	return h.deliverWebhookEventWithin(ctx, ctx, event)
+}
+
+// deliverWebhookEventWithin is deliverWebhookEvent with the send bounded by sendCtx, so a timed-out
+// send can still be dead-lettered under ctx
+func (h *LambdaHandler) deliverWebhookEventWithin(ctx, sendCtx context.Context, event AppointmentEvent) bool {
+	err := h.sendWebhookEvent(sendCtx, event)
+	if err == nil {
+		return true
+	}
+	slog.Warn("Failed to deliver webhook event", "service", event.ServiceType, "location", event.Location, "error", err)
+	h.saveFailedDelivery(ctx, FailedDelivery{Event: event, Error: err.Error(), Attempts: h.Mode.shared().webhookMaxAttempts(), FailedAt: time.Now().UTC()})
+	return false
+}
+
+// saveFailedDelivery records an undelivered event in the delivery store
+func (h *LambdaHandler) saveFailedDelivery(ctx context.Context, failed FailedDelivery) {
+	if err := h.Deliveries.Save(ctx, failed); err != nil {
+		slog.Error("Failed to record undelivered webhook event", "service", failed.Event.ServiceType, "location", failed.Event.Location, "error", err)
+	}
+}
+
+// replayFailedDeliveries resends events held by a replayable delivery store. Replay stops at the
+// first failure so an ongoing outage costs one retry cycle per invocation, not one per buffered event,
+// and after webhookReplayTimeout; whatever wasn't resent stays buffered for the next invocation.
+func (h *LambdaHandler) replayFailedDeliveries(ctx context.Context) {
+	replayer, ok := h.Deliveries.(DeliveryReplayer)
+	if !ok {
+		return
+	}
+	pending, err := replayer.Drain(ctx)
+	if err != nil {
+		slog.Warn("Failed to load undelivered webhook events", "error", err)
+		return
+	}
+	replayCtx, cancel := context.WithTimeout(ctx, webhookReplayTimeout)
+	defer cancel()
+	for i, delivery := range pending {
+		if replayCtx.Err() != nil {
+			slog.Warn("Webhook replay timed out, keeping the rest buffered", "remaining", len(pending)-i, "timeout", webhookReplayTimeout)
+			for _, rest := range pending[i:] {
+				h.saveFailedDelivery(ctx, rest)
+			}
+			return
+		}
+		slog.Info("Replaying undelivered webhook event", "service", delivery.Event.ServiceType, "location", delivery.Event.Location, "failedAt", delivery.FailedAt)
+		if !h.deliverWebhookEventWithin(ctx, replayCtx, delivery.Event) {
+			for _, rest := range pending[i+1:] {
+				h.saveFailedDelivery(ctx, rest)
+			}
+			return
+		}
+	}
+}
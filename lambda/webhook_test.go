@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Matches: printf %s "1700000000.<body>" | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=4f16c056924b0b2f3b1857542672fbe1f23aa66ee61f51cb03e4c30fe3d2f921", signWebhookPayload("secret", 1700000000, []byte(`{"event":"appointments.available"}`)))
+	assert.NotEqual(t, signWebhookPayload("secret", 1700000000, []byte("a")), signWebhookPayload("secret", 1700000001, []byte("a")), "timestamp is part of the signed content")
+}
+
+func TestEmitWebhookEvent_Signed(t *testing.T) {
+	var body []byte
+	var signature, timestamp string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+		timestamp = r.Header.Get(webhookTimestampHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	mode := &AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{SharedConfig: SharedConfig{WebhookURL: server.URL, WebhookSecret: "secret"}}}
+	handler := NewLambdaHandler(mode, "", nil)
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	handler.emitWebhookEvent(context.Background(), AppointmentEvent{ServiceType: "Global Entry", Location: "5300", Slots: []string{"2025-05-04T10:00"}, Minimum: 1})
+
+	var event AppointmentEvent
+	assert.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, webhookEventAvailable, event.Event)
+	assert.Equal(t, "5300", event.Location)
+	assert.Equal(t, []string{"2025-05-04T10:00"}, event.Slots)
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(ts, 0), time.Minute)
+	assert.Equal(t, signWebhookPayload("secret", ts, body), signature)
+}
+
+func TestEmitWebhookEvent_SignedAfterRateLimitWait(t *testing.T) {
+	var timestamps []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts, _ := strconv.ParseInt(r.Header.Get(webhookTimestampHeader), 10, 64)
+		timestamps = append(timestamps, ts)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	mode := &AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{SharedConfig: SharedConfig{WebhookURL: server.URL, WebhookSecret: "secret", WebhookRateLimit: "1/2s"}}}
+	handler := NewLambdaHandler(mode, "", nil)
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+
+	// The second event queues for about two seconds behind the rate limit
+	handler.emitWebhookEvent(context.Background(), AppointmentEvent{ServiceType: "Global Entry", Location: "5300"})
+	queued := time.Now()
+	handler.emitWebhookEvent(context.Background(), AppointmentEvent{ServiceType: "Global Entry", Location: "5020"})
+	if assert.Len(t, timestamps, 2) {
+		assert.GreaterOrEqual(t, timestamps[1], queued.Add(time.Second).Unix(), "timestamp taken when the event is sent, not when it queued")
+	}
+}
+
+func TestEmitWebhookEvent_UnsignedWithoutSecret(t *testing.T) {
+	var signature string
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		signature = r.Header.Get(webhookSignatureHeader)
+	}))
+	defer server.Close()
+
+	mode := &AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{SharedConfig: SharedConfig{WebhookURL: server.URL}}}
+	handler := NewLambdaHandler(mode, "", nil)
+	handler.emitWebhookEvent(context.Background(), AppointmentEvent{ServiceType: "NEXUS", Locations: []string{"5020"}})
+	assert.True(t, called)
+	assert.Empty(t, signature)
+}
+
+func TestEmitWebhookEvent_RetriesThenDeadLetters(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	fail := true
+	var delivered []string
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var event AppointmentEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		delivered = append(delivered, event.Location)
+	}))
+	defer server.Close()
+
+	mode := &AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{SharedConfig: SharedConfig{WebhookURL: server.URL, WebhookMaxAttempts: 2}}}
+	handler := NewLambdaHandler(mode, "", nil)
+	store := newMemoryDeliveryStore()
+	handler.Deliveries = store
+
+	handler.emitWebhookEvent(context.Background(), AppointmentEvent{ServiceType: "Global Entry", Location: "5300"})
+	assert.Equal(t, 2, calls)
+	if assert.Len(t, store.pending, 1) {
+		assert.Equal(t, "5300", store.pending[0].Event.Location)
+		assert.Equal(t, "webhook returned status 502 after 2 attempts", store.pending[0].Error)
+	}
+
+	// The buffered event is replayed ahead of the next one once the receiver recovers
+	fail = false
+	handler.emitWebhookEvent(context.Background(), AppointmentEvent{ServiceType: "Global Entry", Location: "5020"})
+	assert.Equal(t, []string{"5300", "5020"}, delivered)
+	assert.Empty(t, store.pending)
+}
+
+func TestReplayFailedDeliveries_StopsAtFirstFailure(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	mode := &AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{SharedConfig: SharedConfig{WebhookURL: server.URL, WebhookMaxAttempts: 1}}}
+	handler := NewLambdaHandler(mode, "", nil)
+	store := newMemoryDeliveryStore()
+	handler.Deliveries = store
+	for _, location := range []string{"5300", "5020", "5140"} {
+		store.Save(context.Background(), FailedDelivery{Event: AppointmentEvent{Location: location}})
+	}
+
+	handler.replayFailedDeliveries(context.Background())
+	assert.Equal(t, 1, calls)
+	assert.Len(t, store.pending, 3, "undelivered events stay buffered")
+}
+
+func TestReplayFailedDeliveries_KeepsBufferPastTimeout(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	mode := &AppMode{IsPersonalMode: true, PersonalConfig: &PersonalConfig{SharedConfig: SharedConfig{WebhookURL: server.URL}}}
+	handler := NewLambdaHandler(mode, "", nil)
+	store := newMemoryDeliveryStore()
+	handler.Deliveries = store
+	for _, location := range []string{"5300", "5020"} {
+		store.Save(context.Background(), FailedDelivery{Event: AppointmentEvent{Location: location}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Out of time before the first replay
+	handler.replayFailedDeliveries(ctx)
+	assert.Equal(t, 0, calls)
+	assert.Len(t, store.pending, 2)
+}
+
+func TestCheckSingleMinimum_WebhookDoesNotDelayNtfy(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		received <- struct{}{}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &Config{MongoDBPassword: "test", SharedConfig: SharedConfig{WebhookURL: server.URL}}
+	handler := NewLambdaHandler(&AppMode{MultiUserConfig: cfg}, "", nil)
+	handler.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+	notifier := &recordingNotifier{}
+	handler.Notifier = notifier
+	handler.TTP = &stubTTPClient{responses: []stubTTPResponse{{body: `[{"startTimestamp":"2099-05-04T10:00","active":true}]`}}}
+
+	_, err := handler.checkSingleMinimum(context.Background(), "Global Entry", "5300", []Subscriber{{Topic: "a"}}, 1)
+	assert.NoError(t, err)
+	assert.Len(t, notifier.sent, 1, "ntfy goes out while the webhook is still pending")
+
+	close(release)
+	handler.background.Wait()
+	assert.Len(t, received, 1)
+}